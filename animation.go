@@ -9,36 +9,90 @@ import (
 	"github.com/g3n/engine/math32"
 )
 
-// Animation describes an ongoing constant-speed, linear animation
+// ANIMATION_SPEED is how many "blocks" per second animated objects move at the default speed
+const ANIMATION_SPEED float32 = 10
+
+// ANIMATION_SCALE_MIN and ANIMATION_SCALE_MAX are the range of the animation speed option, relative to ANIMATION_SPEED
+const ANIMATION_SCALE_MIN float32 = 0.5
+const ANIMATION_SCALE_MAX float32 = 3
+
+// Animator is anything that can be played over time, e.g. an Animation or a Timeline
+type Animator interface {
+	// Update advances the animation by timeDelta seconds and returns whether it is still running
+	Update(timeDelta float64) bool
+}
+
+// Easing maps the elapsed fraction of an animation's duration to the fraction of the change made by then
+type Easing func(t float32) float32
+
+// EaseLinear makes a change at constant speed
+func EaseLinear(t float32) float32 {
+	return t
+}
+
+// EaseIn starts slowly and accelerates at a constant rate, like something falling
+func EaseIn(t float32) float32 {
+	return t * t
+}
+
+// EaseOut starts quickly and decelerates to a stop
+func EaseOut(t float32) float32 {
+	return t * (2 - t)
+}
+
+// EaseInOut accelerates and then decelerates
+func EaseInOut(t float32) float32 {
+	return t * t * (3 - 2*t)
+}
+
+// EaseOutBack overshoots the end of the change and comes back to it, like a spring
+func EaseOutBack(t float32) float32 {
+	const c = 1.70158
+	t--
+	return 1 + (c+1)*t*t*t + c*t*t
+}
+
+// Animation describes an ongoing constant-speed, straight-line animation, whose progress along the line can be eased
 type Animation struct {
 	node     *core.Node        // node to animate
+	from     *math32.Vector3   // where the node was when the animation started
 	dest     *math32.Vector3   // the destination
-	speed    float32           // how many "blocks" per second
+	speed    float32           // how many "blocks" per second, on average
+	easing   Easing            // progress along the line over time
+	elapsed  float32           // seconds since the animation started
 	callback func(interface{}) // function to be called once animation is complete
 	cb_arg   interface{}       // arguments stored and passed in to the callback function
 }
 
-// NewAnimation returns a pointer to a new Animation object
-func NewAnimation(node *core.Node, dest *math32.Vector3, cb func(interface{}), cb_arg interface{}) *Animation {
+// NewAnimation returns a pointer to a new linear Animation object moving at the provided speed
+func NewAnimation(node *core.Node, dest *math32.Vector3, speed float32, cb func(interface{}), cb_arg interface{}) *Animation {
 	a := new(Animation)
 	a.node = node
 	a.dest = dest
-	a.speed = 10
+	a.speed = speed
+	a.easing = EaseLinear
 	a.callback = cb
 	a.cb_arg = cb_arg
 	return a
 }
 
-// Update moves the node towards its destination according to speed
+// SetEasing sets how the animation progresses along the line, without changing its duration
+func (a *Animation) SetEasing(easing Easing) *Animation {
+	a.easing = easing
+	return a
+}
+
+// Update moves the node towards its destination according to speed and easing
 // and calls the callback with the previously provided args once finished
 func (a *Animation) Update(timeDelta float64) bool {
-	pos := a.node.Position()
-	delta := a.dest.Clone()
-	delta.Sub(&pos)
-	dist := delta.Length()
-	delta = delta.Normalize().MultiplyScalar(-a.speed * float32(timeDelta))
-	if dist > delta.Length() {
-		a.node.SetPositionVec(pos.Sub(delta))
+	if a.from == nil {
+		pos := a.node.Position()
+		a.from = &pos
+	}
+	a.elapsed += float32(timeDelta)
+	duration := a.from.DistanceTo(a.dest) / a.speed
+	if a.elapsed < duration {
+		a.node.SetPositionVec(a.from.Clone().Lerp(a.dest, a.easing(a.elapsed/duration)))
 		return true
 	} else {
 		a.node.SetPositionVec(a.dest)
@@ -48,3 +102,201 @@ func (a *Animation) Update(timeDelta float64) bool {
 		return false
 	}
 }
+
+// Fall drops a node straight down to its destination with constant acceleration, like gravity,
+// so that it takes time proportional to the square root of the height
+type Fall struct {
+	node     *core.Node
+	from     *math32.Vector3 // where the node was when the fall started
+	dest     *math32.Vector3
+	gravity  float32           // acceleration in "blocks" per second squared
+	elapsed  float32           // seconds since the fall started
+	callback func(interface{}) // function to be called once the node lands
+	cb_arg   interface{}       // arguments stored and passed in to the callback function
+}
+
+// NewFall returns a pointer to a new Fall of the node to the provided destination with the provided acceleration
+func NewFall(node *core.Node, dest *math32.Vector3, gravity float32, cb func(interface{}), cb_arg interface{}) *Fall {
+	return &Fall{node: node, dest: dest, gravity: gravity, callback: cb, cb_arg: cb_arg}
+}
+
+// Update drops the node by ½·g·t² since the start of the fall
+// and calls the callback with the previously provided args once it reaches its destination
+func (f *Fall) Update(timeDelta float64) bool {
+	if f.from == nil {
+		pos := f.node.Position()
+		f.from = &pos
+	}
+	f.elapsed += float32(timeDelta)
+	drop := f.gravity * f.elapsed * f.elapsed / 2
+	if drop < f.from.Y-f.dest.Y {
+		f.node.SetPositionVec(&math32.Vector3{f.dest.X, f.from.Y - drop, f.dest.Z})
+		return true
+	}
+	f.node.SetPositionVec(f.dest)
+	if f.callback != nil {
+		f.callback(f.cb_arg)
+	}
+	return false
+}
+
+// Rotation turns a node around the vertical axis to an angle, the shortest way around
+type Rotation struct {
+	node     *core.Node
+	from     float32 // angle of the node when the rotation started
+	by       float32 // angle to turn by, between -Pi and Pi
+	to       float32 // angle to turn to
+	duration float32
+	elapsed  float32 // seconds since the rotation started, or -1 if it hasn't started
+	easing   Easing
+}
+
+// NewRotation returns a pointer to a new Rotation of the node to the provided angle, taking the provided seconds
+func NewRotation(node *core.Node, angle, duration float32) *Rotation {
+	return &Rotation{node: node, to: angle, duration: duration, elapsed: -1, easing: EaseOut}
+}
+
+// Update turns the node towards the angle and returns whether it is still turning
+func (r *Rotation) Update(timeDelta float64) bool {
+	if r.elapsed < 0 {
+		r.from = r.node.Rotation().Y
+		r.by = r.to - r.from
+		for r.by > math32.Pi {
+			r.by -= 2 * math32.Pi
+		}
+		for r.by < -math32.Pi {
+			r.by += 2 * math32.Pi
+		}
+		r.elapsed = 0
+	}
+	r.elapsed += float32(timeDelta)
+	if r.elapsed < r.duration {
+		r.node.SetRotationY(r.from + r.by*r.easing(r.elapsed/r.duration))
+		return true
+	}
+	r.node.SetRotationY(r.to)
+	return false
+}
+
+// Scaling changes the scale of a node, keeping its bottom in place
+type Scaling struct {
+	node     core.INode      // looked up on every update, since boxes change nodes when they enter or leave pads
+	from     *math32.Vector3 // scale of the node when the scaling started
+	to       math32.Vector3
+	bottom   float32 // distance from the origin of the node down to its bottom, when not scaled
+	duration float32
+	elapsed  float32
+	easing   Easing
+}
+
+// NewScaling returns a pointer to a new Scaling of the node to the provided scale, taking the provided seconds
+// The node is moved vertically to keep its bottom in place, so it must not be animated otherwise unless bottom is zero
+func NewScaling(node core.INode, to math32.Vector3, bottom, duration float32, easing Easing) *Scaling {
+	return &Scaling{node: node, to: to, bottom: bottom, duration: duration, easing: easing}
+}
+
+// Update scales the node towards the target scale and returns whether it is still changing
+func (s *Scaling) Update(timeDelta float64) bool {
+	node := s.node.GetNode()
+	if s.from == nil {
+		scale := node.Scale()
+		s.from = &scale
+	}
+	s.elapsed += float32(timeDelta)
+	scale := s.to
+	running := s.elapsed < s.duration
+	if running {
+		scale = *s.from.Clone().Lerp(&s.to, s.easing(s.elapsed/s.duration))
+	}
+	node.SetScaleVec(&scale)
+	if s.bottom != 0 {
+		node.SetPositionY(-s.bottom * (1 - scale.Y))
+	}
+	return running
+}
+
+// NewSquash returns an animation that flattens a node that just landed and lets it spring back, bouncing past its normal shape
+// The amount is the fraction of its height the node loses, and bottom is as in NewScaling
+func NewSquash(node core.INode, amount, bottom, duration float32) *Timeline {
+	squashed := math32.Vector3{1 + amount/2, 1 - amount, 1 + amount/2}
+	return Sequence(
+		NewScaling(node, squashed, bottom, duration/3, EaseOut),
+		NewScaling(node, math32.Vector3{1, 1, 1}, bottom, duration*2/3, EaseOutBack),
+	)
+}
+
+// Timeline plays animations one after the other, or all at the same time
+type Timeline struct {
+	anims    []Animator
+	parallel bool
+	callback func(interface{}) // function to be called once all animations are complete
+	cb_arg   interface{}       // arguments stored and passed in to the callback function
+}
+
+// Sequence returns a pointer to a new Timeline that plays the provided animations one after the other
+func Sequence(anims ...Animator) *Timeline {
+	return &Timeline{anims: anims}
+}
+
+// Parallel returns a pointer to a new Timeline that plays the provided animations at the same time
+func Parallel(anims ...Animator) *Timeline {
+	return &Timeline{anims: anims, parallel: true}
+}
+
+// SetCallback sets the function to be called with the provided args once all animations are complete
+func (tl *Timeline) SetCallback(cb func(interface{}), cb_arg interface{}) *Timeline {
+	tl.callback = cb
+	tl.cb_arg = cb_arg
+	return tl
+}
+
+// Add adds animations to the end of the timeline
+func (tl *Timeline) Add(anims ...Animator) {
+	tl.anims = append(tl.anims, anims...)
+}
+
+// Running returns whether the timeline has animations left to play
+func (tl *Timeline) Running() bool {
+	return len(tl.anims) > 0
+}
+
+// Update advances the current animations and calls the callback once they are all complete
+func (tl *Timeline) Update(timeDelta float64) bool {
+	if !tl.Running() {
+		return false
+	}
+	if tl.parallel {
+		running := make([]Animator, 0, len(tl.anims))
+		for _, anim := range tl.anims {
+			if anim.Update(timeDelta) {
+				running = append(running, anim)
+			}
+		}
+		tl.anims = running
+	} else if !tl.anims[0].Update(timeDelta) {
+		tl.anims = tl.anims[1:]
+	}
+	if tl.Running() {
+		return true
+	}
+	if tl.callback != nil {
+		tl.callback(tl.cb_arg)
+	}
+	return false
+}
+
+// finish plays an animation to its end at once
+func finish(anim Animator) {
+	for anim.Update(1e6) {
+	}
+}
+
+// animationScale returns the animation speed scale set by a value of the speed slider
+func animationScale(value float32) float32 {
+	return ANIMATION_SCALE_MIN + value*(ANIMATION_SCALE_MAX-ANIMATION_SCALE_MIN)
+}
+
+// animationScaleValue returns the value of the speed slider that sets the provided animation speed scale
+func animationScaleValue(scale float32) float32 {
+	return (scale - ANIMATION_SCALE_MIN) / (ANIMATION_SCALE_MAX - ANIMATION_SCALE_MIN)
+}
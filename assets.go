@@ -0,0 +1,168 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The game's assets, embedded so that the binary can be run from any directory
+//
+//go:embed audio gopher/gopher.obj gopher/gopher.mtl gui/*.png img levels
+var embeddedAssets embed.FS
+
+// The directory (inside the user's cache directory) where the embedded assets are extracted
+// G3N loads images, sounds and models by path, so the assets need to exist as files
+const ASSETS_CACHE_DIRNAME string = "gokoban-assets"
+
+// The directory (inside the user data directory) that is used as the asset override directory if none is provided
+const ASSETS_OVERRIDE_DIRNAME string = "assets"
+
+// Directories where assets are looked up, in order of priority (see InitAssets)
+var assetDirs []string
+
+// The directory the embedded assets were extracted to, if they were
+var extractedDir string
+
+// InitAssets prepares the assets for loading: extracts the embedded assets and sets the override directory
+// Files inside the override directory take priority over the embedded assets, so that they can be replaced by modders
+func InitAssets(overrideDir string) {
+
+	assetDirs = nil
+	if overrideDir == "" {
+		if dataDir, err := userDataDir(); err == nil {
+			overrideDir = filepath.Join(dataDir, ASSETS_OVERRIDE_DIRNAME)
+		}
+	}
+	if info, err := os.Stat(overrideDir); err == nil && info.IsDir() {
+		log.Info("Using asset override directory %v", overrideDir)
+		assetDirs = append(assetDirs, overrideDir)
+	}
+
+	dir, err := extractAssets()
+	if err != nil {
+		// Fall back to the assets in the working directory
+		log.Error("Error extracting assets: %v", err)
+		dir = "."
+	} else {
+		extractedDir = dir
+	}
+	assetDirs = append(assetDirs, dir)
+}
+
+// isExtractedAsset returns whether the provided path is inside the directory the embedded assets were extracted to
+// Files there must not be modified, since the directory is replaced whenever the embedded assets change
+func isExtractedAsset(path string) bool {
+	if extractedDir == "" {
+		return false
+	}
+	rel, err := filepath.Rel(extractedDir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Asset returns the path of the file or directory with the provided slash-separated name e.g. "gui/title3.png"
+// The override directory is searched first, then the embedded assets
+// The assets are prepared with the default override directory if InitAssets wasn't called yet
+func Asset(name string) string {
+	if len(assetDirs) == 0 {
+		InitAssets("")
+	}
+	for _, dir := range assetDirs[:len(assetDirs)-1] {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return filepath.Join(assetDirs[len(assetDirs)-1], filepath.FromSlash(name))
+}
+
+// extractAssets writes the embedded assets into the cache directory, unless they were already extracted, returning their directory
+// Each version of the assets is extracted into its own directory, named after a hash of the assets, and older versions are removed
+// The assets are written into a temporary directory that is then renamed, so that other running instances of the game
+// never see a partial extraction, and a directory is never removed while an instance of the same version may be using it
+func extractAssets() (string, error) {
+
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	baseDir := filepath.Join(cacheDir, ASSETS_CACHE_DIRNAME)
+
+	// Hash the names and contents of all assets
+	h := sha256.New()
+	err = fs.WalkDir(embeddedAssets, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := embeddedAssets.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		h.Write([]byte(name))
+		h.Write(data)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	version := hex.EncodeToString(h.Sum(nil)[:8])
+	dir := filepath.Join(baseDir, version)
+
+	if _, err := os.Stat(dir); err == nil {
+		return dir, nil
+	}
+	log.Info("Extracting assets to %v", dir)
+
+	err = os.MkdirAll(baseDir, 0755)
+	if err != nil {
+		return "", err
+	}
+	tmpDir, err := ioutil.TempDir(baseDir, version+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	err = fs.WalkDir(embeddedAssets, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		p := filepath.Join(tmpDir, filepath.FromSlash(name))
+		if d.IsDir() {
+			return os.MkdirAll(p, 0755)
+		}
+		data, err := embeddedAssets.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(p, data, 0644)
+	})
+	if err == nil {
+		err = os.Rename(tmpDir, dir)
+	}
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		// Another instance may have extracted the same assets in the meantime
+		if _, serr := os.Stat(dir); serr == nil {
+			return dir, nil
+		}
+		return "", err
+	}
+
+	// Remove older versions, leaving extractions in progress alone
+	if entries, err := ioutil.ReadDir(baseDir); err == nil {
+		for _, e := range entries {
+			if e.Name() != version && !strings.HasSuffix(e.Name(), ".tmp") {
+				os.RemoveAll(filepath.Join(baseDir, e.Name()))
+			}
+		}
+	}
+	return dir, nil
+}
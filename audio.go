@@ -58,56 +58,56 @@ func NewAudio() *Audio {
 	}
 
 	// Music
-	a.musicGame = createPlayer("./audio/music/Lost-Jungle_Looping.ogg")
+	a.musicGame = createPlayer(Asset("audio/music/Lost-Jungle_Looping.ogg"))
 	a.musicGame.SetLooping(true)
-	a.musicMenu = createPlayer("./audio/music/Spooky-Island.ogg")
+	a.musicMenu = createPlayer(Asset("audio/music/Spooky-Island.ogg"))
 	a.musicMenu.SetLooping(true)
 
 	// Gameplay sound effects
-	a.levelDone = createPlayer("./audio/sfx/level_done.ogg")
+	a.levelDone = createPlayer(Asset("audio/sfx/level_done.ogg"))
 	a.levelDone.SetRolloffFactor(0)
-	a.levelRestart = createPlayer("./audio/sfx/level_restart.ogg")
+	a.levelRestart = createPlayer(Asset("audio/sfx/level_restart.ogg"))
 	a.levelRestart.SetRolloffFactor(0)
-	a.levelFail = createPlayer("./audio/sfx/level_fail.ogg")
+	a.levelFail = createPlayer(Asset("audio/sfx/level_fail.ogg"))
 	a.levelFail.SetRolloffFactor(0)
-	a.gameComplete = createPlayer("./audio/sfx/game_complete.ogg")
+	a.gameComplete = createPlayer(Asset("audio/sfx/game_complete.ogg"))
 	a.gameComplete.SetRolloffFactor(0)
 
 	// User interface sound effects
-	a.click = createPlayer("./audio/sfx/button_click.ogg")
+	a.click = createPlayer(Asset("audio/sfx/button_click.ogg"))
 	a.click.SetRolloffFactor(0)
-	a.hover = createPlayer("./audio/sfx/button_hover.ogg")
+	a.hover = createPlayer(Asset("audio/sfx/button_hover.ogg"))
 	a.hover.SetRolloffFactor(0)
 
 	// Gopher sound effects
-	a.gopherWalk = createPlayer("./audio/sfx/gopher_walk.ogg")
+	a.gopherWalk = createPlayer(Asset("audio/sfx/gopher_walk.ogg"))
 	a.gopherWalk.SetRolloffFactor(0)
-	a.gopherBump = createPlayer("./audio/sfx/gopher_bump.ogg")
+	a.gopherBump = createPlayer(Asset("audio/sfx/gopher_bump.ogg"))
 	a.gopherBump.SetRolloffFactor(0)
-	a.gopherHurt = createPlayer("./audio/sfx/gopher_hurt.ogg")
+	a.gopherHurt = createPlayer(Asset("audio/sfx/gopher_hurt.ogg"))
 	a.gopherHurt.SetRolloffFactor(0)
-	a.gopherFallStart = createPlayer("./audio/sfx/gopher_fall_start.ogg")
+	a.gopherFallStart = createPlayer(Asset("audio/sfx/gopher_fall_start.ogg"))
 	a.gopherFallStart.SetRolloffFactor(0)
-	a.gopherFallEnd = createPlayer("./audio/sfx/gopher_fall_end.ogg")
+	a.gopherFallEnd = createPlayer(Asset("audio/sfx/gopher_fall_end.ogg"))
 	a.gopherFallEnd.SetRolloffFactor(0)
 
 	// Box sound effects
-	a.boxPush = createPlayer("./audio/sfx/box_push.ogg")
+	a.boxPush = createPlayer(Asset("audio/sfx/box_push.ogg"))
 	a.boxPush.SetRolloffFactor(0)
-	a.boxOnPad = createPlayer("./audio/sfx/box_on.ogg")
+	a.boxOnPad = createPlayer(Asset("audio/sfx/box_on.ogg"))
 	a.boxOnPad.SetRolloffFactor(0)
-	a.boxOffPad = createPlayer("./audio/sfx/box_off.ogg")
+	a.boxOffPad = createPlayer(Asset("audio/sfx/box_off.ogg"))
 	a.boxOffPad.SetRolloffFactor(0)
-	a.boxFallStart = createPlayer("./audio/sfx/box_fall_start.ogg")
+	a.boxFallStart = createPlayer(Asset("audio/sfx/box_fall_start.ogg"))
 	a.boxFallStart.SetRolloffFactor(0)
-	a.boxFallEnd = createPlayer("./audio/sfx/box_fall_end.ogg")
+	a.boxFallEnd = createPlayer(Asset("audio/sfx/box_fall_end.ogg"))
 	a.boxFallEnd.SetRolloffFactor(0)
 
 	// Elevator sound effects
-	a.elevatorUp = createPlayer("./audio/sfx/elevator_up.ogg")
+	a.elevatorUp = createPlayer(Asset("audio/sfx/elevator_up.ogg"))
 	a.elevatorUp.SetLooping(true)
 	a.elevatorUp.SetRolloffFactor(0)
-	a.elevatorDown = createPlayer("./audio/sfx/elevator_down.ogg")
+	a.elevatorDown = createPlayer(Asset("audio/sfx/elevator_down.ogg"))
 	a.elevatorDown.SetLooping(true)
 	a.elevatorDown.SetRolloffFactor(0)
 
@@ -0,0 +1,525 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/danaugrs/gokoban/generator"
+	"github.com/danaugrs/gokoban/sim"
+	"github.com/danaugrs/gokoban/solver"
+
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// runCommand runs the command line tool named by the first argument and returns the exit code
+func runCommand(args []string) int {
+
+	switch args[0] {
+	case "solve":
+		return cmdSolve(args[1:])
+	case "lint":
+		return cmdLint(args[1:])
+	case "import":
+		return cmdImport(args[1:])
+	case "export":
+		return cmdExport(args[1:])
+	case "fmt":
+		return cmdFmt(args[1:])
+	case "generate":
+		return cmdGenerate(args[1:])
+	}
+
+	fmt.Fprintf(os.Stderr, "gokoban: unknown command %q\n", args[0])
+	fmt.Fprintln(os.Stderr, "Commands:")
+	fmt.Fprintln(os.Stderr, "  solve <levels or packs...>  find a shortest solution for each level")
+	fmt.Fprintln(os.Stderr, "  lint <levels or packs...>   check level files for problems")
+	fmt.Fprintln(os.Stderr, "  import [-o dir] <files...>  convert XSB and SLC puzzles to level files")
+	fmt.Fprintln(os.Stderr, "  export <levels or replays>  print levels in XSB and solutions in LURD notation")
+	fmt.Fprintln(os.Stderr, "  fmt [-w] <levels or packs>  rewrite level files with aligned columns")
+	fmt.Fprintln(os.Stderr, "  generate [-o pack] [-n count] [-difficulty d]  create new solvable levels")
+	return 2
+}
+
+// readLevelArgs reads the provided level files, and the level files of the provided level packs (directories or zip archives)
+// Each level is named after its path, and problems reading a file or pack are returned as errors prefixed by its path
+func readLevelArgs(args []string) ([]PackFile, []error) {
+	var levels []PackFile
+	var errs []error
+	for _, arg := range args {
+		if IsPack(arg) {
+			pack, err := LoadPack(arg)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", arg, err))
+				continue
+			}
+			for _, f := range pack.Files {
+				f.Name = filepath.Join(arg, f.Name)
+				levels = append(levels, f)
+			}
+			continue
+		}
+		b, err := ioutil.ReadFile(arg)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		files, err := ReadLevelFile(arg, b)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", arg, err))
+			continue
+		}
+		levels = append(levels, files...)
+	}
+	return levels, errs
+}
+
+// formatMoves returns the provided moves as a string of direction letters
+func formatMoves(moves []sim.Dir) string {
+	var sb strings.Builder
+	for _, d := range moves {
+		sb.WriteString(d.String())
+	}
+	return sb.String()
+}
+
+// cmdSolve prints a shortest solution for each of the provided level files
+func cmdSolve(args []string) int {
+
+	fs := flag.NewFlagSet("solve", flag.ExitOnError)
+	maxStates := fs.Int("max", solver.DEFAULT_MAX_STATES, "maximum number of states to visit per level")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: gokoban solve [-max states] <level files or packs...>")
+		fmt.Fprintln(os.Stderr, "Directions are relative to the level file: u and d move across rows, l and r across columns.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	code := 0
+	levels, errs := readLevelArgs(fs.Args())
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err)
+		code = 1
+	}
+	for _, level := range levels {
+		path := level.Name
+		ld, err := sim.ParseLevel(level.Source)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			code = 1
+			continue
+		}
+
+		res, err := solver.Solve(ld, *maxStates)
+		switch {
+		case err != nil:
+			fmt.Printf("%s: gave up after %d states (%v)\n", path, res.Visited, err)
+			code = 1
+		case res.Solvable:
+			fmt.Printf("%s: solved in %d moves (%d pushes)\n", path, len(res.Moves), res.Pushes)
+			fmt.Printf("  %s\n", formatMoves(res.Moves))
+		default:
+			fmt.Printf("%s: no solution\n", path)
+			code = 1
+		}
+		fmt.Printf("  visited %d states, max depth %d, %v\n", res.Visited, res.MaxDepth, res.Elapsed)
+	}
+
+	return code
+}
+
+// cmdLint checks the provided level files, and the level files of the provided level packs, for problems
+func cmdLint(args []string) int {
+
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: gokoban lint <level files or packs...>")
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	levels, errs := readLevelArgs(fs.Args())
+	for _, err := range errs {
+		fmt.Println(err)
+	}
+
+	problems := len(errs)
+	for _, level := range levels {
+		path := level.Name
+		ld, err := sim.ParseLevel(level.Source)
+		if err == nil {
+			err = sim.CheckRoundTrip(ld)
+		}
+		if err == nil {
+			err = lintErr(sim.Lint(ld))
+		}
+		if errs, ok := err.(sim.LevelErrors); ok {
+			for _, e := range errs {
+				fmt.Printf("%s: %v\n", path, e)
+			}
+			problems += len(errs)
+		} else if err != nil {
+			fmt.Printf("%s: %v\n", path, err)
+			problems++
+		}
+	}
+
+	if problems > 0 {
+		fmt.Printf("%d problem(s) found in %d file(s)\n", problems, len(levels))
+		return 1
+	}
+	return 0
+}
+
+// lintErr returns the provided lint errors as an error, or nil if there are none
+func lintErr(errs sim.LevelErrors) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// cmdFmt prints the provided levels as written by sim.FormatLevel, or rewrites their files
+func cmdFmt(args []string) int {
+
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := fs.Bool("w", false, "write the result to the level files instead of printing it")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: gokoban fmt [-w] <level files or packs...>")
+		fmt.Fprintln(os.Stderr, "Levels are written without surrounding whitespace and with their columns aligned.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	levels, errs := readLevelArgs(fs.Args())
+	code := 0
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err)
+		code = 1
+	}
+
+	for _, level := range levels {
+		ld, err := sim.ParseLevel(level.Source)
+		if err == nil {
+			err = sim.CheckRoundTrip(ld)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s:\n%v\n", level.Name, err)
+			code = 1
+			continue
+		}
+		source := sim.FormatLevel(ld)
+
+		if !*write {
+			fmt.Printf("; %s\n%s\n", level.Name, source)
+			continue
+		}
+		if source == level.Source {
+			continue
+		}
+		// Only plain level files can be rewritten, not levels inside zip archives or imported puzzle files
+		if info, err := os.Stat(level.Name); err != nil || !info.Mode().IsRegular() || !strings.EqualFold(filepath.Ext(level.Name), LEVEL_FILE_EXT) {
+			fmt.Fprintf(os.Stderr, "%s: can't be rewritten\n", level.Name)
+			code = 1
+			continue
+		}
+		err = ioutil.WriteFile(level.Name, []byte(source), 0644)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+			continue
+		}
+		fmt.Println(level.Name)
+	}
+
+	return code
+}
+
+// cmdImport converts the puzzles in the provided XSB and SLC files to level files
+func cmdImport(args []string) int {
+
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	outDir := fs.String("o", ".", "directory to write the level files to")
+	force := fs.Bool("f", false, "overwrite existing level files")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: gokoban import [-o dir] [-f] <xsb or slc files...>")
+		fmt.Fprintln(os.Stderr, "Each puzzle is written to <dir>/<file>-<number>.txt, or <dir>/<file>.txt if the file has a single puzzle.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	err := os.MkdirAll(*outDir, 0755)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	code := 0
+	for _, path := range fs.Args() {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+			continue
+		}
+		col, err := ImportLevelFile(path, data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			code = 1
+			continue
+		}
+
+		base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		digits := len(fmt.Sprint(len(col.Levels)))
+		written := 0
+		for i, l := range col.Levels {
+			name := base + LEVEL_FILE_EXT
+			if len(col.Levels) > 1 {
+				name = fmt.Sprintf("%s-%0*d%s", base, digits, i+1, LEVEL_FILE_EXT)
+			}
+			out := filepath.Join(*outDir, name)
+			if _, err := sim.ParseLevel(l.Source); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: puzzle %d (%s) is not a valid level:\n%v\n", path, i+1, l.Title, err)
+				code = 1
+				continue
+			}
+			if _, err := os.Stat(out); err == nil && !*force {
+				fmt.Fprintf(os.Stderr, "%s already exists (use -f to overwrite)\n", out)
+				code = 1
+				continue
+			}
+			err = ioutil.WriteFile(out, []byte(l.Source), 0644)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				code = 1
+				continue
+			}
+			written++
+		}
+
+		title := col.Title
+		if title == "" {
+			title = path
+		}
+		fmt.Printf("%s: imported %d of %d puzzles to %s\n", title, written, len(col.Levels), *outDir)
+	}
+
+	return code
+}
+
+// cmdExport prints the provided levels in the XSB format, with the moves of the provided replays or solutions in LURD notation
+func cmdExport(args []string) int {
+
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	solve := fs.Bool("solve", false, "add a shortest solution to each level")
+	maxStates := fs.Int("max", solver.DEFAULT_MAX_STATES, "maximum number of states to visit per level when solving")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: gokoban export [-solve] [-max states] <level files, packs or replay files...>")
+		fmt.Fprintln(os.Stderr, "Only levels that fit on a single floor, without elevators, can be exported.")
+		fmt.Fprintln(os.Stderr, "Replay files (.json) are exported as their level along with the moves of the replay.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	code := 0
+	var levels []PackFile
+	var replays []*sim.Replay
+	var levelArgs []string
+	for _, arg := range fs.Args() {
+		if !IsPack(arg) && strings.EqualFold(filepath.Ext(arg), ".json") {
+			r, err := LoadReplay(arg)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", arg, err)
+				code = 1
+				continue
+			}
+			levels = append(levels, PackFile{Name: r.Level, Source: r.Source})
+			replays = append(replays, r)
+			continue
+		}
+		levelArgs = append(levelArgs, arg)
+	}
+	files, errs := readLevelArgs(levelArgs)
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err)
+		code = 1
+	}
+	levels = append(levels, files...)
+
+	for i, level := range levels {
+		ld, err := sim.ParseLevel(level.Source)
+		if err == nil {
+			var xsb string
+			xsb, err = sim.ExportXSB(ld)
+			if err == nil {
+				fmt.Print(xsb)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", level.Name, err)
+			code = 1
+			continue
+		}
+		fmt.Printf("Title: %s\n", level.Name)
+
+		if i < len(replays) {
+			fmt.Printf("Solution: %s\n", sim.FormatLURD(replays[i].History(ld)))
+		} else if *solve {
+			res, err := solver.Solve(ld, *maxStates)
+			if err == nil && res.Solvable {
+				fmt.Printf("Solution: %s\n", sim.FormatLURD(sim.PlayDirs(ld, res.Moves)))
+			} else {
+				fmt.Fprintf(os.Stderr, "%s: no solution found\n", level.Name)
+				code = 1
+			}
+		}
+		fmt.Println()
+	}
+
+	return code
+}
+
+// cmdGenerate creates new levels and adds them to a level pack directory, listing them in its manifest with their solutions
+func cmdGenerate(args []string) int {
+
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	outDir := fs.String("o", "generated", "level pack directory to add the levels to")
+	count := fs.Int("n", 1, "number of levels to generate")
+	difficulty := fs.String("difficulty", "medium", "target difficulty: "+strings.Join(generator.DIFFICULTIES, ", "))
+	floors := fs.Int("floors", 1, fmt.Sprintf("number of floors (up to %d)", generator.MAX_FLOORS))
+	boxes := fs.Int("boxes", 2, "number of boxes")
+	elevators := fs.Bool("elevators", false, "connect the floors with elevators")
+	seed := fs.Int64("seed", 0, "random seed (0 for a random one)")
+	maxStates := fs.Int("max", generator.DEFAULT_MAX_STATES, "maximum number of states to visit when solving each level tried")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: gokoban generate [flags]")
+		fmt.Fprintln(os.Stderr, "Levels are built by playing backwards from the solved position, so they are always solvable.")
+		fmt.Fprintln(os.Stderr, "Their solutions and estimated difficulties are saved in the pack's manifest.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	fmt.Printf("Seed: %d\n", *seed)
+	opts := generator.Options{
+		Difficulty: *difficulty,
+		Floors:     *floors,
+		Boxes:      *boxes,
+		Elevators:  *elevators,
+		MaxStates:  *maxStates,
+		Rand:       rand.New(rand.NewSource(*seed)),
+	}
+
+	err := os.MkdirAll(*outDir, 0755)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// Add the levels to the manifest, listing the level files already in the pack if it doesn't have one
+	var manifest PackManifest
+	manifestPath := filepath.Join(*outDir, PACK_MANIFEST_FILENAME)
+	if data, err := ioutil.ReadFile(manifestPath); err == nil {
+		err = json.Unmarshal(data, &manifest)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", manifestPath, err)
+			return 1
+		}
+	}
+	if len(manifest.Levels) == 0 {
+		entries, err := ioutil.ReadDir(*outDir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		for _, e := range entries {
+			if !e.IsDir() && IsLevelFile(e.Name()) {
+				manifest.Levels = append(manifest.Levels, PackLevel{File: e.Name()})
+			}
+		}
+		sort.Slice(manifest.Levels, func(i, j int) bool { return naturalLess(manifest.Levels[i].File, manifest.Levels[j].File) })
+	}
+	if manifest.Title == "" {
+		manifest.Title = filepath.Base(filepath.Clean(*outDir))
+	}
+
+	code := 0
+	n := len(manifest.Levels)
+	for i := 0; i < *count; i++ {
+		l, err := generator.Generate(opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+			break
+		}
+
+		// Name the level after the next number that isn't taken
+		var name string
+		for {
+			n++
+			name = fmt.Sprintf("%d%s", n, LEVEL_FILE_EXT)
+			if _, err := os.Stat(filepath.Join(*outDir, name)); os.IsNotExist(err) {
+				break
+			}
+		}
+		out := filepath.Join(*outDir, name)
+		err = ioutil.WriteFile(out, []byte(l.Source), 0644)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+			break
+		}
+
+		solution := sim.FormatLURD(sim.PlayDirs(l.Data, l.Solution))
+		manifest.Levels = append(manifest.Levels, PackLevel{File: name, Difficulty: l.Difficulty, Solution: solution})
+		shortest := "shortest "
+		if !l.Shortest {
+			shortest = ""
+		}
+		fmt.Printf("%s: %s (score %d), %ssolution with %d steps and %d pushes\n", out, l.Difficulty, l.Score, shortest, len(l.Solution), l.Pushes)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "\t")
+	if err == nil {
+		err = ioutil.WriteFile(manifestPath, append(data, '\n'), 0644)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return code
+}
@@ -0,0 +1,820 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/danaugrs/gokoban/sim"
+	"github.com/g3n/engine/core"
+	"github.com/g3n/engine/geometry"
+	"github.com/g3n/engine/graphic"
+	"github.com/g3n/engine/light"
+	"github.com/g3n/engine/material"
+	"github.com/g3n/engine/math32"
+	"github.com/g3n/engine/window"
+
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// The directory (inside the user's packs directory) where levels created in the editor are saved
+const EDITOR_PACK_DIRNAME string = "my-levels"
+
+// The number of rows and columns of the floor of a new level
+const EDITOR_NEW_LEVEL_SIZE int = 5
+
+// The maximum height of a level in the editor
+const EDITOR_MAX_FLOORS int = 12
+
+const EDITOR_HELP string = "WASD/arrows: move   Q/E: floor   1: block  2: box  3: pad  4: start  5: elevator  6: teleporter  7: ice  8: plate  9: gate  0: conveyor  T: arrow  X: remove   +/-: elevator height   P: play-test   Ctrl+S: save   Ctrl+N: new level"
+
+// The names of the cell types shown in the editor
+var editorCellNames = map[sim.CELL_TYPE]string{
+	sim.BLOCK:          "block",
+	sim.ICE:            "ice",
+	sim.CONVEYOR:       "conveyor belt",
+	sim.BOX:            "box",
+	sim.BOX_ON_PAD:     "box on pad",
+	sim.HEAVY_BOX:      "heavy box",
+	sim.HEAVY_ON_PAD:   "heavy box on pad",
+	sim.FRAGILE_BOX:    "fragile box",
+	sim.FRAGILE_ON_PAD: "fragile box on pad",
+	sim.GLUED_BOX:      "glued box",
+	sim.GLUED_ON_PAD:   "glued box on pad",
+	sim.PAD:            "pad",
+	sim.START:          "start",
+	sim.START_ON_PAD:   "start on pad",
+	sim.ELEVATOR:       "elevator",
+	sim.ELEVATOR_SHAFT: "elevator shaft",
+	sim.NONE:           "empty",
+}
+
+// editorCellName returns the name of the cell type shown in the editor
+func editorCellName(c sim.CELL_TYPE) string {
+	if c.IsTeleporter() {
+		return "teleporter " + string(c)
+	}
+	if c.IsPlate() {
+		return "pressure plate " + string(c)
+	}
+	if c.IsGate() {
+		return "gate " + string(c)
+	}
+	if c.IsTile() {
+		return "arrow " + string(c)
+	}
+	return editorCellNames[c]
+}
+
+// Editor is the in-game level editor
+// It edits the cells of a level, drawing them in place of the current level, and can play-test the level at any time
+type Editor struct {
+	game *Gokoban
+
+	cells    [][][]sim.CELL_TYPE // cell types indexed by [z][x][y], without the padding added by sim.ParseLevel
+	cursor   sim.GridLoc         // location in cells where cells are placed and removed
+	name     string              // name of the level file
+	path     string              // path the level is saved to
+	modified bool                // whether there are unsaved changes
+	status   string
+
+	test *Level // level being play-tested, if any
+
+	scene      *core.Node
+	cellsNode  *core.Node
+	cursorMesh *graphic.Mesh
+	light      *light.Point
+
+	padGeom        *geometry.Geometry
+	startGeom      *geometry.Geometry
+	shaftGeom      *geometry.Geometry
+	startMaterial  *material.Standard
+	shaftMaterial  *material.Standard
+	cursorMaterial *material.Standard
+}
+
+// NewEditor returns a pointer to a new Editor for the provided level, saving it to the provided path
+// An empty source starts a new level
+func NewEditor(g *Gokoban, name, path, source string) *Editor {
+
+	e := new(Editor)
+	e.game = g
+	e.name = name
+	e.path = path
+
+	if ld, err := sim.ParseLevel(source); err == nil {
+		e.cells = ld.Cells()
+		e.cursor = ld.GopherInit
+		e.cursor.Z--
+		e.cursor.X--
+	} else {
+		e.newLevel()
+	}
+
+	e.padGeom = geometry.NewPlane(0.9, 0.9)
+	e.startGeom = geometry.NewSphere(0.3, 16, 8)
+	e.shaftGeom = geometry.NewCube(0.9)
+	e.startMaterial = material.NewStandard(&math32.Color{0.628, 0.882, 0.1})
+	e.shaftMaterial = material.NewStandard(&math32.Color{0.2, 0.3, 1})
+	e.shaftMaterial.SetOpacity(0.25)
+	e.shaftMaterial.SetTransparent(true)
+	e.cursorMaterial = material.NewStandard(&math32.Color{1, 1, 0})
+	e.cursorMaterial.SetWireframe(true)
+
+	e.scene = core.NewNode()
+	e.cellsNode = core.NewNode()
+	e.scene.Add(e.cellsNode)
+	e.cursorMesh = graphic.NewMesh(geometry.NewCube(1.05), e.cursorMaterial)
+	e.scene.Add(e.cursorMesh)
+	e.light = light.NewPoint(&math32.Color{1, 1, 1}, 8.0)
+	e.scene.Add(e.light)
+
+	e.setStatus("Editing " + e.name)
+	e.rebuild()
+	return e
+}
+
+// newLevel replaces the cells with a floor of blocks with the start position in the middle
+func (e *Editor) newLevel() {
+	e.cells = make([][][]sim.CELL_TYPE, EDITOR_NEW_LEVEL_SIZE)
+	for i := range e.cells {
+		e.cells[i] = make([][]sim.CELL_TYPE, EDITOR_NEW_LEVEL_SIZE)
+		for j := range e.cells[i] {
+			e.cells[i][j] = []sim.CELL_TYPE{sim.BLOCK}
+		}
+	}
+	mid := EDITOR_NEW_LEVEL_SIZE / 2
+	e.cells[mid][mid] = append(e.cells[mid][mid], sim.START)
+	e.cursor = sim.GridLoc{mid, mid, 1}
+}
+
+// get returns the cell type at the provided location
+func (e *Editor) get(loc sim.GridLoc) sim.CELL_TYPE {
+	if loc.Z < 0 || loc.Z >= len(e.cells) || loc.X < 0 || loc.X >= len(e.cells[0]) || loc.Y < 0 {
+		return sim.NONE
+	}
+	column := e.cells[loc.Z][loc.X]
+	if loc.Y >= len(column) {
+		return sim.NONE
+	}
+	return column[loc.Y]
+}
+
+// set sets the cell type at the provided location, which must be inside the grid (see grow)
+func (e *Editor) set(loc sim.GridLoc, c sim.CELL_TYPE) {
+	column := e.cells[loc.Z][loc.X]
+	for len(column) <= loc.Y {
+		column = append(column, sim.NONE)
+	}
+	column[loc.Y] = c
+	for len(column) > 0 && column[len(column)-1] == sim.NONE {
+		column = column[:len(column)-1]
+	}
+	e.cells[loc.Z][loc.X] = column
+}
+
+// grow adds rows or columns to the grid so that it includes the cursor, which can be one row or column outside of it
+func (e *Editor) grow() {
+
+	ncols := len(e.cells[0])
+	emptyRow := func() [][]sim.CELL_TYPE { return make([][]sim.CELL_TYPE, ncols) }
+	if e.cursor.Z < 0 {
+		e.cells = append([][][]sim.CELL_TYPE{emptyRow()}, e.cells...)
+		e.cursor.Z = 0
+	}
+	if e.cursor.Z >= len(e.cells) {
+		e.cells = append(e.cells, emptyRow())
+	}
+	if e.cursor.X < 0 {
+		for i := range e.cells {
+			e.cells[i] = append([][]sim.CELL_TYPE{nil}, e.cells[i]...)
+		}
+		e.cursor.X = 0
+	}
+	if e.cursor.X >= ncols {
+		for i := range e.cells {
+			e.cells[i] = append(e.cells[i], nil)
+		}
+	}
+}
+
+// moveCursor moves the cursor, allowing it one row or column outside of the grid so that the level can be extended
+func (e *Editor) moveCursor(dz, dx, dy int) {
+	c := sim.GridLoc{e.cursor.Z + dz, e.cursor.X + dx, e.cursor.Y + dy}
+	if c.Z < -1 || c.Z > len(e.cells) || c.X < -1 || c.X > len(e.cells[0]) || c.Y < 0 || c.Y >= EDITOR_MAX_FLOORS {
+		return
+	}
+	e.cursor = c
+	e.updateCursor()
+}
+
+// place places a cell of the provided type at the cursor
+// Boxes and start positions placed on pads (and vice versa) stay on the pad, e.g. becoming sim.BOX_ON_PAD and sim.START_ON_PAD
+func (e *Editor) place(c sim.CELL_TYPE) {
+
+	old := e.get(e.cursor)
+	if old == sim.ELEVATOR_SHAFT {
+		e.setStatus("Can't place inside an elevator shaft - lower the elevator first (-)")
+		return
+	}
+	if old.IsTile() && !c.IsTile() && e.onConveyor(e.cursor) {
+		e.setStatus("Can't replace the arrow of a conveyor belt - press T to turn it")
+		return
+	}
+	oldType, oldOnPad, oldBox := old.Box()
+	newType, _, newBox := c.Box()
+	switch {
+	case newBox && (old == sim.PAD || old == sim.START_ON_PAD || oldOnPad):
+		c = sim.BoxCell(newType, true)
+	case c == sim.PAD && oldBox:
+		c = sim.BoxCell(oldType, true)
+	case c == sim.START && (old == sim.PAD || old == sim.START_ON_PAD || oldOnPad), c == sim.PAD && (old == sim.START || old == sim.START_ON_PAD):
+		c = sim.START_ON_PAD
+	case c == sim.ELEVATOR:
+		above := e.cursor
+		above.Y++
+		if above.Y >= EDITOR_MAX_FLOORS || (e.get(above) != sim.NONE && e.get(above) != sim.ELEVATOR_SHAFT) {
+			e.setStatus("An elevator needs an empty cell above it")
+			return
+		}
+	case c == sim.CONVEYOR:
+		if old == sim.CONVEYOR {
+			return
+		}
+		above := e.cursor
+		above.Y++
+		if above.Y >= EDITOR_MAX_FLOORS || (e.get(above) != sim.NONE && !e.get(above).IsTile()) {
+			e.setStatus("A conveyor belt needs an empty cell above it")
+			return
+		}
+	}
+
+	// There can only be one start position
+	if c == sim.START || c == sim.START_ON_PAD {
+		e.forEachCell(func(loc sim.GridLoc, cell sim.CELL_TYPE) {
+			if cell == sim.START {
+				e.set(loc, sim.NONE)
+			} else if cell == sim.START_ON_PAD {
+				e.set(loc, sim.PAD)
+			}
+		})
+	}
+
+	e.grow()
+	e.clear(e.cursor)
+	e.set(e.cursor, c)
+	if c == sim.ELEVATOR {
+		e.set(sim.GridLoc{e.cursor.Z, e.cursor.X, e.cursor.Y + 1}, sim.ELEVATOR_SHAFT)
+	}
+	if above := (sim.GridLoc{e.cursor.Z, e.cursor.X, e.cursor.Y + 1}); c == sim.CONVEYOR && !e.get(above).IsTile() {
+		e.set(above, sim.TILE_RIGHT)
+	}
+	e.changed()
+}
+
+// placeTile places an arrow at the cursor, making a one-way tile or setting the direction of the conveyor belt below it
+// Placing one on top of another turns it clockwise (as seen in the level file), so that every direction can be chosen
+func (e *Editor) placeTile() {
+	const order = "^>v<"
+	c := sim.CELL_TYPE(order[:1])
+	if i := strings.Index(order, string(e.get(e.cursor))); i >= 0 {
+		c = sim.CELL_TYPE(order[(i+1)%len(order)])
+	}
+	e.place(c)
+}
+
+// onConveyor returns whether there is a conveyor belt right below the provided location
+func (e *Editor) onConveyor(loc sim.GridLoc) bool {
+	return loc.Y > 0 && e.get(sim.GridLoc{loc.Z, loc.X, loc.Y - 1}) == sim.CONVEYOR
+}
+
+// placeBox places a box at the cursor
+// Placing one on top of another changes it to the next type of box (normal, heavy, fragile and glued)
+func (e *Editor) placeBox() {
+	t, _, ok := e.get(e.cursor).Box()
+	if ok {
+		t = (t + 1) % sim.BoxType(sim.BoxTypes)
+	}
+	e.place(sim.BoxCell(t, false))
+}
+
+// placeTeleporter places an end of the first teleporter pair that doesn't have both of its ends yet at the cursor
+func (e *Editor) placeTeleporter() {
+	if e.get(e.cursor).IsTeleporter() {
+		return
+	}
+	c := e.freeTeleporter()
+	if c == sim.NONE {
+		e.setStatus(fmt.Sprintf("There can be no more than %d teleporter pairs", len(sim.TELEPORTERS)))
+		return
+	}
+	e.place(c)
+}
+
+// placeLinked places a pressure plate or a gate, one of the provided cell types, at the cursor
+// Placing one on top of another of the same kind changes its link to the next one, so that every link can be chosen
+func (e *Editor) placeLinked(kinds string) {
+	c := sim.CELL_TYPE(kinds[:1])
+	if i := strings.Index(kinds, string(e.get(e.cursor))); i >= 0 {
+		c = sim.CELL_TYPE(kinds[(i+1)%len(kinds)])
+	}
+	e.place(c)
+}
+
+// freeTeleporter returns the first teleporter pair that doesn't have both of its ends yet, or sim.NONE if there is none
+func (e *Editor) freeTeleporter() sim.CELL_TYPE {
+	ends := make(map[sim.CELL_TYPE]int)
+	e.forEachCell(func(loc sim.GridLoc, cell sim.CELL_TYPE) {
+		ends[cell]++
+	})
+	for _, c := range sim.TELEPORTERS {
+		if ends[sim.CELL_TYPE(c)] < 2 {
+			return sim.CELL_TYPE(c)
+		}
+	}
+	return sim.NONE
+}
+
+// remove removes the cell at the cursor
+func (e *Editor) remove() {
+	if e.get(e.cursor) == sim.ELEVATOR_SHAFT {
+		e.setStatus("Can't remove part of an elevator shaft - lower the elevator instead (-)")
+		return
+	}
+	if e.get(e.cursor).IsTile() && e.onConveyor(e.cursor) {
+		e.setStatus("Can't remove the arrow of a conveyor belt - remove the belt instead")
+		return
+	}
+	if e.get(e.cursor) != sim.NONE {
+		e.clear(e.cursor)
+		e.changed()
+	}
+}
+
+// clear removes the cell at the provided location along with the shaft above it, if it is an elevator
+func (e *Editor) clear(loc sim.GridLoc) {
+	if e.get(loc) == sim.ELEVATOR {
+		for above := (sim.GridLoc{loc.Z, loc.X, loc.Y + 1}); e.get(above) == sim.ELEVATOR_SHAFT; above.Y++ {
+			e.set(above, sim.NONE)
+		}
+	}
+	if above := (sim.GridLoc{loc.Z, loc.X, loc.Y + 1}); e.get(loc) == sim.CONVEYOR && e.get(above).IsTile() {
+		e.set(above, sim.NONE)
+	}
+	if e.get(loc) != sim.NONE {
+		e.set(loc, sim.NONE)
+	}
+}
+
+// changeElevatorHeight raises or lowers the top of the shaft of the elevator in the cursor's column
+func (e *Editor) changeElevatorHeight(delta int) {
+
+	// Find the elevator below (or at) the cursor
+	elev := e.cursor
+	for elev.Y >= 0 && e.get(elev) != sim.ELEVATOR {
+		if c := e.get(elev); c != sim.ELEVATOR_SHAFT && c != sim.NONE && elev != e.cursor {
+			elev.Y = -1
+			break
+		}
+		elev.Y--
+	}
+	if elev.Y < 0 {
+		e.setStatus("There is no elevator below the cursor")
+		return
+	}
+
+	top := elev
+	for e.get(sim.GridLoc{top.Z, top.X, top.Y + 1}) == sim.ELEVATOR_SHAFT {
+		top.Y++
+	}
+	if delta > 0 {
+		above := sim.GridLoc{top.Z, top.X, top.Y + 1}
+		if above.Y >= EDITOR_MAX_FLOORS || e.get(above) != sim.NONE {
+			e.setStatus("The elevator can't go any higher")
+			return
+		}
+		e.set(above, sim.ELEVATOR_SHAFT)
+	} else {
+		if top.Y-elev.Y <= 1 {
+			e.setStatus("An elevator must go up at least one floor")
+			return
+		}
+		e.set(top, sim.NONE)
+	}
+	e.setStatus(fmt.Sprintf("Elevator range: %d floors", top.Y-elev.Y+delta))
+	e.changed()
+}
+
+// forEachCell calls the provided function for every cell that isn't empty
+func (e *Editor) forEachCell(fn func(loc sim.GridLoc, c sim.CELL_TYPE)) {
+	for i, row := range e.cells {
+		for j, column := range row {
+			for k, c := range column {
+				if c != sim.NONE {
+					fn(sim.GridLoc{i, j, k}, c)
+				}
+			}
+		}
+	}
+}
+
+// changed records that the level was modified and redraws it
+func (e *Editor) changed() {
+	e.modified = true
+	e.rebuild()
+}
+
+// Source returns the level in the level file format, leaving out empty rows and columns around it
+func (e *Editor) Source() string {
+
+	cells := e.cells
+	emptyRow := func(i int) bool {
+		for _, column := range cells[i] {
+			if len(column) > 0 {
+				return false
+			}
+		}
+		return true
+	}
+	emptyColumn := func(j int) bool {
+		for _, row := range cells {
+			if len(row[j]) > 0 {
+				return false
+			}
+		}
+		return true
+	}
+	for len(cells) > 1 && emptyRow(0) {
+		cells = cells[1:]
+	}
+	for len(cells) > 1 && emptyRow(len(cells)-1) {
+		cells = cells[:len(cells)-1]
+	}
+	first, last := 0, len(cells[0])-1
+	for first < last && emptyColumn(first) {
+		first++
+	}
+	for last > first && emptyColumn(last) {
+		last--
+	}
+	trimmed := make([][][]sim.CELL_TYPE, len(cells))
+	for i, row := range cells {
+		trimmed[i] = row[first : last+1]
+	}
+	return sim.FormatGrid(trimmed)
+}
+
+// Save writes the level to its file, or to a new file in the player's packs directory if it doesn't have one
+func (e *Editor) Save() {
+
+	source := e.Source()
+	if _, err := sim.ParseLevel(source); err != nil {
+		e.setStatus("Not saved: " + firstLine(err.Error()))
+		return
+	}
+
+	if e.path == "" {
+		dir, err := UserPacksDir()
+		if err != nil {
+			e.setStatus("Not saved: " + err.Error())
+			return
+		}
+		dir = filepath.Join(dir, EDITOR_PACK_DIRNAME)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			e.setStatus("Not saved: " + err.Error())
+			return
+		}
+		for n := 1; ; n++ {
+			p := filepath.Join(dir, fmt.Sprintf("%d%s", n, LEVEL_FILE_EXT))
+			_, err := os.Stat(p)
+			if os.IsNotExist(err) {
+				e.path = p
+				break
+			}
+			if err != nil {
+				e.setStatus("Not saved: " + err.Error())
+				return
+			}
+		}
+		e.name = filepath.Base(e.path)
+	}
+
+	err := ioutil.WriteFile(e.path, []byte(source), 0644)
+	if err != nil {
+		e.setStatus("Not saved: " + err.Error())
+		return
+	}
+	log.Info("Saved level to %v", e.path)
+	e.modified = false
+	e.setStatus("Saved to " + e.path)
+	e.game.ReloadLevelFile(e.path, source)
+}
+
+// TogglePlayTest starts playing the level being edited, or goes back to editing it
+func (e *Editor) TogglePlayTest() {
+
+	g := e.game
+	if e.test != nil {
+		g.UnsubscribeID(window.OnKeyDown, e)
+		g.scene.Remove(e.test.scene)
+		e.test.clearHint()
+		e.test.stopEffects()
+		e.test = nil
+		g.level = g.levels[g.leveln]
+		g.level.gopherNodeRotate.Add(g.gopherNode)
+		g.level.gopherNodeTranslate.Add(g.arrowNode)
+		g.gopherLocked = true
+		e.scene.SetVisible(true)
+		e.setStatus("Editing " + e.name)
+		return
+	}
+
+	source := e.Source()
+	ld, err := sim.ParseLevel(source)
+	if err != nil {
+		e.setStatus("Can't play: " + firstLine(err.Error()))
+		return
+	}
+
+	e.test = NewLevel(g, e.name, source, ld, g.levelStyle)
+	e.test.test = true
+	e.scene.SetVisible(false)
+	g.scene.Add(e.test.scene)
+	g.level = e.test
+	g.RestartLevel(false)
+	g.level.gopherNodeRotate.Add(g.gopherNode)
+	g.level.gopherNodeTranslate.Add(g.arrowNode)
+	g.arrowNode.SetVisible(false)
+	g.SubscribeID(window.OnKeyDown, e, e.test.onKey)
+	e.setStatus("Play-testing " + e.name + " - press P to go back to editing")
+}
+
+// onKey handles the editor's keys, returning whether the key was used
+// While play-testing all keys other than P are left to the game
+func (e *Editor) onKey(kev *window.KeyEvent) bool {
+
+	if kev.Key == window.KeyP {
+		e.TogglePlayTest()
+		return true
+	}
+	if e.test != nil {
+		return false
+	}
+
+	// Move the cursor relative to the camera like the gopher (see Level.onKey)
+	xd := int(e.game.stepDelta.X)
+	zd := int(e.game.stepDelta.Y)
+
+	switch kev.Key {
+	case window.KeyW, window.KeyUp:
+		e.moveCursor(zd, xd, 0)
+	case window.KeyS, window.KeyDown:
+		if kev.Mods&window.ModControl != 0 {
+			e.Save()
+		} else {
+			e.moveCursor(-zd, -xd, 0)
+		}
+	case window.KeyA, window.KeyLeft:
+		e.moveCursor(-xd, zd, 0)
+	case window.KeyD, window.KeyRight:
+		e.moveCursor(xd, -zd, 0)
+	case window.KeyE, window.KeyPageUp:
+		e.moveCursor(0, 0, 1)
+	case window.KeyQ, window.KeyPageDown:
+		e.moveCursor(0, 0, -1)
+	case window.Key1:
+		e.place(sim.BLOCK)
+	case window.Key2:
+		e.placeBox()
+	case window.Key3:
+		e.place(sim.PAD)
+	case window.Key4:
+		e.place(sim.START)
+	case window.Key5:
+		e.place(sim.ELEVATOR)
+	case window.Key6:
+		e.placeTeleporter()
+	case window.Key7:
+		e.place(sim.ICE)
+	case window.Key8:
+		e.placeLinked(sim.PLATES)
+	case window.Key9:
+		e.placeLinked(sim.GATES)
+	case window.Key0:
+		e.place(sim.CONVEYOR)
+	case window.KeyT:
+		e.placeTile()
+	case window.KeyX, window.KeyDelete, window.KeyBackspace:
+		e.remove()
+	case window.KeyEqual, window.KeyKPAdd:
+		e.changeElevatorHeight(1)
+	case window.KeyMinus, window.KeyKPSubtract:
+		e.changeElevatorHeight(-1)
+	case window.KeyN:
+		if kev.Mods&window.ModControl == 0 {
+			break
+		}
+		e.newLevel()
+		e.name = "new level"
+		e.path = ""
+		e.setStatus("Started a new level")
+		e.changed()
+	case window.KeyF, window.KeyEscape:
+		return false
+	}
+	return true
+}
+
+// rebuild recreates the meshes of all cells and centers the level
+func (e *Editor) rebuild() {
+
+	ls := e.game.levelStyle
+	e.cellsNode.RemoveAll(true)
+
+	addMesh := func(mesh *graphic.Mesh, loc sim.GridLoc) *graphic.Mesh {
+		mesh.SetPositionVec(gridVec3(loc))
+		e.cellsNode.Add(mesh)
+		return mesh
+	}
+	addPad := func(loc sim.GridLoc) {
+		mesh := addMesh(graphic.NewMesh(e.padGeom, ls.padMaterial), loc)
+		mesh.SetPositionY(float32(loc.Y) - 0.49)
+		mesh.SetRotationX(-math32.Pi / 2)
+	}
+
+	nfloors := 1
+	e.forEachCell(func(loc sim.GridLoc, c sim.CELL_TYPE) {
+		if loc.Y+1 > nfloors {
+			nfloors = loc.Y + 1
+		}
+		if t, onPad, ok := c.Box(); ok {
+			addMesh(ls.makeBox(t, onPad), loc)
+			if onPad {
+				addPad(loc)
+			}
+			return
+		}
+		switch c {
+		case sim.BLOCK:
+			addMesh(ls.makeBlock(), loc)
+		case sim.ICE:
+			addMesh(ls.makeIce(), loc)
+		case sim.CONVEYOR:
+			addMesh(ls.makeConveyor(), loc)
+		case sim.PAD:
+			addPad(loc)
+		case sim.START:
+			addMesh(graphic.NewMesh(e.startGeom, e.startMaterial), loc)
+		case sim.START_ON_PAD:
+			addMesh(graphic.NewMesh(e.startGeom, e.startMaterial), loc)
+			addPad(loc)
+		case sim.ELEVATOR:
+			addMesh(ls.makeElevator(), loc)
+		case sim.ELEVATOR_SHAFT:
+			addMesh(graphic.NewMesh(e.shaftGeom, e.shaftMaterial), loc)
+		default:
+			switch {
+			case c.IsTeleporter():
+				pair := strings.Index(sim.TELEPORTERS, string(c))
+				mesh := ls.makeTeleporter(pair)
+				NewTeleporter(loc, pair).SetMesh(mesh)
+				e.cellsNode.Add(mesh)
+			case c.IsPlate():
+				mesh := ls.makePlate(strings.Index(sim.PLATES, string(c)))
+				NewPlate(loc).SetMesh(mesh)
+				e.cellsNode.Add(mesh)
+			case c.IsGate():
+				gate := NewGate(loc, -1)
+				gate.SetMesh(ls.makeGate(strings.Index(sim.GATES, string(c))))
+				e.cellsNode.Add(gate)
+			case c.IsTile():
+				d, _ := c.TileDir()
+				mesh := ls.makeTile(e.onConveyor(loc))
+				NewTile(loc, d).SetMesh(mesh)
+				e.cellsNode.Add(mesh)
+			}
+		}
+	})
+
+	// Center the level and light it from above like Level does
+	cx := float32(len(e.cells[0]))/2 - 0.5
+	cy := float32(nfloors)/2 - 0.5
+	cz := float32(len(e.cells))/2 - 0.5
+	e.scene.SetPosition(-cx, -cy, -cz)
+	e.light.SetPosition(cx, cy*2+2, cz)
+	e.updateCursor()
+}
+
+// updateCursor moves the cursor mesh to the cursor and describes the cell under it
+func (e *Editor) updateCursor() {
+	e.cursorMesh.SetPositionVec(gridVec3(e.cursor))
+	e.game.ui.UpdateEditorLabel()
+}
+
+// setStatus shows the provided message in the editor's label
+func (e *Editor) setStatus(msg string) {
+	e.status = msg
+	e.game.ui.UpdateEditorLabel()
+}
+
+// firstLine returns the first line of the provided text
+func firstLine(s string) string {
+	return strings.SplitN(s, "\n", 2)[0]
+}
+
+// editing returns whether the level editor is open and not play-testing
+func (g *Gokoban) editing() bool {
+	return g.editor != nil && g.editor.test == nil
+}
+
+// StartEditor opens the level editor on the current level
+// Levels that can't be saved back to their file (e.g. because they are in a zip archive, or come with the game
+// and were extracted into the cache) are saved as new levels
+func (g *Gokoban) StartEditor() {
+	log.Debug("Start Editor")
+
+	g.StopReplay()
+	g.level.SaveRecord()
+	g.level.clearHint()
+
+	var dest string
+	file := g.pack.Files[g.leveln].Name
+	if info, err := os.Stat(g.pack.Path); err == nil && info.IsDir() && !isExtractedAsset(g.pack.Path) && strings.EqualFold(filepath.Ext(file), LEVEL_FILE_EXT) {
+		dest = filepath.Join(g.pack.Path, filepath.FromSlash(file))
+	}
+
+	g.editor = NewEditor(g, g.level.name, dest, g.level.source)
+	g.UnsubscribeID(window.OnKeyDown, g.leveln)
+	g.levelScene.SetVisible(false)
+	g.scene.Add(g.editor.scene)
+	g.gopherLocked = true
+	g.arrowNode.SetVisible(false)
+	g.ui.levelLabelText.SetText("Level Editor")
+	g.ui.UpdateEditorButton()
+	g.ui.UpdateEditorLabel()
+	if g.ui.inMenu {
+		g.ui.ToggleMenu()
+	}
+}
+
+// StopEditor closes the level editor and goes back to the level that was being played
+func (g *Gokoban) StopEditor() {
+	g.InitLevel(g.leveln)
+}
+
+// closeEditor removes the level editor (if open) without initializing a level
+func (g *Gokoban) closeEditor() {
+	if g.editor == nil {
+		return
+	}
+	log.Debug("Close Editor")
+
+	if g.editor.test != nil {
+		g.editor.TogglePlayTest()
+	}
+	if g.editor.modified {
+		log.Info("Closing the level editor without saving changes to %v", g.editor.name)
+	}
+	g.scene.Remove(g.editor.scene)
+	g.editor = nil
+	g.levelScene.SetVisible(true)
+	g.ui.UpdateEditorButton()
+	g.ui.UpdateEditorLabel()
+}
+
+// ReloadLevelFile updates the loaded level pack (if any) containing the level file at the provided path with its new source
+// If the file isn't in a loaded pack, it will be loaded with the player's packs the next time the game starts
+func (g *Gokoban) ReloadLevelFile(p, source string) {
+
+	ld, err := sim.ParseLevel(source)
+	if err != nil {
+		return
+	}
+	for _, pack := range g.packs {
+		for i, f := range pack.Files {
+			if filepath.Join(pack.Path, filepath.FromSlash(f.Name)) != filepath.Clean(p) {
+				continue
+			}
+			pack.Files[i].Source = source
+			pack.data[i] = ld
+			if pack.levels != nil {
+				level := NewLevel(g, path.Base(f.Name), source, ld, g.levelStyle)
+				if pack == g.pack && i == g.leveln && g.editor.test == nil {
+					// Switch to the new level right away, so that it is played when the editor is closed
+					g.levelScene.Remove(g.level.scene)
+					g.level = level
+					g.levelScene.Add(level.scene)
+					level.gopherNodeRotate.Add(g.gopherNode)
+					level.gopherNodeTranslate.Add(g.arrowNode)
+				}
+				pack.levels[i] = level
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package generator builds new Gokoban levels by playing backwards from a solved position using the rules in package sim.
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/danaugrs/gokoban/sim"
+	"github.com/danaugrs/gokoban/solver"
+)
+
+// DIFFICULTIES are the difficulties levels can be generated for, from easiest to hardest
+var DIFFICULTIES = []string{"easy", "medium", "hard"}
+
+// MAX_FLOORS is the maximum number of floors of a generated level
+const MAX_FLOORS int = 3
+
+// DEFAULT_MAX_STATES is the default maximum number of states the solver visits for each level tried
+const DEFAULT_MAX_STATES int = 200000
+
+// ATTEMPTS is the number of rooms generated to find a level of the requested difficulty
+const ATTEMPTS int = 10
+
+// SAMPLES is the number of positions along the backward play of a room that are tried as the start of the level
+const SAMPLES int = 5
+
+// ErrNoLevel is returned when no level could be generated with the provided options
+var ErrNoLevel = errors.New("generator: no level could be generated with these options")
+
+// Options describes the levels to generate
+type Options struct {
+	Difficulty string // one of DIFFICULTIES
+	Floors     int    // number of floors the gopher can walk on
+	Boxes      int
+	Elevators  bool // whether floors are connected by elevators - without them the gopher and boxes can only go down
+	MaxStates  int  // maximum number of states the solver visits to find a shortest solution
+	Rand       *rand.Rand
+}
+
+// Level is a generated level
+type Level struct {
+	Source     string // the level in the level file format
+	Data       *sim.LevelData
+	Solution   []sim.Dir // the shortest solution if the solver found one, otherwise the steps played backwards
+	Shortest   bool      // whether Solution is a shortest solution
+	Pushes     int       // number of steps in Solution that push a box
+	Score      int       // estimated difficulty (see estimate)
+	Difficulty string    // the difficulty the score corresponds to
+}
+
+// profile contains the settings used to generate levels of a difficulty
+type profile struct {
+	size     int // number of rows and columns inside the outer walls
+	walls    int // number of walls inside the room
+	steps    int // number of steps played backwards
+	maxScore int // highest score of the difficulty
+}
+
+var profiles = map[string]profile{
+	"easy":   {5, 2, 100, 16},
+	"medium": {6, 5, 250, 40},
+	"hard":   {7, 8, 500, 1 << 30},
+}
+
+// Generate returns a new level with the provided options
+// Every level is solvable, since it is built by playing backwards from the solved position under the rules of package sim
+func Generate(opts Options) (*Level, error) {
+
+	p, ok := profiles[opts.Difficulty]
+	if !ok {
+		return nil, fmt.Errorf("generator: unknown difficulty %q", opts.Difficulty)
+	}
+	if opts.Floors < 1 || opts.Floors > MAX_FLOORS {
+		return nil, fmt.Errorf("generator: levels must have between 1 and %d floors", MAX_FLOORS)
+	}
+	if opts.Boxes < 1 || opts.Boxes > p.size*p.size/4 {
+		return nil, fmt.Errorf("generator: %v levels must have between 1 and %d boxes", opts.Difficulty, p.size*p.size/4)
+	}
+
+	var best *Level
+	for i := 0; i < ATTEMPTS; i++ {
+		l, err := generate(p, opts)
+		if err != nil {
+			return nil, err
+		}
+		if l != nil && closer(l, best, opts.Difficulty) {
+			best = l
+		}
+		if best != nil && best.Difficulty == opts.Difficulty {
+			break
+		}
+	}
+	if best == nil {
+		return nil, ErrNoLevel
+	}
+	return best, nil
+}
+
+// generate builds a room and plays it backwards from a solved position,
+// returning the level closest to the requested difficulty or nil if none came out of it
+func generate(p profile, opts Options) (*Level, error) {
+
+	rnd := opts.Rand
+	l := newLayout(p, opts.Floors, opts.Elevators, rnd)
+	floor := l.floorCells()
+	if len(floor) < opts.Boxes+1 {
+		return nil, nil
+	}
+
+	// Start with every box on a pad and the gopher somewhere else
+	rnd.Shuffle(len(floor), func(i, j int) { floor[i], floor[j] = floor[j], floor[i] })
+	pads := floor[:opts.Boxes]
+	ld, err := sim.ParseLevel(sim.FormatGrid(l.cells(floor[opts.Boxes], pads, pads)))
+	if err != nil {
+		return nil, fmt.Errorf("generator: invalid layout: %v", err)
+	}
+
+	var best *Level
+	w := &walker{ld: ld, top: opts.Floors, rnd: rnd}
+	for _, st := range w.walk(w.initial(), p.steps, SAMPLES) {
+		level, err := newLevel(l, pads, st, opts.MaxStates)
+		if err != nil {
+			return nil, err
+		}
+		if closer(level, best, opts.Difficulty) {
+			best = level
+		}
+	}
+	return best, nil
+}
+
+// newLevel returns the level of the provided layout that starts at the provided position, with its solution and difficulty
+func newLevel(l *layout, pads []sim.GridLoc, st start, maxStates int) (*Level, error) {
+
+	// The grid the backward play used has one cell of padding
+	unpad := func(loc sim.GridLoc) sim.GridLoc { return sim.GridLoc{Z: loc.Z - 1, X: loc.X - 1, Y: loc.Y} }
+	boxes := make([]sim.GridLoc, len(st.boxes))
+	for i, b := range st.boxes {
+		boxes[i] = unpad(b)
+	}
+	source := sim.FormatGrid(l.cells(unpad(st.gopher), boxes, pads))
+	level := &Level{Source: source}
+	var err error
+	level.Data, err = sim.ParseLevel(source)
+	if err != nil {
+		return nil, fmt.Errorf("generator: invalid level: %v\n%v", err, source)
+	}
+
+	// The steps played backwards solve the level, but the solver may find a shorter solution
+	s := sim.NewState(level.Data)
+	for _, d := range st.path {
+		s.StepDir(d)
+	}
+	if !s.Complete() {
+		return nil, fmt.Errorf("generator: backward play doesn't solve the level:\n%v", source)
+	}
+	level.Solution = st.path
+	res, err := solver.Solve(level.Data, maxStates)
+	if err == nil && res.Solvable {
+		level.Solution = res.Moves
+		level.Shortest = true
+	}
+	level.Pushes = solver.CountPushes(sim.NewState(level.Data), level.Solution)
+	level.Score = estimate(len(level.Solution), level.Pushes)
+	for _, d := range DIFFICULTIES {
+		level.Difficulty = d
+		if level.Score <= profiles[d].maxScore {
+			break
+		}
+	}
+	return level, nil
+}
+
+// closer returns whether the difficulty of level a is closer to the provided one than that of level b (which may be nil)
+// Between levels of the same difficulty the one with the highest score wins
+func closer(a, b *Level, difficulty string) bool {
+	if b == nil {
+		return true
+	}
+	index := func(d string) int {
+		for i, name := range DIFFICULTIES {
+			if name == d {
+				return i
+			}
+		}
+		return -1
+	}
+	target := index(difficulty)
+	da, db := abs(index(a.Difficulty)-target), abs(index(b.Difficulty)-target)
+	if da != db {
+		return da < db
+	}
+	return a.Score > b.Score
+}
+
+// estimate returns the difficulty score of a solution
+// Pushes count the most since they are what the player has to figure out
+func estimate(moves, pushes int) int {
+	return 2*pushes + moves/2
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
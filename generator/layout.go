@@ -0,0 +1,169 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package generator
+
+import (
+	"math/rand"
+
+	"github.com/danaugrs/gokoban/sim"
+)
+
+// layout is the part of a level that doesn't move: a walled room whose rows are split into bands of increasing height,
+// one for each floor, optionally connected by elevators
+// Locations in a layout are in level file coordinates, without the padding added by sim.ParseLevel
+type layout struct {
+	rows, cols int
+	height     [][]int // number of blocks in each column, which is also the floor the gopher walks on above it
+	wall       [][]bool
+	elevators  map[[2]int]sim.ElevatorData
+}
+
+// newLayout returns a new random layout
+func newLayout(p profile, floors int, elevators bool, rnd *rand.Rand) *layout {
+
+	l := new(layout)
+	l.rows, l.cols = p.size+2, p.size+2
+	l.height = make([][]int, l.rows)
+	l.wall = make([][]bool, l.rows)
+	l.elevators = make(map[[2]int]sim.ElevatorData)
+	for i := range l.height {
+		l.height[i] = make([]int, l.cols)
+		l.wall[i] = make([]bool, l.cols)
+		for j := range l.height[i] {
+			l.wall[i][j] = i == 0 || j == 0 || i == l.rows-1 || j == l.cols-1
+			l.height[i][j] = 1 + (i-1)*floors/p.size
+		}
+	}
+
+	// Walls are one block higher than the top floor
+	for i := range l.height {
+		for j := range l.height[i] {
+			if l.wall[i][j] {
+				l.height[i][j] = floors + 1
+			}
+		}
+	}
+
+	// Add walls inside the room as long as all of its floor stays connected
+	for n, tries := 0, 0; n < p.walls && tries < 100; tries++ {
+		i, j := 1+rnd.Intn(p.size), 1+rnd.Intn(p.size)
+		if l.wall[i][j] {
+			continue
+		}
+		l.wall[i][j] = true
+		if !l.connected() {
+			l.wall[i][j] = false
+			continue
+		}
+		l.height[i][j] = floors + 1
+		n++
+	}
+
+	// Connect each floor to the one above it with an elevator in place of its top block
+	if elevators {
+		for f := 1; f < floors; f++ {
+			var candidates [][2]int
+			for i := 1; i < l.rows-1; i++ {
+				for j := 1; j < l.cols-1; j++ {
+					if !l.wall[i][j] && l.height[i][j] == f && !l.wall[i+1][j] && l.height[i+1][j] == f+1 {
+						candidates = append(candidates, [2]int{i, j})
+					}
+				}
+			}
+			if len(candidates) > 0 {
+				c := candidates[rnd.Intn(len(candidates))]
+				l.elevators[c] = sim.ElevatorData{Loc: sim.GridLoc{Z: c[0], X: c[1], Y: f - 1}, Low: f - 1, High: f}
+			}
+		}
+	}
+
+	return l
+}
+
+// connected returns whether every cell of the room that isn't a wall can be reached from every other one
+func (l *layout) connected() bool {
+
+	var start [2]int
+	total := 0
+	for i := range l.wall {
+		for j := range l.wall[i] {
+			if !l.wall[i][j] {
+				start = [2]int{i, j}
+				total++
+			}
+		}
+	}
+
+	seen := map[[2]int]bool{start: true}
+	queue := [][2]int{start}
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+		for _, d := range sim.Dirs {
+			n := [2]int{c[0] + d.Z, c[1] + d.X}
+			if !l.wall[n[0]][n[1]] && !seen[n] {
+				seen[n] = true
+				queue = append(queue, n)
+			}
+		}
+	}
+	return len(seen) == total
+}
+
+// floorCells returns the locations where boxes, pads and the gopher can be placed
+func (l *layout) floorCells() []sim.GridLoc {
+	var cells []sim.GridLoc
+	for i := range l.wall {
+		for j := range l.wall[i] {
+			if _, ok := l.elevators[[2]int{i, j}]; !ok && !l.wall[i][j] {
+				cells = append(cells, sim.GridLoc{Z: i, X: j, Y: l.height[i][j]})
+			}
+		}
+	}
+	return cells
+}
+
+// cells returns the cells of the level file with the gopher, boxes and pads at the provided locations
+func (l *layout) cells(gopher sim.GridLoc, boxes, pads []sim.GridLoc) [][][]sim.CELL_TYPE {
+
+	cells := make([][][]sim.CELL_TYPE, l.rows)
+	for i := range cells {
+		cells[i] = make([][]sim.CELL_TYPE, l.cols)
+		for j := range cells[i] {
+			for k := 0; k < l.height[i][j]; k++ {
+				cells[i][j] = append(cells[i][j], sim.BLOCK)
+			}
+			if e, ok := l.elevators[[2]int{i, j}]; ok {
+				cells[i][j][e.Low] = sim.ELEVATOR
+				for k := e.Low + 1; k <= e.High; k++ {
+					cells[i][j] = append(cells[i][j], sim.ELEVATOR_SHAFT)
+				}
+			}
+		}
+	}
+
+	put := func(loc sim.GridLoc, c sim.CELL_TYPE) {
+		column := cells[loc.Z][loc.X]
+		for len(column) <= loc.Y {
+			column = append(column, sim.NONE)
+		}
+		switch {
+		case column[loc.Y] == sim.PAD && c == sim.BOX:
+			c = sim.BOX_ON_PAD
+		case column[loc.Y] == sim.PAD && c == sim.START:
+			c = sim.START_ON_PAD
+		}
+		column[loc.Y] = c
+		cells[loc.Z][loc.X] = column
+	}
+	for _, p := range pads {
+		put(p, sim.PAD)
+	}
+	for _, b := range boxes {
+		put(b, sim.BOX)
+	}
+	put(gopher, sim.START)
+	return cells
+}
@@ -0,0 +1,220 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package generator
+
+import (
+	"math/rand"
+
+	"github.com/danaugrs/gokoban/sim"
+)
+
+// PULL_CHANCE is the chance of preferring a step that pulls a box while playing backwards, when there is one
+const PULL_CHANCE float64 = 0.8
+
+// position is the location of every object of a level
+type position struct {
+	gopher    sim.GridLoc
+	boxes     []sim.GridLoc
+	elevators []sim.GridLoc
+}
+
+// walker plays a level backwards
+// Instead of implementing the rules in reverse, it guesses where the objects were before each step
+// and only keeps the guesses from which the step, played forwards by package sim, leads to the current position
+type walker struct {
+	ld  *sim.LevelData // the level in its solved position, with every box on a pad
+	top int            // highest floor objects can be on, so that nothing ends up on top of the walls
+	rnd *rand.Rand
+}
+
+// start is a position the level can start from, with the steps that lead from it to the solved position
+type start struct {
+	position
+	path []sim.Dir
+}
+
+// initial returns the position the level was parsed with
+func (w *walker) initial() position {
+	p := position{gopher: w.ld.GopherInit, boxes: w.ld.BoxesInit}
+	for _, e := range w.ld.Elevators {
+		p.elevators = append(p.elevators, e.Loc)
+	}
+	return p
+}
+
+// state returns a new state with the objects at the provided position
+func (w *walker) state(p position) *sim.State {
+	ld := *w.ld
+	ld.GopherInit = p.gopher
+	ld.BoxesInit = p.boxes
+	ld.Elevators = make([]sim.ElevatorData, len(w.ld.Elevators))
+	for i, e := range w.ld.Elevators {
+		e.Loc = p.elevators[i]
+		ld.Elevators[i] = e
+	}
+	return sim.NewState(&ld)
+}
+
+// valid returns whether every object is inside the level, in a cell that isn't a block or taken by another object,
+// and rests on something (objects only float while they are falling)
+func (w *walker) valid(p position, s *sim.State) bool {
+
+	taken := make(map[sim.GridLoc]bool)
+	locs := append(append([]sim.GridLoc{p.gopher}, p.boxes...), p.elevators...)
+	for _, loc := range locs {
+		if !w.ld.InBounds(loc) || loc.Y > w.top || w.ld.Get(loc) == sim.BLOCK || taken[loc] {
+			return false
+		}
+		taken[loc] = true
+	}
+
+	for _, loc := range locs[:1+len(p.boxes)] {
+		if s.Get(sim.GridLoc{Z: loc.Z, X: loc.X, Y: loc.Y - 1}).IsNone() {
+			return false
+		}
+	}
+
+	// Elevators only stay up while they carry something
+	for i, loc := range p.elevators {
+		if loc.Y > w.ld.Elevators[i].Low && !s.Get(sim.GridLoc{Z: loc.Z, X: loc.X, Y: loc.Y + 1}).IsPushable() {
+			return false
+		}
+	}
+	return true
+}
+
+// startable returns whether the level file can start with the objects at the provided position and isn't already solved
+// Elevators start at the bottom of their shafts, and nothing can start inside a shaft
+func (w *walker) startable(p position) bool {
+	for i, loc := range p.elevators {
+		if loc.Y != w.ld.Elevators[i].Low {
+			return false
+		}
+	}
+	solved := true
+	for _, loc := range append([]sim.GridLoc{p.gopher}, p.boxes...) {
+		if w.ld.Get(loc) == sim.ELEVATOR_SHAFT || w.ld.Get(loc) == sim.ELEVATOR {
+			return false
+		}
+		if loc != p.gopher && !w.ld.IsPad(loc) {
+			solved = false
+		}
+	}
+	return !solved
+}
+
+// predecessor is a position from which a step leads to the current position
+type predecessor struct {
+	position
+	dir  sim.Dir // direction of the step
+	pull bool    // whether the step pushes a box, i.e. the box is pulled when playing backwards
+}
+
+// predecessors returns the positions from which a single step leads to the provided position
+// The step moves the gopher one cell horizontally, possibly pushing a box one cell further,
+// and gravity or an elevator may have changed the floor of the gopher, the box, and one elevator
+func (w *walker) predecessors(cur position) []predecessor {
+
+	_, _, nfloors := w.ld.Size()
+	key := w.state(cur).Key()
+	g := cur.gopher
+
+	var preds []predecessor
+	for _, d := range sim.Dirs {
+
+		// The box pushed ahead of the gopher is in the column the gopher stepped into
+		boxOpts := [][]sim.GridLoc{cur.boxes}
+		for i, b := range cur.boxes {
+			if b.Z != g.Z+d.Z || b.X != g.X+d.X {
+				continue
+			}
+			for y := 0; y < nfloors; y++ {
+				boxes := append([]sim.GridLoc(nil), cur.boxes...)
+				boxes[i] = sim.GridLoc{Z: g.Z, X: g.X, Y: y}
+				boxOpts = append(boxOpts, boxes)
+			}
+		}
+
+		elevOpts := [][]sim.GridLoc{cur.elevators}
+		for i, e := range w.ld.Elevators {
+			for y := e.Low; y <= e.High; y++ {
+				if y != cur.elevators[i].Y {
+					elevs := append([]sim.GridLoc(nil), cur.elevators...)
+					elevs[i].Y = y
+					elevOpts = append(elevOpts, elevs)
+				}
+			}
+		}
+
+		for y := 0; y < nfloors; y++ {
+			for bi, boxes := range boxOpts {
+				for _, elevs := range elevOpts {
+					p := position{sim.GridLoc{Z: g.Z - d.Z, X: g.X - d.X, Y: y}, boxes, elevs}
+					s := w.state(p)
+					if !w.valid(p, s) {
+						continue
+					}
+					s.StepDir(d)
+					if s.Failed() || s.Key() != key {
+						continue
+					}
+					preds = append(preds, predecessor{p, d, bi > 0})
+				}
+			}
+		}
+	}
+	return preds
+}
+
+// walk plays backwards from the provided position for up to the provided number of steps, and returns up to n positions
+// along the way that the level can start from, spread out and ending with the farthest one
+func (w *walker) walk(from position, steps, n int) []start {
+
+	visited := map[string]bool{w.state(from).Key(): true}
+	cur := from
+	var dirs []sim.Dir // dirs[i] leads from the position reached after i+1 steps backwards to the one before it
+	var starts []start
+
+	for i := 0; i < steps; i++ {
+
+		var all, pulls []predecessor
+		for _, p := range w.predecessors(cur) {
+			if !visited[w.state(p.position).Key()] {
+				all = append(all, p)
+				if p.pull {
+					pulls = append(pulls, p)
+				}
+			}
+		}
+		if len(all) == 0 {
+			break
+		}
+		choices := all
+		if len(pulls) > 0 && w.rnd.Float64() < PULL_CHANCE {
+			choices = pulls
+		}
+		next := choices[w.rnd.Intn(len(choices))]
+		visited[w.state(next.position).Key()] = true
+		cur = next.position
+		dirs = append(dirs, next.dir)
+
+		if w.startable(cur) {
+			path := make([]sim.Dir, len(dirs))
+			for i := range path {
+				path[i] = dirs[len(dirs)-1-i]
+			}
+			starts = append(starts, start{cur, path})
+		}
+	}
+
+	if len(starts) <= n {
+		return starts
+	}
+	spread := make([]start, n)
+	for i := range spread {
+		spread[i] = starts[(i+1)*len(starts)/n-1]
+	}
+	return spread
+}
@@ -0,0 +1,158 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/danaugrs/gokoban/sim"
+	"github.com/danaugrs/gokoban/solver"
+	"github.com/g3n/engine/math32"
+
+	"fmt"
+)
+
+// HINTS_PER_LEVEL is the number of hints the player can get in each level
+const HINTS_PER_LEVEL int = 3
+
+// HINT_MAX_STATES is the maximum number of states the solver visits to find a hint
+const HINT_MAX_STATES int = 500000
+
+var arrowColor = math32.Color{0.628, 0.882, 0.1}
+var hintArrowColor = math32.Color{1, 0.55, 0.1}
+
+// Arrows on top of the gopher, named after the key that steps in their direction
+const (
+	ARROW_UP = iota
+	ARROW_DOWN
+	ARROW_LEFT
+	ARROW_RIGHT
+)
+
+// hintSearch is a search for the next best step running in the background
+// Each level runs at most one at a time, and it is canceled once its answer isn't needed anymore
+type hintSearch struct {
+	key    string // key of the state the search started from
+	done   chan hintResult
+	cancel chan struct{}
+}
+
+// hintResult is the outcome of a hint search
+type hintResult struct {
+	res *solver.Result
+	err error
+}
+
+// Hint starts looking for the next best step from the current state of the level
+// The answer is shown by Update once the search is done, as long as the gopher hasn't moved in the meantime
+func (g *Gokoban) Hint() {
+
+	l := g.level
+	if l == nil || g.ui.inMenu || g.gopherLocked || l.hintSearch != nil || l.state.Complete() {
+		return
+	}
+	if l.hints >= HINTS_PER_LEVEL {
+		l.setHintStatus("No hints left for this level")
+		return
+	}
+
+	log.Debug("Hint")
+	search := &hintSearch{l.state.Key(), make(chan hintResult, 1), make(chan struct{})}
+	l.hintSearch = search
+	l.setHintStatus("Looking for a hint...")
+	start := l.state.Clone()
+	go func() {
+		res, err := solver.SolveFrom(start, HINT_MAX_STATES, search.cancel)
+		search.done <- hintResult{res, err}
+	}()
+}
+
+// updateHint shows the result of the hint search of the current level when it is done
+func (g *Gokoban) updateHint() {
+
+	l := g.level
+	if l.hintSearch == nil {
+		return
+	}
+	var hr hintResult
+	select {
+	case hr = <-l.hintSearch.done:
+	default:
+		return
+	}
+	key := l.hintSearch.key
+	l.hintSearch = nil
+
+	// The answer is about a state the level isn't in anymore
+	if key != l.state.Key() {
+		l.setHintStatus("")
+		return
+	}
+
+	switch {
+	case hr.err != nil:
+		log.Debug("Hint search gave up after %v states", hr.res.Visited)
+		l.setHintStatus("No hint found - this position is too complex")
+	case !hr.res.Solvable:
+		l.setHintStatus("The level can't be solved from here anymore - undo or restart")
+	default:
+		l.hints++
+		dir := hr.res.Moves[0]
+		l.hint = &dir
+		l.setHintStatus(fmt.Sprintf("Hint: follow the orange arrow (%v left, %v steps to go)", HINTS_PER_LEVEL-l.hints, len(hr.res.Moves)))
+		g.UpdateHintArrow()
+		g.arrowNode.SetVisible(true)
+	}
+}
+
+// cancelHint stops the hint search of the level, if one is running
+func (l *Level) cancelHint() {
+	if l.hintSearch != nil {
+		close(l.hintSearch.cancel)
+		l.hintSearch = nil
+	}
+}
+
+// clearHint removes the hint once the gopher moved, and cancels any hint search
+func (l *Level) clearHint() {
+
+	l.cancelHint()
+	if l.hint != nil {
+		l.hint = nil
+		l.game.UpdateHintArrow()
+		l.game.arrowNode.SetVisible(l.game.leveln == 0 && !l.test)
+	}
+	l.setHintStatus("")
+}
+
+// UpdateHintArrow tints the arrow that points to the direction of the current hint, if any
+// The arrows turn with the camera, so this is called whenever it moves
+func (g *Gokoban) UpdateHintArrow() {
+
+	for _, mat := range g.arrowMaterials {
+		mat.SetColor(&arrowColor)
+	}
+	if g.level == nil || g.level.hint == nil {
+		return
+	}
+
+	// Find the key that steps in the hinted direction (see Level.onKey)
+	xd := int(g.stepDelta.X)
+	zd := int(g.stepDelta.Y)
+	arrow := ARROW_UP
+	switch *g.level.hint {
+	case sim.Dir{Z: -zd, X: -xd}:
+		arrow = ARROW_DOWN
+	case sim.Dir{Z: -xd, X: zd}:
+		arrow = ARROW_LEFT
+	case sim.Dir{Z: xd, X: -zd}:
+		arrow = ARROW_RIGHT
+	}
+	g.arrowMaterials[arrow].SetColor(&hintArrowColor)
+}
+
+// setHintStatus shows a message about hints, or hides the hint label if it is empty
+func (l *Level) setHintStatus(text string) {
+	l.hintStatus = text
+	l.game.ui.UpdateHintLabel()
+}
@@ -5,182 +5,114 @@
 package main
 
 import (
+	"github.com/danaugrs/gokoban/sim"
 	"github.com/g3n/engine/core"
 	"github.com/g3n/engine/light"
 	"github.com/g3n/engine/math32"
 	"github.com/g3n/engine/window"
 
 	"strings"
+	"time"
 )
 
-type CELL_TYPE string
+// INPUT_QUEUE_SIZE is the number of steps that can be asked for while the gopher is still moving
+const INPUT_QUEUE_SIZE int = 2
 
-const (
-	START          CELL_TYPE = "s"
-	BLOCK          CELL_TYPE = "]"
-	BOX            CELL_TYPE = "x"
-	PAD            CELL_TYPE = "o"
-	ELEVATOR       CELL_TYPE = "e"
-	ELEVATOR_SHAFT CELL_TYPE = "-"
-	NONE           CELL_TYPE = "."
-)
-
-type GridCell struct {
-	loc GridLoc
-	obj IMapObj
-}
-
-type GridLoc struct {
-	z, x, y int
-}
+// KEY_REPEAT_DELAY is how long a movement key must be held down before the gopher keeps stepping on its own, in seconds
+const KEY_REPEAT_DELAY float64 = 0.25
 
-func (l *GridLoc) Equals(v math32.Vector3) bool {
-	return l.z == int(v.Z) && l.x == int(v.X) && l.y == int(v.Y)
-}
+// GOPHER_TURN_TIME is how long the gopher takes to turn to the direction of a step, in seconds at the default speed
+const GOPHER_TURN_TIME float32 = 0.1
 
-func (l *GridLoc) Vec3() *math32.Vector3 {
-	return math32.NewVector3(float32(l.x), float32(l.y), float32(l.z))
-}
+// GATE_TIME is how long gates take to open or close, in seconds at the default speed
+const GATE_TIME float32 = 0.3
 
-// LevelData contains all the logical information about a level
-type LevelData struct {
-	grid       [][][]GridCell
-	gopherInit GridLoc
-	boxesInit  []GridLoc
-	pads       []GridLoc
-	center     math32.Vector3
-}
+// SQUASH_TIME is how long objects take to squash and spring back after landing, in seconds at the default speed
+const SQUASH_TIME float32 = 0.3
 
-func (ld *LevelData) Get(loc GridLoc) IMapObj {
-	return ld.grid[loc.z][loc.x][loc.y].obj
-}
+// How much of their height the gopher and boxes lose when squashed by a landing
+const GOPHER_SQUASH float32 = 0.25
+const GOPHER_HURT_SQUASH float32 = 0.4
+const BOX_SQUASH float32 = 0.12
 
-func (ld *LevelData) Set(loc GridLoc, gc IMapObj) {
-	ld.grid[loc.z][loc.x][loc.y].obj = gc
-}
-
-func (ld *LevelData) initLoc(loc GridLoc) {
-	ld.grid[loc.z][loc.x][loc.y].loc = loc
-}
-
-func (ld *LevelData) IsPad(pl GridLoc) bool {
-	for _, a := range ld.pads {
-		if a == pl {
-			return true
-		}
-	}
-	return false
-}
-
-func ParseLevel(data string) (*LevelData, error) {
-
-	ld := new(LevelData)
-
-	// Pad row-wise
-	rows := strings.Split(data, "\n")
-	for i, row := range rows {
-		rows[i] = ". " + row + " ."
-	}
-
-	// Pad column-wise
-	ncols := len(strings.Fields(rows[0]))
-	padding_row := strings.Repeat(". ", ncols)
-	rows = append([]string{padding_row}, rows...)
-	rows = append(rows, padding_row)
-	nrows := len(rows)
-
-	// Calculate max number of floors
-	cells := strings.Fields(data)
-	nfloors := 1
-	for _, c := range cells {
-		if len(c) > nfloors {
-			nfloors = len(c)
-		}
-	}
-	ADD_TO_NFLOORS := 2
-	nfloors += ADD_TO_NFLOORS // necessary
-
-	// Initialize slices
-	ld.grid = make([][][]GridCell, nrows)
-	for i, _ := range ld.grid {
-		ld.grid[i] = make([][]GridCell, ncols)
-		for j, _ := range ld.grid[i] {
-			ld.grid[i][j] = make([]GridCell, nfloors)
-		}
-	}
-
-	// Calculate center of level
-	ld.center.SetZ(float32(nrows)/2 - 0.5)
-	ld.center.SetY(float32(nfloors-ADD_TO_NFLOORS)/2 - 0.5)
-	ld.center.SetX(float32(ncols)/2 - 0.5)
-
-	for i, row := range rows {
-		cells := strings.Fields(row)
-		for j, cell := range cells {
-			for k, c := range cell {
-				loc := GridLoc{i, j, k}
-				ld.initLoc(loc)
-				cc := CELL_TYPE(c)
-				if cc != NONE {
-					switch cc {
-					case START:
-						ld.gopherInit = loc
-						ld.Set(loc, NewGopher(loc))
-					case BLOCK:
-						ld.Set(loc, NewBlock(loc))
-					case BOX:
-						box := NewBox(loc)
-						ld.boxesInit = append(ld.boxesInit, loc)
-						ld.Set(loc, box)
-					case PAD:
-						ld.pads = append(ld.pads, loc)
-						ld.Set(loc, NewPad(loc))
-					case ELEVATOR:
-						// Calculate number of floors
-						var high int
-						for high = k; (high+1) < len(cell) && string(cell[high+1]) == string(ELEVATOR_SHAFT); high++ {
-						}
-						elev := NewElevator(loc, k, high)
-						ld.Set(loc, elev)
-					}
-				}
-			}
-		}
-	}
-
-	return ld, nil
+// gridVec3 returns the position in the scene of the provided grid location
+func gridVec3(loc sim.GridLoc) *math32.Vector3 {
+	return math32.NewVector3(float32(loc.X), float32(loc.Y), float32(loc.Z))
 }
 
 // Level stores all the operational data for a level
+// The rules are handled by a sim.State - the level only turns the resulting events into animations and sounds
 type Level struct {
 	game  *Gokoban
 	scene *core.Node
 
-	data  *LevelData
-	style *LevelStyle
-
-	gopher    *Gopher
-	boxes     []*Box
-	elevators []*Elevator
+	id     string // stable identifier of the level (see sim.LevelID)
+	name   string // name of the level file
+	source string // contents of the level file
+	data   *sim.LevelData
+	state  *sim.State
+	style  *LevelStyle
+
+	gopher      *Gopher
+	boxes       []*Box
+	elevators   []*Elevator
+	teleporters []*Teleporter
+	plates      []*Plate
+	gates       []*Gate
+	tiles       []*Tile
 
 	gopherNodeTranslate *core.Node
 	gopherNodeRotate    *core.Node
-	toAnimate           []*Animation
-	animating           bool
+	toAnimate           []Animator
+	effects             *Timeline   // cosmetic animations that don't hold up the next step, such as squashes
+	turn                *Rotation   // the gopher turning to the direction of the current step
+	events              []sim.Event // events of the current step that haven't been played yet
+	clock               float32     // time elapsed since the current step started, in blocks travelled
 	resetAnim           bool
+
+	undoStack []levelSnapshot
+	redoStack []levelSnapshot
+	record    *sim.Replay   // recording of the current attempt
+	started   bool          // whether the player moved the gopher during the current attempt
+	playTime  time.Duration // time spent playing the current attempt
+	test      bool          // whether the level is being play-tested in the editor, so that it isn't recorded
+
+	hints      int         // number of hints shown in the level
+	hint       *sim.Dir    // direction of the step suggested by the last hint, until the gopher moves
+	hintSearch *hintSearch // search for a hint that hasn't been shown yet
+	hintStatus string      // message about hints shown under the level statistics
+
+	deadlock *sim.Deadlock // why the level can't be completed from the current state, if it can't
+
+	queue    []sim.Dir  // steps asked for while the previous step was being animated, oldest first
+	held     window.Key // movement key being held down, if holding
+	holding  bool
+	heldTime float64 // seconds the movement key has been held down
+}
+
+// levelSnapshot stores everything needed to return to a previous point of an attempt
+type levelSnapshot struct {
+	state  *sim.State
+	steps  int
+	pushes int
 }
 
 // NewLevel returns a pointer to a new Level object
-func NewLevel(g *Gokoban, ld *LevelData, ls *LevelStyle) *Level {
+func NewLevel(g *Gokoban, name, source string, ld *sim.LevelData, ls *LevelStyle) *Level {
 
 	l := new(Level)
 	l.game = g
+	l.id = sim.LevelID(source)
+	l.name = name
+	l.source = source
 	l.data = ld
+	l.state = sim.NewState(ld)
 	l.style = ls
-	l.animating = false
+	l.effects = Parallel()
 
+	cx, cy, cz := ld.Center()
 	l.scene = core.NewNode()
-	l.scene.SetPosition(-ld.center.X, -ld.center.Y, -ld.center.Z)
+	l.scene.SetPosition(-cx, -cy, -cz)
 
 	l.gopherNodeTranslate = core.NewNode()
 	l.scene.Add(l.gopherNodeTranslate)
@@ -188,71 +120,124 @@ func NewLevel(g *Gokoban, ld *LevelData, ls *LevelStyle) *Level {
 	l.gopherNodeRotate = core.NewNode()
 	l.gopherNodeTranslate.Add(l.gopherNodeRotate)
 
+	l.gopher = NewGopher(ld.GopherInit)
+	l.gopherNodeTranslate.SetPositionVec(gridVec3(ld.GopherInit))
+	l.gopher.SetNode(l.gopherNodeTranslate)
+
 	log.Debug("Starting NewLevel loop")
-	for i, row := range ld.grid {
+	blocks := make(map[sim.GridLoc]*Block)
+	for i, row := range ld.Grid {
 		for j, cell := range row {
 			for k, c := range cell {
-				if c.obj != nil {
-					switch obj := c.obj.(type) {
-					case *Gopher:
-						l.gopher = obj
-						l.gopherNodeTranslate.SetPositionVec(c.loc.Vec3())
-						obj.SetNode(l.gopherNodeTranslate)
-
-					case *Block:
-						mesh := ls.makeBlock()
-						obj.SetMesh(mesh)
-						l.scene.Add(mesh)
-
-					case *Box:
-						l.boxes = append(l.boxes, obj)
-
-						mesh := ls.makeRedBox()
-						light := light.NewPoint(l.style.boxLightColorOff, 1.0)
-
-						obj.SetMeshAndLight(mesh, light)
-						l.scene.Add(mesh)
-
-					case *Pad:
-						light := light.NewPoint(&math32.Color{1, 1, 0}, 1.0)
-						padPos := c.loc.Vec3()
-						//padPos.Y -= 0.2
-						light.SetPositionVec(padPos)
-						l.scene.Add(light)
-
-						// Remove pad as logical object from map
-						ld.Set(c.loc, nil)
-
-						// if block below, change texture
-						if b, ok := ld.grid[i][j][k-1].obj.(*Block); ok {
-							b.mesh.AddGroupMaterial(ls.padMaterial, 2)
-							a := 2
-							if a > 0 {
-
-							}
-						}
-						// TODO (maybe)
-						// else if blocks around, use texture on all existing sides
-						// else if no blocks around create transparent small cube mesh indicating objective
-
-					case *Elevator:
-						l.elevators = append(l.elevators, obj)
-
-						mesh := ls.makeElevator()
-						obj.SetMesh(mesh)
-						l.scene.Add(mesh)
-
-						light := light.NewPoint(&math32.Color{0, 0, 1}, 1.0)
-						mesh.Add(light)
+				if c == sim.BLOCK || c == sim.ICE || c == sim.CONVEYOR {
+					loc := sim.GridLoc{i, j, k}
+					block := NewBlock(loc)
+					mesh := ls.makeBlock()
+					switch c {
+					case sim.ICE:
+						mesh = ls.makeIce()
+					case sim.CONVEYOR:
+						mesh = ls.makeConveyor()
 					}
+					block.SetMesh(mesh)
+					l.scene.Add(mesh)
+					blocks[loc] = block
 				}
 			}
 		}
 	}
 
+	for i, loc := range ld.BoxesInit {
+		box := NewBox(loc, i, ld.BoxType(i))
+		l.boxes = append(l.boxes, box)
+
+		mesh := ls.makeBox(box.Type(), false)
+		light := light.NewPoint(l.style.boxLightColorOff, 1.0)
+
+		box.SetMeshAndLight(mesh, light)
+		l.scene.Add(mesh)
+	}
+
+	for _, loc := range ld.Pads {
+		light := light.NewPoint(&math32.Color{1, 1, 0}, 1.0)
+		light.SetPositionVec(gridVec3(loc))
+		l.scene.Add(light)
+
+		// if block below, change texture
+		below := loc
+		below.Y--
+		if b, ok := blocks[below]; ok {
+			b.mesh.AddGroupMaterial(ls.padMaterial, 2)
+		}
+		// TODO (maybe)
+		// else if blocks around, use texture on all existing sides
+		// else if no blocks around create transparent small cube mesh indicating objective
+	}
+
+	for i, ed := range ld.Elevators {
+		elev := NewElevator(ed.Loc, i, ed.Low, ed.High)
+		l.elevators = append(l.elevators, elev)
+
+		mesh := ls.makeElevator()
+		elev.SetMesh(mesh)
+		l.scene.Add(mesh)
+
+		light := light.NewPoint(&math32.Color{0, 0, 1}, 1.0)
+		mesh.Add(light)
+	}
+
+	for _, td := range ld.Teleporters {
+		pair := strings.Index(sim.TELEPORTERS, string(td.Cell))
+		for _, loc := range td.Ends {
+			tele := NewTeleporter(loc, pair)
+			l.teleporters = append(l.teleporters, tele)
+
+			mesh := ls.makeTeleporter(pair)
+			tele.SetMesh(mesh)
+			l.scene.Add(mesh)
+
+			light := light.NewPoint(ls.teleporterColors[pair%len(ls.teleporterColors)], 0.5)
+			light.SetPositionVec(gridVec3(loc))
+			l.scene.Add(light)
+		}
+	}
+
+	for _, pd := range ld.Plates {
+		plate := NewPlate(pd.Loc)
+		l.plates = append(l.plates, plate)
+
+		mesh := ls.makePlate(strings.Index(sim.PLATES, string(pd.Link)))
+		plate.SetMesh(mesh)
+		l.scene.Add(mesh)
+	}
+
+	for i, gd := range ld.Gates {
+		gate := NewGate(gd.Loc, i)
+		l.gates = append(l.gates, gate)
+
+		gate.SetMesh(ls.makeGate(strings.Index(sim.PLATES, string(gd.Link))))
+		l.scene.Add(gate)
+	}
+
+	for _, td := range ld.Conveyors {
+		tile := NewTile(td.Loc, td.Dir)
+		l.tiles = append(l.tiles, tile)
+
+		tile.SetMesh(ls.makeTile(true))
+		l.scene.Add(tile.mesh)
+	}
+
+	for _, td := range ld.OneWays {
+		tile := NewTile(td.Loc, td.Dir)
+		l.tiles = append(l.tiles, tile)
+
+		tile.SetMesh(ls.makeTile(false))
+		l.scene.Add(tile.mesh)
+	}
+
 	// Add a single point light above the level
 	light := light.NewPoint(&math32.Color{1, 1, 1}, 8.0)
-	light.SetPosition(l.data.center.X, l.data.center.Y*2+2, l.data.center.Z)
+	light.SetPosition(cx, cy*2+2, cz)
 	l.scene.Add(light)
 
 	return l
@@ -264,12 +249,76 @@ func (l *Level) Restart(playSound bool) {
 
 	log.Debug("Restart")
 
-	l.animating = false
 	l.resetAnim = true
+	l.events = nil
+	l.queue = nil
+	l.holding = false
+	l.stopEffects()
 
 	l.game.ui.restartButton.SetEnabled(false)
 
-	// Stop all sounds
+	l.undoStack = nil
+	l.redoStack = nil
+
+	// Save the previous attempt and start recording a new one
+	l.SaveRecord()
+	if !l.test {
+		l.record = sim.NewReplay(l.name, l.source)
+	}
+
+	l.stopSounds()
+	l.clearHint()
+
+	if playSound && l.game.steps != 0 {
+		l.game.audio.levelRestart.Play()
+	}
+
+	l.game.steps = 0
+	l.game.pushes = 0
+	l.started = false
+	l.playTime = 0
+
+	l.state = sim.NewState(l.data)
+	l.deadlock = nil
+
+	l.SetPosition(l.gopher, l.data.GopherInit)
+
+	for i, box := range l.boxes {
+		if l.state.BoxLit(i) {
+			l.boxOnPad(box, false)
+		} else {
+			l.boxOffPad(box, false)
+		}
+		l.SetPosition(box, l.data.BoxesInit[i])
+	}
+
+	for i, elev := range l.elevators {
+		l.SetPosition(elev, l.data.Elevators[i].Loc)
+	}
+
+	for i, gate := range l.gates {
+		gate.SetOpen(l.state.GateOpen(i))
+	}
+}
+
+// SaveRecord saves the recording of the current attempt as a replay file if the player did anything
+// The recording stops until the level is restarted
+func (l *Level) SaveRecord() {
+	if l.record != nil && len(l.record.Moves) > 0 {
+		SaveReplay(l.record)
+	}
+	l.record = nil
+}
+
+// recordAction adds an action to the recording of the current attempt
+func (l *Level) recordAction(action string) {
+	if l.record != nil {
+		l.record.Add(action)
+	}
+}
+
+// stopSounds stops all gameplay sounds
+func (l *Level) stopSounds() {
 	l.game.audio.gopherWalk.Stop()
 	l.game.audio.gopherBump.Stop()
 	l.game.audio.gopherFallEnd.Stop()
@@ -283,71 +332,161 @@ func (l *Level) Restart(playSound bool) {
 	l.game.audio.elevatorDown.Stop()
 	l.game.audio.levelDone.Stop()
 	l.game.audio.levelFail.Stop()
+}
 
-	if playSound && l.game.steps != 0 {
-		l.game.audio.levelRestart.Play()
+// Undo returns the level to the state before the last step, cancelling any ongoing animations
+// Returns false if there is nothing to undo
+func (l *Level) Undo() bool {
+
+	if len(l.undoStack) == 0 {
+		return false
 	}
+	log.Debug("Undo")
+	l.recordAction(sim.ACTION_UNDO)
 
-	l.game.steps = 0
+	l.redoStack = append(l.redoStack, levelSnapshot{l.state, l.game.steps, l.game.pushes})
+	snap := l.undoStack[len(l.undoStack)-1]
+	l.undoStack = l.undoStack[:len(l.undoStack)-1]
+	l.applySnapshot(snap)
+	return true
+}
+
+// Redo reapplies the last undone step
+// Returns false if there is nothing to redo
+func (l *Level) Redo() bool {
 
-	l.SetPosition(l.gopher, l.data.gopherInit)
+	if len(l.redoStack) == 0 {
+		return false
+	}
+	log.Debug("Redo")
+	l.recordAction(sim.ACTION_REDO)
+
+	l.undoStack = append(l.undoStack, levelSnapshot{l.state, l.game.steps, l.game.pushes})
+	snap := l.redoStack[len(l.redoStack)-1]
+	l.redoStack = l.redoStack[:len(l.redoStack)-1]
+	l.applySnapshot(snap)
+	return true
+}
+
+// applySnapshot makes the provided snapshot the current state and moves all objects accordingly
+func (l *Level) applySnapshot(snap levelSnapshot) {
+
+	l.resetAnim = true
+	l.events = nil
+	l.queue = nil
+	l.stopEffects()
+	l.stopSounds()
+	l.clearHint()
+
+	l.state = snap.state
+	l.checkDeadlock()
+	l.game.steps = snap.steps
+	l.game.pushes = snap.pushes
+	l.game.ui.restartButton.SetEnabled(l.game.steps > 0)
+
+	l.SetPosition(l.gopher, l.state.Gopher())
 
 	for i, box := range l.boxes {
-		l.boxOffPad(box, false)
-		l.SetPosition(box, l.data.boxesInit[i])
+		if l.state.BoxLit(i) {
+			l.boxOnPad(box, false)
+		} else {
+			l.boxOffPad(box, false)
+		}
+		l.SetPosition(box, l.state.Box(i))
 	}
 
-	for _, elev := range l.elevators {
-		lowLoc := elev.Location()
-		lowLoc.y = elev.low
-		l.SetPosition(elev, lowLoc)
+	for i, elev := range l.elevators {
+		l.SetPosition(elev, l.state.Elevator(i))
+	}
+
+	for i, gate := range l.gates {
+		gate.SetOpen(l.state.GateOpen(i))
 	}
 }
 
-// SetPosition moves an object in the data grid along with its node to the desired position
-func (l *Level) SetPosition(obj IMapObj, dest GridLoc) {
-	l.data.Set(obj.Location(), nil)
+// SetPosition moves an object along with its node to the desired position
+// The node is also returned to its normal size, in case it was in the middle of going through a teleporter
+func (l *Level) SetPosition(obj IMapObj, dest sim.GridLoc) {
 	obj.SetLocation(dest)
-	l.data.Set(obj.Location(), obj)
-	obj.GetNode().SetPositionVec(dest.Vec3())
+	obj.GetNode().SetPositionVec(gridVec3(dest))
+	obj.GetNode().SetScale(1, 1, 1)
+}
+
+// mapObj returns the scene object associated to the provided simulation object
+func (l *Level) mapObj(obj sim.Obj) IMapObj {
+	switch obj.Kind {
+	case sim.ObjGopher:
+		return l.gopher
+	case sim.ObjBox:
+		return l.boxes[obj.Index]
+	case sim.ObjElevator:
+		return l.elevators[obj.Index]
+	case sim.ObjGate:
+		return l.gates[obj.Index]
+	}
+	return nil
 }
 
 // onKey handles keyboard events for the level
 func (l *Level) onKey(evname string, ev interface{}) {
 
 	if !l.game.gopherLocked {
-
-		xd := int(l.game.stepDelta.X)
-		zd := int(l.game.stepDelta.Y)
-
 		kev := ev.(*window.KeyEvent)
-		switch kev.Key {
-		case window.KeyW, window.KeyUp:
-			log.Debug("Up")
-			l.step(zd, xd)
-		case window.KeyS, window.KeyDown:
-			log.Debug("Down")
-			l.step(-zd, -xd)
-		case window.KeyA, window.KeyLeft:
-			log.Debug("Left")
-			l.step(-xd, zd)
-		case window.KeyD, window.KeyRight:
-			log.Debug("Right")
-			l.step(xd, -zd)
+		if d, ok := l.keyDir(kev.Key); ok {
+			l.held = kev.Key
+			l.holding = true
+			l.heldTime = 0
+			l.step(d.Z, d.X)
 		}
 	}
 }
 
-// Update updates all ongoing animations for the level
+// release stops repeating the step of the provided key if it was being held down
+func (l *Level) release(key window.Key) {
+	if l.holding && l.held == key {
+		l.holding = false
+	}
+}
+
+// keyDir returns the direction a movement key steps to, relative to the camera
+// Returns false if the key doesn't move the gopher
+func (l *Level) keyDir(key window.Key) (sim.Dir, bool) {
+
+	xd := int(l.game.stepDelta.X)
+	zd := int(l.game.stepDelta.Y)
+
+	switch key {
+	case window.KeyW, window.KeyUp:
+		log.Debug("Up")
+		return sim.Dir{zd, xd}, true
+	case window.KeyS, window.KeyDown:
+		log.Debug("Down")
+		return sim.Dir{-zd, -xd}, true
+	case window.KeyA, window.KeyLeft:
+		log.Debug("Left")
+		return sim.Dir{-xd, zd}, true
+	case window.KeyD, window.KeyRight:
+		log.Debug("Right")
+		return sim.Dir{xd, -zd}, true
+	}
+	return sim.Dir{}, false
+}
+
+// animating returns whether the events of the last step are still being played
+func (l *Level) animating() bool {
+	return len(l.events) > 0 || len(l.toAnimate) > 0
+}
+
+// Update updates all ongoing animations for the level and plays the events that are due
 func (l *Level) Update(timeDelta float64) {
 
 	if l.resetAnim {
 		l.resetAnim = false
-		l.toAnimate = make([]*Animation, 0)
+		l.toAnimate = make([]Animator, 0)
 	}
 
 	newToAnimate := l.toAnimate
-	l.toAnimate = make([]*Animation, 0)
+	l.toAnimate = make([]Animator, 0)
 
 	for _, anim := range newToAnimate {
 		if !l.resetAnim {
@@ -359,426 +498,370 @@ func (l *Level) Update(timeDelta float64) {
 		}
 	}
 
-}
-
-// animate queues a movement animation for an object and also moves the object in the grid
-func (l *Level) animate(obj IMapObj, dest GridLoc, delete bool, cb func(interface{})) {
+	// Effects and turns run in real time (scaled by the animation speed), alongside the steps
+	if l.turn != nil && !l.turn.Update(timeDelta) {
+		l.turn = nil
+	}
+	l.effects.Update(timeDelta)
 
-	log.Debug("Queueing animation %+v %+v", obj, dest)
+	// Play the events that are due
+	l.clock += float32(timeDelta) * l.animationSpeed()
+	for len(l.events) > 0 && l.events[0].Time <= l.clock && !l.resetAnim {
+		ev := l.events[0]
+		l.events = l.events[1:]
+		l.play(ev)
+	}
 
-	// Queue animation
-	anim := NewAnimation(obj.GetNode(), dest.Vec3(), cb, obj)
-	l.toAnimate = append(l.toAnimate, anim)
+	// Take the next step asked for during the last one, or repeat the step of the key being held down
+	if l.holding {
+		l.heldTime += timeDelta
+	}
+	if !l.animating() && !l.game.gopherLocked {
+		if len(l.queue) > 0 {
+			d := l.queue[0]
+			l.queue = l.queue[1:]
+			l.step(d.Z, d.X)
+		} else if l.holding && l.heldTime >= KEY_REPEAT_DELAY {
+			d, _ := l.keyDir(l.held)
+			l.step(d.Z, d.X)
+		}
+	}
 
-	// Move in matrix
-	oloc := obj.Location()
-	l.data.Set(oloc, nil)
-	if !delete {
-		l.data.Set(dest, obj)
-		obj.SetLocation(dest)
+	// Offer to undo or restart once the step that made the level unwinnable has been played
+	if !l.animating() {
+		reason := ""
+		if l.deadlock != nil && l.game.replayer == nil && !l.game.editing() {
+			reason = l.deadlock.Reason
+		}
+		l.game.ui.ShowDeadlock(reason)
 	}
 }
 
-// getCellRelativeToLoc returns the object and location
-// relative to the provided location using the provided deltas
-func (l *Level) getCellRelativeToLoc(p GridLoc, zd, xd, yd int) (IMapObj, GridLoc) {
-	cell_loc := p
-	cell_loc.x += xd
-	cell_loc.y += yd
-	cell_loc.z += zd
-	return l.data.Get(cell_loc), cell_loc
-}
+// animate queues a movement animation for an object
+// The easing doesn't change how long the movement takes, so objects stay in step with the simulation
+func (l *Level) animate(obj IMapObj, dest sim.GridLoc, easing Easing) {
 
-// getCellRelativeTo returns the object and location
-// relative to the location of the provided object using the provided deltas
-func (l *Level) getCellRelativeTo(c IMapObj, zd, xd, yd int) (IMapObj, GridLoc) {
-	cell_loc := c.Location()
-	cell_loc.x += xd
-	cell_loc.y += yd
-	cell_loc.z += zd
-	return l.data.Get(cell_loc), cell_loc
-}
+	log.Debug("Queueing animation %+v %+v", obj, dest)
 
-// step processes a gopher step to the provided direction
-func (l *Level) step(zd, xd int) {
+	anim := NewAnimation(obj.GetNode(), gridVec3(dest), l.animationSpeed(), nil, obj).SetEasing(easing)
+	l.toAnimate = append(l.toAnimate, anim)
+	obj.SetLocation(dest)
+}
 
-	// Only process step if not already animating another
-	// TODO else - add to queue?
-	if !l.animating {
+// fall queues the animation of an object falling with the provided event, accelerating like under gravity
+// If the object lands at the end of the fall, the fall is followed by squashing it (and the gopher, if the object is a box landing on it)
+func (l *Level) fall(obj IMapObj, ev sim.Event) {
 
-		l.game.ui.restartButton.SetEnabled(true)
+	log.Debug("Queueing fall %+v %+v", obj, ev.To)
 
-		// Rotate gopher
-		if xd > 0 {
-			l.gopherNodeRotate.SetRotationY(0)
-		}
-		if xd < 0 {
-			l.gopherNodeRotate.SetRotationY(math32.Pi)
-		}
-		if zd > 0 {
-			l.gopherNodeRotate.SetRotationY(math32.Pi * 3 / 2)
+	// Falls take as long as in the simulation (see sim.FALL_GRAVITY)
+	speed := l.animationSpeed()
+	var land func(interface{})
+	for _, next := range l.events {
+		if next.Obj != ev.Obj {
+			continue
 		}
-		if zd < 0 {
-			l.gopherNodeRotate.SetRotationY(math32.Pi / 2)
-		}
-
-		// Check if can move
-		c, cl := l.getCellRelativeTo(l.gopher, zd, xd, 0)
-
-		if c != nil {
-			if c.IsPushable() {
-				// Check if box can be pushed (if there is space behind it)
-				cn, cnl := l.getCellRelativeTo(l.gopher, 2*zd, 2*xd, 0)
-				if cn == nil {
-					l.pushBox(c, cnl)
-					l.moveGopherTo(cl)
+		if next.Type == sim.EventLand {
+			land = func(interface{}) {
+				if _, ok := obj.(*Box); ok {
+					l.squash(obj, BOX_SQUASH)
 				} else {
-					l.wallBump()
+					l.squash(obj, GOPHER_SQUASH)
 				}
-			} else {
-				l.wallBump()
 			}
-		} else {
-			l.moveGopherTo(cl)
+		} else if next.Type == sim.EventHurt {
+			land = func(interface{}) {
+				l.squash(obj, BOX_SQUASH)
+				l.squash(l.gopher, GOPHER_HURT_SQUASH)
+			}
 		}
+		break
 	}
+	anim := NewFall(obj.GetNode(), gridVec3(ev.To), sim.FALL_GRAVITY*speed*speed, land, nil)
+	l.toAnimate = append(l.toAnimate, anim)
+	obj.SetLocation(ev.To)
 }
 
-func (l *Level) wallBump() {
-	log.Debug("Hit wall")
-	l.game.audio.gopherBump.Play()
-}
+// teleport queues an animation of an object shrinking away and growing back at the other end of a teleporter
+func (l *Level) teleport(obj IMapObj, dest sim.GridLoc) {
 
-// moveGopherTo moves the gopher and sets up the appropriate callbacks
-func (l *Level) moveGopherTo(pos GridLoc) {
+	log.Debug("Queueing teleport %+v %+v", obj, dest)
 
-	l.game.steps++
-	l.animating = true
+	half := sim.TELEPORT_TIME / l.animationSpeed() / 2
+	gone := math32.Vector3{0.01, 0.01, 0.01}
+	anim := Sequence(
+		Sequence(NewScaling(obj, gone, 0, half, EaseIn)).SetCallback(func(interface{}) {
+			obj.GetNode().SetPositionVec(gridVec3(dest))
+		}, nil),
+		NewScaling(obj, math32.Vector3{1, 1, 1}, 0, half, EaseOutBack),
+	)
+	l.toAnimate = append(l.toAnimate, anim)
+	obj.SetLocation(dest)
+}
 
-	floor, _ := l.getCellRelativeToLoc(pos, 0, 0, -1)
-	if floor == nil {
-		l.game.audio.gopherFallStart.Play()
+// squash flattens an object that just landed and lets it spring back
+func (l *Level) squash(obj IMapObj, amount float32) {
+	duration := SQUASH_TIME / l.game.userData.AnimScale
+	if _, ok := obj.(*Gopher); ok {
+		// The gopher model is shared between levels, and stands on the bottom of its cell
+		l.effects.Add(NewSquash(l.game.gopherNode, amount, 0.5, duration))
 	} else {
-		l.game.audio.gopherWalk.Play()
+		// Boxes can be pushed again while springing back, so they are squashed around their center
+		l.effects.Add(NewSquash(obj, amount, 0, duration))
 	}
-
-	oldloc := l.gopher.Location()
-	l.animate(l.gopher, pos, false, func(obj interface{}) {
-		l.moveAwayFrom(oldloc)
-		l.afterMove(obj)
-	})
 }
 
-// levelComplete returns true if all the boxes are on pads
-func (l *Level) levelComplete() bool {
-	for _, p := range l.data.pads {
-		if _, ok := l.data.Get(p).(*Box); !ok {
-			return false
-		}
+// turnGopher turns the gopher to the provided angle around the vertical axis
+func (l *Level) turnGopher(angle float32) {
+	if l.turn != nil {
+		finish(l.turn)
 	}
-	return true
+	l.turn = NewRotation(l.gopherNodeRotate, angle, GOPHER_TURN_TIME/l.game.userData.AnimScale)
+	l.turn.Update(0)
 }
 
-// boxOnPad handles what happens when a box enters a pad
-func (l *Level) boxOnPad(box *Box, playSound bool) {
-
-	log.Debug("Box on pad")
-	if box.light.Color() == *l.style.boxLightColorOff {
-		if playSound {
-			box.Add(l.game.audio.boxOnPad)
-			l.game.audio.boxOnPad.Play()
-		}
-		log.Debug("...replacing mesh and changing light color")
-		l.scene.Remove(box.mesh)
-		newMesh := l.style.makeGreenBox()
-		box.light.SetColor(l.style.boxLightColorOn)
-		box.SetMeshAndLight(newMesh, box.light)
-		l.scene.Add(newMesh)
-		if l.levelComplete() {
-			l.game.audio.levelDone.Play()
-			l.game.LevelComplete()
-		}
+// stopEffects brings cosmetic animations to their end at once, so that no object is left turned halfway or squashed
+func (l *Level) stopEffects() {
+	finish(l.effects)
+	if l.turn != nil {
+		finish(l.turn)
+		l.turn = nil
 	}
 }
 
-// boxOffPad handles what happens when a box leaves a pad
-func (l *Level) boxOffPad(box *Box, playSound bool) {
-
-	log.Debug("Box off pad")
-	if box.light.Color() == *l.style.boxLightColorOn {
-		if playSound {
-			box.Add(l.game.audio.boxOffPad)
-			l.game.audio.boxOffPad.Play()
-		}
-		log.Debug("...replacing mesh and changing light color")
-		l.scene.Remove(box.mesh)
-		newMesh := l.style.makeRedBox()
-		box.light.SetColor(l.style.boxLightColorOff)
-		box.SetMeshAndLight(newMesh, box.light)
-		l.scene.Add(newMesh)
-	}
+// animationSpeed returns how many blocks per second objects move, as chosen by the player
+func (l *Level) animationSpeed() float32 {
+	return ANIMATION_SPEED * l.game.userData.AnimScale
 }
 
-// afterFallSound
-func (l *Level) afterFallSound(o interface{}, numFloors int) {
-
-	obj := o.(IMapObj)
+// step processes a gopher step to the provided direction
+// Steps asked for while another is being animated are queued (see Update), up to INPUT_QUEUE_SIZE of them
+func (l *Level) step(zd, xd int) {
 
-	floor, _ := l.getCellRelativeTo(obj, 0, 0, -1)
-	if _, objIsGopher := obj.(*Gopher); objIsGopher && numFloors >= 1 {
-		l.game.audio.gopherFallEnd.Play()
-	} else if box, objIsBox := obj.(*Box); objIsBox {
-		if _, floorIsGopher := floor.(*Gopher); floorIsGopher {
-			l.game.audio.gopherHurt.Play()
-		} else { //if !l.data.IsPad(obj.Location()) {
-			box.Add(l.game.audio.boxFallEnd)
-			l.game.audio.boxFallEnd.Play()
+	if l.animating() {
+		if len(l.queue) < INPUT_QUEUE_SIZE {
+			l.queue = append(l.queue, sim.Dir{zd, xd})
 		}
+		return
 	}
-}
-
-// afterNewFloor
-func (l *Level) afterNewFloor(obj interface{}) {
-
-	log.Debug("afterNewFloor")
-	l.animating = false
-	o := obj.(IMapObj)
 
-	box, isBox := obj.(*Box)
+	l.game.ui.restartButton.SetEnabled(true)
 
-	floor, _ := l.getCellRelativeTo(o, 0, 0, -1)
-	if elev, ok := floor.(*Elevator); ok {
-		l.elevate(elev)
-	} else if isBox && l.data.IsPad(box.loc) {
-		l.boxOnPad(box, true)
+	// Rotate gopher
+	if xd > 0 {
+		l.turnGopher(0)
 	}
-}
-
-// fall
-func (l *Level) fall(obj IMapObj, playSound bool) {
-
-	log.Debug("fall")
-	l.animating = true
-
-	if playSound {
-		if box, ok := obj.(*Box); ok {
-			box.Add(l.game.audio.boxFallStart)
-			l.game.audio.boxFallStart.Play()
-		}
+	if xd < 0 {
+		l.turnGopher(math32.Pi)
+	}
+	if zd > 0 {
+		l.turnGopher(math32.Pi * 3 / 2)
+	}
+	if zd < 0 {
+		l.turnGopher(math32.Pi / 2)
 	}
 
-	var cb func(obj interface{})
-	posStart := obj.Location()
-	pfall := l.posAfterFallFrom(posStart)
-	floors := posStart.y - pfall.y
-	del := false
-	if pfall.y == 0 {
-		log.Debug("...out of game")
-
-		// If it's the gopher falling - lock it
-		if _, ok := obj.(*Gopher); ok {
-			l.game.gopherLocked = true
-			l.game.arrowNode.SetVisible(false)
-		}
+	// Keep the state before the step so that it can be undone
+	prev := levelSnapshot{l.state.Clone(), l.game.steps, l.game.pushes}
 
-		del = true
-		pfall.y = -20
-		l.game.audio.levelFail.Play()
-		cb = func(obj interface{}) {
-			log.Debug("Done falling out of game")
-			l.game.RestartLevel(true)
-		}
+	l.clock = 0
+	l.events = l.state.Step(zd, xd)
+	if len(l.events) == 0 || l.events[0].Type == sim.EventBump {
+		// Holding a key against a wall bumps into it only once
+		l.holding = false
 	} else {
-		log.Debug("...still in game")
-		cb = func(obj interface{}) {
-			log.Debug("Done falling in game")
-			if playSound {
-				l.afterFallSound(obj, floors)
-			}
-			l.afterNewFloor(obj)
+		// Keys move the gopher relative to the camera, but steps are recorded in absolute grid directions
+		// so that replays (and their LURD export) don't depend on where the camera was
+		l.recordAction(sim.Dir{zd, xd}.String())
+
+		// The first step of an attempt that moves the gopher counts as an attempt in the level's records
+		if !l.started && l.game.counting() {
+			l.started = true
+			l.game.userData.Record(l.id).Attempts++
+			l.game.ui.UpdateStatsLabel()
 		}
-	}
-
-	l.animate(obj, pfall, del, cb)
-}
 
-func (l *Level) posAfterFallFrom(pos GridLoc) GridLoc {
-	pos.y--
-	for ; pos.y >= 0 && l.data.Get(pos) == nil; pos.y-- {
+		l.undoStack = append(l.undoStack, prev)
+		l.redoStack = nil
+		l.clearHint()
+		l.checkDeadlock()
 	}
-	pos.y++
-	return pos
+	l.Update(0)
 }
 
-// afterMove
-func (l *Level) afterMove(obj interface{}) {
-
-	log.Debug("afterMove")
-	l.animating = false
-	o := obj.(IMapObj)
-
-	floor, _ := l.getCellRelativeTo(o, 0, 0, -1)
-	if floor == nil {
-		l.fall(o, true)
-	} else {
-		l.afterNewFloor(o)
+// checkDeadlock looks for a reason the level can't be completed from the current state
+// Objects falling out of the world already restart the level, so that isn't reported
+func (l *Level) checkDeadlock() {
+	l.deadlock = nil
+	if !l.state.Failed() {
+		l.deadlock = l.state.Deadlock()
+	}
+	if l.deadlock != nil {
+		log.Debug("Deadlock: %v (boxes %v)", l.deadlock.Reason, l.deadlock.Boxes)
 	}
 }
 
-// pushBox
-func (l *Level) pushBox(box IMapObj, dest GridLoc) {
+// play turns a simulation event into animations and sounds
+func (l *Level) play(ev sim.Event) {
 
-	log.Debug("pushBox")
-	box.GetNode().Add(l.game.audio.boxPush)
-	l.game.audio.boxPush.Play()
+	log.Debug("Event %v %+v", ev.Type, ev)
+	obj := l.mapObj(ev.Obj)
+	audio := l.game.audio
 
-	toMove := make([]IMapObj, 0)
-	toFall := make([]IMapObj, 0)
-	foundBarrier := false
+	switch ev.Type {
+	case sim.EventBump:
+		log.Debug("Hit wall")
+		audio.gopherBump.Play()
 
-	// Check if leaving pad
-	if l.data.IsPad(box.Location()) && !l.data.IsPad(dest) {
-		boxObj := box.(*Box)
-		l.boxOffPad(boxObj, true)
-	}
-
-	// Iterate through piled boxes
-	for box != nil && box.IsPushable() {
-
-		if foundBarrier == false && l.data.Get(dest) == nil {
-			toMove = append(toMove, box)
+	case sim.EventWalk, sim.EventStepOff:
+		l.game.steps++
+		if ev.Type == sim.EventStepOff {
+			audio.gopherFallStart.Play()
 		} else {
-			foundBarrier = true
-			toFall = append(toFall, box)
+			audio.gopherWalk.Play()
+		}
+		l.animate(obj, ev.To, EaseLinear)
+
+	case sim.EventPush:
+		// Only the first box of a pushed stack makes a sound, so count one push per stack
+		if ev.Sound {
+			l.game.pushes++
+			obj.GetNode().Add(audio.boxPush)
+			audio.boxPush.Play()
 		}
+		l.animate(obj, ev.To, EaseLinear)
 
-		// Update current box and destination
-		box, _ = l.getCellRelativeTo(box, 0, 0, 1)
-		dest.y++
-	}
+	case sim.EventFall:
+		if box, ok := obj.(*Box); ok && ev.Sound {
+			box.Add(audio.boxFallStart)
+			audio.boxFallStart.Play()
+		}
+		l.fall(obj, ev)
 
-	// Move boxes toMove, adding a callback to the first one for boxes toFall
-	for i, box := range toMove {
-		cb := func(obj interface{}) {
-			l.afterMove(obj)
+	case sim.EventFallOut:
+		log.Debug("...out of game")
+
+		// If it's the gopher falling - lock it
+		if ev.Obj.Kind == sim.ObjGopher {
+			l.game.gopherLocked = true
+			l.game.arrowNode.SetVisible(false)
 		}
-		if i == 0 {
-			cb = func(obj interface{}) {
-				l.afterMove(obj)
-				for j, boxToFall := range toFall {
-					l.fall(boxToFall, j == 0) // only play sound for the first one
-				}
-			}
+		audio.levelFail.Play()
+		l.fall(obj, ev)
+
+	case sim.EventFail:
+		log.Debug("Done falling out of game")
+		if l.game.counting() {
+			l.game.userData.Record(l.id).Falls++
+			l.game.userData.Save()
 		}
-		l.animate(box, GridLoc{dest.z, dest.x, box.Location().y}, false, cb)
-	}
-}
+		l.game.RestartLevel(true)
 
-// moveAwayFrom
-func (l *Level) moveAwayFrom(pos GridLoc) {
-
-	log.Debug("moveAwayFrom %+v", pos)
+	case sim.EventLand:
+		if ev.Sound {
+			if box, ok := obj.(*Box); ok {
+				box.Add(audio.boxFallEnd)
+				audio.boxFallEnd.Play()
+			} else {
+				audio.gopherFallEnd.Play()
+			}
+		}
+		// The object is squashed by its fall (see fall)
 
-	floor, _ := l.getCellRelativeToLoc(pos, 0, 0, -1)
-	if elev, ok := floor.(*Elevator); ok {
-		log.Debug("Stepped out from elevator %+v", pos)
-		l.lowerElev(elev)
-	}
+	case sim.EventHurt:
+		if ev.Sound {
+			audio.gopherHurt.Play()
+		}
 
-	ceil, _ := l.getCellRelativeToLoc(pos, 0, 0, 1)
-	if ceil != nil {
-		if ceil.IsPushable() {
-			log.Debug("Stepped out from under box(es) %+v", pos)
-			box := ceil
-			for box != nil && box.IsPushable() {
-				box_above, _ := l.getCellRelativeTo(box, 0, 0, 1)
-				l.fall(box, true) // TODO only true for the first one
-				box = box_above
-			}
-		} else if elev, ok := ceil.(*Elevator); ok {
-			cargo := l.getCargo(elev)
-			if len(cargo) == 0 {
-				l.lowerElev(elev)
-			}
+	case sim.EventBreak:
+		log.Debug("Fragile box broke")
+		obj.GetNode().Add(audio.boxFallEnd)
+		audio.boxFallEnd.Play()
+		audio.levelFail.Play()
+		// The box bursts and vanishes where it landed
+		duration := SQUASH_TIME / l.game.userData.AnimScale
+		l.effects.Add(Sequence(
+			NewScaling(obj, math32.Vector3{1.3, 1.3, 1.3}, 0, duration/3, EaseOut),
+			NewScaling(obj, math32.Vector3{0.01, 0.01, 0.01}, 0, duration*2/3, EaseIn),
+		))
+
+	case sim.EventSlide, sim.EventConvey:
+		l.animate(obj, ev.To, EaseLinear)
+
+	case sim.EventRide:
+		l.animate(obj, ev.To, EaseInOut)
+
+	case sim.EventElevatorUp:
+		obj.GetNode().Add(audio.elevatorUp)
+		audio.elevatorUp.Play()
+		l.animate(obj, ev.To, EaseInOut)
+
+	case sim.EventElevatorDown:
+		obj.GetNode().Add(audio.elevatorDown)
+		audio.elevatorDown.Play()
+		l.animate(obj, ev.To, EaseInOut)
+
+	case sim.EventTeleport:
+		l.teleport(obj, ev.To)
+
+	case sim.EventGateOpen, sim.EventGateClose:
+		gate := obj.(*Gate)
+		scale := gateScale(ev.Type == sim.EventGateOpen)
+		l.effects.Add(NewScaling(gate.mesh, *scale, 0.5, GATE_TIME/l.game.userData.AnimScale, EaseInOut))
+
+	case sim.EventElevatorStop:
+		if ev.To.Y > ev.From.Y {
+			audio.elevatorUp.Stop()
+		} else {
+			audio.elevatorDown.Stop()
 		}
-	}
-}
 
-// lowerElev lowers the specified elevator as far as it can go
-func (l *Level) lowerElev(elev *Elevator) {
+	case sim.EventOnPad:
+		l.boxOnPad(obj.(*Box), ev.Sound)
 
-	log.Debug("lowerElev %+v", elev)
-	newloc := elev.loc
-	for newloc.y = elev.loc.y - 1; newloc.y >= elev.low && l.data.Get(newloc) == nil; newloc.y-- {
-	}
-	newloc.y++
-	if newloc.y != elev.loc.y {
-		log.Debug("Lowering elevator")
-		elev.Add(l.game.audio.elevatorDown)
-		l.game.audio.elevatorDown.Play()
-		l.animate(elev, newloc, false, func(obj interface{}) {
-			l.game.audio.elevatorDown.Stop()
-		})
+	case sim.EventOffPad:
+		l.boxOffPad(obj.(*Box), ev.Sound)
+
+	case sim.EventComplete:
+		l.queue = nil
+		l.holding = false
+		audio.levelDone.Play()
+		l.game.LevelComplete()
 	}
 }
 
-// getCargo returns the list of objects on top of the specified elevator
-func (l *Level) getCargo(elev *Elevator) []IMapObj {
+// boxOnPad handles what happens when a box enters a pad
+func (l *Level) boxOnPad(box *Box, playSound bool) {
 
-	cargo := make([]IMapObj, 0)
-	for y := 1; ; y++ {
-		c, _ := l.getCellRelativeTo(elev, 0, 0, y)
-		if c == nil || !c.IsPushable() {
-			break
-		} else {
-			cargo = append(cargo, c)
+	log.Debug("Box on pad")
+	if box.light.Color() == *l.style.boxLightColorOff {
+		if playSound {
+			box.Add(l.game.audio.boxOnPad)
+			l.game.audio.boxOnPad.Play()
 		}
+		log.Debug("...replacing mesh and changing light color")
+		l.scene.Remove(box.mesh)
+		newMesh := l.style.makeBox(box.Type(), true)
+		box.light.SetColor(l.style.boxLightColorOn)
+		box.SetMeshAndLight(newMesh, box.light)
+		l.scene.Add(newMesh)
 	}
-
-	return cargo
 }
 
-// elevate moves elevator and cargo up as far as it can go
-func (l *Level) elevate(elev *Elevator) {
-
-	log.Debug("elevate %+v", elev)
-
-	var spaces_above_cargo int
-	max_elevation := elev.high - elev.loc.y
-
-	if max_elevation > 0 {
-		elev.Add(l.game.audio.elevatorUp)
-		l.game.audio.elevatorUp.Play()
-
-		l.animating = true
-		cargo := l.getCargo(elev)
-		last := cargo[len(cargo)-1]
-
-		// Iterate above cargo, and calculate how many floors we can move up
-		for y := 1; spaces_above_cargo < max_elevation; y++ {
-			c, _ := l.getCellRelativeTo(last, 0, 0, y)
-			if c == nil {
-				spaces_above_cargo++
-			} else {
-				break
-			}
-		}
+// boxOffPad handles what happens when a box leaves a pad
+func (l *Level) boxOffPad(box *Box, playSound bool) {
 
-		log.Debug("Elevating %v", spaces_above_cargo)
-		// Move elevator and cargo up (need to move highest/last things first)
-		for i := len(cargo) - 1; i >= 0; i-- {
-			c := cargo[i]
-			up := c.Location()
-			up.y += spaces_above_cargo
-			l.animate(c, up, false, nil)
+	log.Debug("Box off pad")
+	if box.light.Color() == *l.style.boxLightColorOn {
+		if playSound {
+			box.Add(l.game.audio.boxOffPad)
+			l.game.audio.boxOffPad.Play()
 		}
-
-		up := elev.Location()
-		up.y += spaces_above_cargo
-		l.animate(elev, up, false, func(interface{}) {
-			l.game.audio.elevatorUp.Stop()
-			l.animating = false
-		})
-
+		log.Debug("...replacing mesh and changing light color")
+		l.scene.Remove(box.mesh)
+		newMesh := l.style.makeBox(box.Type(), false)
+		box.light.SetColor(l.style.boxLightColorOff)
+		box.SetMeshAndLight(newMesh, box.light)
+		l.scene.Add(newMesh)
 	}
 }
@@ -0,0 +1,305 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/danaugrs/gokoban/sim"
+	"github.com/g3n/engine/gui"
+	"github.com/g3n/engine/math32"
+
+	"fmt"
+	"image"
+	"image/color"
+)
+
+const LEVEL_SELECT_COLUMNS int = 5
+const LEVEL_TILE_WIDTH float32 = 140
+const LEVEL_TILE_HEIGHT float32 = 180
+const PACK_ROW_HEIGHT float32 = 40
+const THUMBNAIL_MAX_WIDTH float32 = 120
+const THUMBNAIL_MAX_HEIGHT float32 = 80
+const THUMBNAIL_CELL_SIZE int = 8 // pixels per grid cell in level thumbnails
+
+var tileColor = math32.Color4{0.2, 0.2, 0.2, 0.8}
+var tileColorOver = math32.Color4{0.3, 0.3, 0.3, 0.8}
+var tileBorderLocked = math32.Color4{0.4, 0.4, 0.4, 1}
+var tileBorderCompleted = sliderColor
+var tileBorderUnlocked = sliderBorderColor
+
+// levelTile is the widget representing a level in the level select screen
+type levelTile struct {
+	panel      *gui.Panel
+	title      *gui.Label
+	difficulty *gui.Label
+	status     *gui.Label
+	locked     bool
+}
+
+// CreateLevelSelectScreen creates the (initially hidden) level select panel inside the menu screen
+// The level tiles are created when the panel is shown, once the levels of the current pack are loaded
+func (ui *UI) CreateLevelSelectScreen() {
+
+	ui.levelSelectPanel = gui.NewPanel(float32(LEVEL_SELECT_COLUMNS)*(LEVEL_TILE_WIDTH+10)+20, 100)
+	ui.levelSelectPanel.SetZLayerDelta(2)
+	ui.levelSelectPanel.SetBorders(2, 2, 2, 2)
+	ui.levelSelectPanel.SetBordersColor4(&sliderBorderColor)
+	ui.levelSelectPanel.SetColor4(&math32.Color4{0.2, 0.2, 0.2, 0.6})
+	ui.levelSelectPanel.SetPaddings(10, 10, 10, 10)
+	ui.levelSelectPanel.SetVisible(false)
+
+	// Level pack selection row
+	ui.packPrevButton = gui.NewButton("<")
+	ui.packPrevButton.Subscribe(gui.OnClick, func(evname string, ev interface{}) {
+		ui.game.audio.click.Play()
+		ui.cyclePack(-1)
+	})
+	ui.packPrevButton.Subscribe(gui.OnCursorEnter, func(evname string, ev interface{}) {
+		ui.game.audio.hover.Play()
+	})
+	ui.levelSelectPanel.Add(ui.packPrevButton)
+
+	ui.packLabel = gui.NewLabel("")
+	ui.packLabel.SetFontSize(22)
+	ui.packLabel.SetColor(&math32.Color{1, 1, 1})
+	ui.packLabel.SetEnabled(false)
+	ui.levelSelectPanel.Add(ui.packLabel)
+
+	ui.packNextButton = gui.NewButton(">")
+	ui.packNextButton.Subscribe(gui.OnClick, func(evname string, ev interface{}) {
+		ui.game.audio.click.Play()
+		ui.cyclePack(1)
+	})
+	ui.packNextButton.Subscribe(gui.OnCursorEnter, func(evname string, ev interface{}) {
+		ui.game.audio.hover.Play()
+	})
+	ui.levelSelectPanel.Add(ui.packNextButton)
+
+	ui.levelSelectGrid = gui.NewPanel(ui.levelSelectPanel.ContentWidth(), 100)
+	ui.levelSelectGrid.SetPosition(0, PACK_ROW_HEIGHT+10)
+	gridLayout := gui.NewGridLayout(LEVEL_SELECT_COLUMNS)
+	gridLayout.SetAlignH(gui.AlignCenter)
+	ui.levelSelectGrid.SetLayout(gridLayout)
+	ui.levelSelectPanel.Add(ui.levelSelectGrid)
+
+	// Back Button
+	ui.levelSelectBack = gui.NewButton("Back (Esc)")
+	ui.levelSelectBack.Subscribe(gui.OnClick, func(evname string, ev interface{}) {
+		ui.game.audio.click.Play()
+		ui.ShowLevelSelect(false)
+	})
+	ui.levelSelectBack.Subscribe(gui.OnCursorEnter, func(evname string, ev interface{}) {
+		ui.game.audio.hover.Play()
+	})
+	ui.levelSelectPanel.Add(ui.levelSelectBack)
+
+	ui.menuScreen.Add(ui.levelSelectPanel)
+}
+
+// ShowLevelSelect switches the menu between the main menu panel and the level select panel
+func (ui *UI) ShowLevelSelect(show bool) {
+
+	ui.inLevelSelect = show
+	ui.menuPanel.SetVisible(!show)
+	ui.levelSelectPanel.SetVisible(show)
+	if show {
+		if ui.levelTilesPack != ui.game.pack {
+			ui.createLevelTiles()
+		}
+		ui.UpdateLevelTiles()
+		width, height := ui.game.GetFramebufferSize()
+		ui.Resize(width, height)
+	}
+}
+
+// cyclePack switches to the next (or previous, if delta is negative) level pack
+func (ui *UI) cyclePack(delta int) {
+	packs := ui.game.packs
+	for i, pack := range packs {
+		if pack == ui.game.pack {
+			ui.game.SelectPack(packs[(i+delta+len(packs))%len(packs)])
+			break
+		}
+	}
+	ui.createLevelTiles()
+	ui.UpdateLevelTiles()
+	width, height := ui.game.GetFramebufferSize()
+	ui.Resize(width, height)
+}
+
+// createLevelTiles creates one tile per level of the current pack, and shows the pack's information
+func (ui *UI) createLevelTiles() {
+
+	pack := ui.game.pack
+	ui.levelTilesPack = pack
+	ui.levelTiles = nil
+	gui.Manager().SetKeyFocus(nil)
+	ui.levelSelectGrid.DisposeChildren(true)
+
+	info := pack.Title()
+	if pack.Manifest.Author != "" {
+		info += " by " + pack.Manifest.Author
+	}
+	if pack.Manifest.Difficulty != "" {
+		info += " (" + pack.Manifest.Difficulty + ")"
+	}
+	ui.packLabel.SetText(info)
+	ui.packPrevButton.SetVisible(len(ui.game.packs) > 1)
+	ui.packNextButton.SetVisible(len(ui.game.packs) > 1)
+	width := ui.levelSelectPanel.ContentWidth()
+	ui.packLabel.SetPosition(math32.Round((width-ui.packLabel.Width())/2), math32.Round((PACK_ROW_HEIGHT-ui.packLabel.Height())/2))
+	ui.packNextButton.SetPositionX(width - ui.packNextButton.Width())
+
+	vboxParams := gui.VBoxLayoutParams{Expand: 0, AlignH: gui.AlignCenter}
+
+	for i, level := range ui.game.levels {
+		n := i
+		tile := new(levelTile)
+		tile.panel = gui.NewPanel(LEVEL_TILE_WIDTH, LEVEL_TILE_HEIGHT)
+		tile.panel.SetBorders(2, 2, 2, 2)
+		tile.panel.SetPaddings(6, 6, 6, 6)
+		tile.panel.SetMargins(5, 5, 5, 5)
+		tile.panel.SetColor4(&tileColor)
+		layout := gui.NewVBoxLayout()
+		layout.SetSpacing(4)
+		tile.panel.SetLayout(layout)
+
+		tile.title = gui.NewLabel(fmt.Sprintf("Level %d", n+1))
+		tile.title.SetFontSize(20)
+		tile.title.SetColor(&math32.Color{1, 1, 1})
+		tile.title.SetLayoutParams(&vboxParams)
+		tile.title.SetEnabled(false)
+		tile.panel.Add(tile.title)
+
+		thumb := gui.NewImageFromRGBA(LevelThumbnail(level.data))
+		w, h := thumb.Width(), thumb.Height()
+		scale := math32.Min(THUMBNAIL_MAX_WIDTH/w, THUMBNAIL_MAX_HEIGHT/h)
+		thumb.SetSize(w*scale, h*scale)
+		thumb.SetLayoutParams(&vboxParams)
+		thumb.SetEnabled(false)
+		tile.panel.Add(thumb)
+
+		tile.difficulty = gui.NewLabel(pack.Files[i].Difficulty)
+		tile.difficulty.SetFontSize(16)
+		tile.difficulty.SetColor(&creditsColor)
+		tile.difficulty.SetLayoutParams(&vboxParams)
+		tile.difficulty.SetEnabled(false)
+		tile.panel.Add(tile.difficulty)
+
+		tile.status = gui.NewLabel("")
+		tile.status.SetFontSize(16)
+		tile.status.SetColor(&creditsColor)
+		tile.status.SetLayoutParams(&vboxParams)
+		tile.status.SetEnabled(false)
+		tile.panel.Add(tile.status)
+
+		tile.panel.Subscribe(gui.OnMouseUp, func(evname string, ev interface{}) {
+			if tile.locked {
+				return
+			}
+			ui.game.audio.click.Play()
+			ui.ShowLevelSelect(false)
+			ui.game.InitLevel(n)
+			ui.ToggleMenu()
+		})
+		tile.panel.Subscribe(gui.OnCursorEnter, func(evname string, ev interface{}) {
+			if tile.locked {
+				return
+			}
+			ui.game.audio.hover.Play()
+			tile.panel.SetColor4(&tileColorOver)
+		})
+		tile.panel.Subscribe(gui.OnCursorLeave, func(evname string, ev interface{}) {
+			tile.panel.SetColor4(&tileColor)
+		})
+
+		ui.levelTiles = append(ui.levelTiles, tile)
+		ui.levelSelectGrid.Add(tile.panel)
+	}
+
+	rows := (len(ui.levelTiles) + LEVEL_SELECT_COLUMNS - 1) / LEVEL_SELECT_COLUMNS
+	ui.levelSelectGrid.SetHeight(float32(rows) * (LEVEL_TILE_HEIGHT + 10))
+	ui.levelSelectBack.SetPosition(0, ui.levelSelectGrid.Position().Y+ui.levelSelectGrid.Height()+10)
+	ui.levelSelectPanel.SetContentHeight(ui.levelSelectBack.Position().Y + ui.levelSelectBack.Height())
+}
+
+// UpdateLevelTiles updates the locked/unlocked/completed state and records shown in each level tile
+func (ui *UI) UpdateLevelTiles() {
+
+	progress := ui.game.progress()
+	for i, tile := range ui.levelTiles {
+		rec := ui.game.userData.Record(ui.game.levels[i].id)
+		completed := i < progress.LastUnlockedLevel || rec.Completed()
+		tile.locked = i > progress.LastUnlockedLevel && !completed
+
+		switch {
+		case tile.locked:
+			tile.status.SetText("Locked")
+			tile.panel.SetBordersColor4(&tileBorderLocked)
+		case rec.Completed():
+			tile.status.SetText(fmt.Sprintf("Best: %d steps", rec.BestSteps))
+			tile.panel.SetBordersColor4(&tileBorderCompleted)
+		case completed:
+			tile.status.SetText("Completed")
+			tile.panel.SetBordersColor4(&tileBorderCompleted)
+		default:
+			tile.status.SetText("Unlocked")
+			tile.panel.SetBordersColor4(&tileBorderUnlocked)
+		}
+	}
+}
+
+// LevelThumbnail returns a small top-down image of the level layout, showing the topmost object of each column
+// Higher blocks are drawn lighter so that the height of the level can be seen
+func LevelThumbnail(ld *sim.LevelData) *image.RGBA {
+
+	nrows, ncols, nfloors := ld.Size()
+	cs := THUMBNAIL_CELL_SIZE
+	img := image.NewRGBA(image.Rect(0, 0, (ncols-2)*cs, (nrows-2)*cs))
+
+	// Skip the padding added around the level by ParseLevel
+	for z := 1; z < nrows-1; z++ {
+		for x := 1; x < ncols-1; x++ {
+			c := color.RGBA{0, 0, 0, 0}
+			for y := nfloors - 1; y >= 0; y-- {
+				cell := ld.Grid[z][x][y]
+				if cell == sim.NONE || cell == sim.ELEVATOR_SHAFT || cell.IsTile() {
+					continue
+				}
+				shade := uint8(90 + 120*y/nfloors)
+				switch cell {
+				case sim.BLOCK:
+					c = color.RGBA{shade, shade, shade, 255}
+				case sim.ICE:
+					c = color.RGBA{shade / 2, shade * 3 / 4, shade, 255}
+				case sim.CONVEYOR:
+					c = color.RGBA{shade / 2, shade / 2, shade / 2, 255}
+				case sim.BOX, sim.BOX_ON_PAD, sim.HEAVY_BOX, sim.HEAVY_ON_PAD, sim.FRAGILE_BOX, sim.FRAGILE_ON_PAD, sim.GLUED_BOX, sim.GLUED_ON_PAD:
+					c = color.RGBA{200, 60, 40, 255}
+				case sim.PAD:
+					c = color.RGBA{240, 220, 40, 255}
+				case sim.START, sim.START_ON_PAD:
+					c = color.RGBA{160, 225, 25, 255}
+				case sim.ELEVATOR:
+					c = color.RGBA{60, 90, 230, 255}
+				default:
+					c = color.RGBA{255, 0, 255, 255}
+					if cell.IsTeleporter() {
+						c = color.RGBA{180, 80, 255, 255}
+					} else if cell.IsPlate() || cell.IsGate() {
+						c = color.RGBA{230, 120, 60, 255}
+					}
+				}
+				break
+			}
+			for py := 0; py < cs; py++ {
+				for px := 0; px < cs; px++ {
+					img.SetRGBA((x-1)*cs+px, (z-1)*cs+py, c)
+				}
+			}
+		}
+	}
+
+	return img
+}
@@ -5,6 +5,7 @@
 package main
 
 import (
+	"github.com/danaugrs/gokoban/sim"
 	"github.com/g3n/engine/geometry"
 	"github.com/g3n/engine/graphic"
 	"github.com/g3n/engine/material"
@@ -17,16 +18,32 @@ type LevelStyle struct {
 	boxLightColorOn  *math32.Color
 	boxLightColorOff *math32.Color
 
-	blockMaterial    *material.Standard
-	boxMaterialRed   *material.Standard
-	boxMaterialGreen *material.Standard
-	padMaterial      *material.Standard
-	elevatorMaterial *material.Standard
-
-	makeBlock    func() *graphic.Mesh
-	makeRedBox   func() *graphic.Mesh
-	makeGreenBox func() *graphic.Mesh
-	makeElevator func() *graphic.Mesh
+	blockMaterial       *material.Standard
+	boxTints            []*math32.Color         // colors tinting the crates of each box type, indexed by sim.BoxType
+	boxMaterials        [][2]*material.Standard // materials of each box type off and on a pad, indexed by sim.BoxType
+	padMaterial         *material.Standard
+	elevatorMaterial    *material.Standard
+	iceMaterial         *material.Standard
+	conveyorMaterial    *material.Standard
+	beltArrowMaterial   *material.Standard // arrows on conveyor belts
+	oneWayArrowMaterial *material.Standard // arrows on one-way tiles
+
+	teleporterColors    []*math32.Color // one color per teleporter pair, repeating if there are more pairs
+	teleporterMaterials []*material.Standard
+
+	linkColors     []*math32.Color // one color per link between pressure plates and gates
+	plateMaterials []*material.Standard
+	gateMaterials  []*material.Standard
+
+	makeBlock      func() *graphic.Mesh
+	makeBox        func(t sim.BoxType, lit bool) *graphic.Mesh // red off a pad and green on one
+	makeElevator   func() *graphic.Mesh
+	makeIce        func() *graphic.Mesh
+	makeConveyor   func() *graphic.Mesh
+	makeTile       func(conveyor bool) *graphic.Mesh
+	makeTeleporter func(pair int) *graphic.Mesh
+	makePlate      func(link int) *graphic.Mesh
+	makeGate       func(link int) *graphic.Mesh
 }
 
 // NewStandardStyle returns a pointer to a LevelStyle object with standard values
@@ -49,20 +66,65 @@ func NewStandardStyle() *LevelStyle {
 	// Load textures and create materials
 
 	s.blockMaterial = material.NewStandard(math32.NewColor("white"))
-	s.blockMaterial.AddTexture(newTexture("./img/floor.png"))
+	s.blockMaterial.AddTexture(newTexture(Asset("img/floor.png")))
 
 	s.padMaterial = material.NewStandard(math32.NewColor("white"))
-	s.padMaterial.AddTexture(newTexture("./img/pad.png"))
+	s.padMaterial.AddTexture(newTexture(Asset("img/pad.png")))
 	s.padMaterial.SetTransparent(true) // Makes this material be displayed in front of blockMaterial
 
-	s.boxMaterialRed = material.NewStandard(math32.NewColor("white"))
-	s.boxMaterialRed.AddTexture(newTexture("./img/crate_red.png"))
-
-	s.boxMaterialGreen = material.NewStandard(math32.NewColor("white"))
-	s.boxMaterialGreen.AddTexture(newTexture("./img/crate_green2.png"))
+	// Heavy boxes are dark like iron, fragile ones are pale and see-through like glass and glued ones are amber
+	s.boxTints = []*math32.Color{
+		sim.BoxNormal:  {1, 1, 1},
+		sim.BoxHeavy:   {0.45, 0.45, 0.5},
+		sim.BoxFragile: {0.8, 0.95, 1},
+		sim.BoxGlued:   {1, 0.75, 0.35},
+	}
+	for t, tint := range s.boxTints {
+		var mats [2]*material.Standard
+		for i, path := range []string{"img/crate_red.png", "img/crate_green2.png"} {
+			mats[i] = material.NewStandard(tint)
+			mats[i].AddTexture(newTexture(Asset(path)))
+			if sim.BoxType(t) == sim.BoxFragile {
+				mats[i].SetOpacity(0.7)
+				mats[i].SetTransparent(true)
+			}
+		}
+		s.boxMaterials = append(s.boxMaterials, mats)
+	}
 
 	s.elevatorMaterial = material.NewStandard(math32.NewColor("white"))
-	s.elevatorMaterial.AddTexture(newTexture("./img/metal_diffuse.png"))
+	s.elevatorMaterial.AddTexture(newTexture(Asset("img/metal_diffuse.png")))
+
+	s.iceMaterial = material.NewStandard(math32.NewColor("white"))
+	s.iceMaterial.AddTexture(newTexture(Asset("img/ice.png")))
+	s.iceMaterial.SetShininess(60)
+
+	s.conveyorMaterial = material.NewStandard(&math32.Color{0.45, 0.45, 0.5})
+	s.conveyorMaterial.AddTexture(newTexture(Asset("img/metal_diffuse.png")))
+
+	s.beltArrowMaterial = material.NewStandard(&math32.Color{1, 0.8, 0.2})
+	s.beltArrowMaterial.SetSide(material.SideDouble)
+	s.oneWayArrowMaterial = material.NewStandard(&math32.Color{0.9, 0.9, 0.9})
+	s.oneWayArrowMaterial.SetSide(material.SideDouble)
+
+	s.teleporterColors = []*math32.Color{{0.7, 0.3, 1}, {0.2, 0.9, 0.9}, {1, 0.5, 0.1}, {1, 0.4, 0.7}}
+	for _, color := range s.teleporterColors {
+		mat := material.NewStandard(color)
+		mat.SetEmissiveColor(color)
+		s.teleporterMaterials = append(s.teleporterMaterials, mat)
+	}
+
+	s.linkColors = []*math32.Color{{0.95, 0.3, 0.3}, {0.3, 0.5, 1}, {0.3, 0.85, 0.4}, {0.95, 0.85, 0.3}}
+	for _, color := range s.linkColors {
+		plate := material.NewStandard(color)
+		s.plateMaterials = append(s.plateMaterials, plate)
+
+		gate := material.NewStandard(color)
+		gate.AddTexture(newTexture(Asset("img/metal_diffuse.png")))
+		gate.SetOpacity(0.85)
+		gate.SetTransparent(true)
+		s.gateMaterials = append(s.gateMaterials, gate)
+	}
 
 	// Create functions that return a cube mesh using the provided material, reusing the same cube geometry
 
@@ -72,9 +134,40 @@ func NewStandardStyle() *LevelStyle {
 	}
 
 	s.makeBlock = makeCubeWithMaterial(s.blockMaterial)
-	s.makeRedBox = makeCubeWithMaterial(s.boxMaterialRed)
-	s.makeGreenBox = makeCubeWithMaterial(s.boxMaterialGreen)
+	s.makeBox = func(t sim.BoxType, lit bool) *graphic.Mesh {
+		if lit {
+			return graphic.NewMesh(sharedCubeGeom, s.boxMaterials[t][1])
+		}
+		return graphic.NewMesh(sharedCubeGeom, s.boxMaterials[t][0])
+	}
 	s.makeElevator = makeCubeWithMaterial(s.elevatorMaterial)
+	s.makeIce = makeCubeWithMaterial(s.iceMaterial)
+	s.makeConveyor = makeCubeWithMaterial(s.conveyorMaterial)
+
+	// Directional tiles are flat arrows, yellow on conveyor belts
+	tileGeom := NewArrowGeometry(0.5)
+	s.makeTile = func(conveyor bool) *graphic.Mesh {
+		if conveyor {
+			return graphic.NewMesh(tileGeom, s.beltArrowMaterial)
+		}
+		return graphic.NewMesh(tileGeom, s.oneWayArrowMaterial)
+	}
+
+	// Teleporters are glowing rings, colored by pair
+	teleporterGeom := geometry.NewTorus(0.32, 0.05, 8, 32, 2*math32.Pi)
+	s.makeTeleporter = func(pair int) *graphic.Mesh {
+		return graphic.NewMesh(teleporterGeom, s.teleporterMaterials[pair%len(s.teleporterMaterials)])
+	}
+
+	// Pressure plates are thin slabs and gates are (almost) full cubes, colored by link
+	plateGeom := geometry.NewBox(0.7, 0.06, 0.7)
+	s.makePlate = func(link int) *graphic.Mesh {
+		return graphic.NewMesh(plateGeom, s.plateMaterials[link%len(s.plateMaterials)])
+	}
+	gateGeom := geometry.NewBox(0.94, 1, 0.94)
+	s.makeGate = func(link int) *graphic.Mesh {
+		return graphic.NewMesh(gateGeom, s.gateMaterials[link%len(s.gateMaterials)])
+	}
 
 	return s
 }
@@ -5,6 +5,7 @@
 package main
 
 import (
+	"github.com/danaugrs/gokoban/sim"
 	"github.com/g3n/engine/app"
 	"github.com/g3n/engine/audio"
 	"github.com/g3n/engine/camera"
@@ -23,7 +24,8 @@ import (
 
 	"flag"
 	"fmt"
-	"io/ioutil"
+	"os"
+	"path"
 	"strconv"
 	"time"
 )
@@ -39,7 +41,7 @@ const CREDITS_LINE1 string = "Open source game by Daniel Salvadori (github.com/d
 const CREDITS_LINE2 string = "Music by Eric Matyas (www.soundimage.org)."
 
 const INSTRUCTIONS_LINE1 string = "Click and drag to look around. Use the mouse wheel to zoom."
-const INSTRUCTIONS_LINE2 string = "Use WASD or the arrow keys to move the gopher relative to the camera."
+const INSTRUCTIONS_LINE2 string = "Use WASD or the arrow keys to move the gopher relative to the camera. Press U to undo and H for a hint."
 const INSTRUCTIONS_LINE3 string = "Push the box on top the yellow pad, Gopher!"
 const INSTRUCTIONS_LINE3_COMPLETE string = "Well done! Proceed to the next level by clicking on the top right corner."
 
@@ -56,15 +58,25 @@ type Gokoban struct {
 
 	levelScene *core.Node
 	levelStyle *LevelStyle
-	levels     []*Level
+	packs      []*Pack
+	pack       *Pack    // level pack being played
+	levels     []*Level // levels of the current pack
 	level      *Level
 	leveln     int
 
-	stepDelta    *math32.Vector2
-	gopherLocked bool
-	gopherNode   *core.Node
-	arrowNode    *core.Node
-	steps        int
+	stepDelta      *math32.Vector2
+	gopherLocked   bool
+	gopherNode     *core.Node
+	arrowNode      *core.Node
+	arrowMaterials [4]*material.Standard // materials of the arrows, indexed by ARROW_UP etc.
+	steps          int
+	pushes         int
+
+	// Replay being played back, if any
+	replayer *Replayer
+
+	// Level editor, if open
+	editor *Editor
 
 	// User interface
 	ui *UI
@@ -77,7 +89,10 @@ type Gokoban struct {
 func (g *Gokoban) RestartLevel(playSound bool) {
 	log.Debug("Restart Level")
 
-	firstLevel := g.leveln == 0
+	// Restarting ends the attempt being replayed
+	g.StopReplay()
+
+	firstLevel := g.leveln == 0 && !g.level.test
 
 	if firstLevel {
 		g.ui.instructions3.SetText(INSTRUCTIONS_LINE3)
@@ -90,8 +105,21 @@ func (g *Gokoban) RestartLevel(playSound bool) {
 	g.ui.instructionsMenu.SetVisible(firstLevel)
 	g.arrowNode.SetVisible(firstLevel)
 
-	g.levels[g.leveln].Restart(playSound)
+	g.level.Restart(playSound)
 	g.gopherLocked = false
+	g.ui.UpdateStatsLabel()
+}
+
+// PlayerRestart restarts the current level at the player's request, counting it in the level's records
+func (g *Gokoban) PlayerRestart() {
+	if g.editing() {
+		return
+	}
+	if g.counting() && g.level.started {
+		g.userData.Record(g.level.id).Restarts++
+		g.userData.Save()
+	}
+	g.RestartLevel(true)
 }
 
 // NextLevel loads the next level if exists
@@ -123,32 +151,141 @@ func (g *Gokoban) ToggleFullScreen() {
 func (g *Gokoban) Quit() {
 	log.Debug("Quit")
 
-	// Copy settings into user data and save
+	g.SaveUserData()
+
+	// Save the replay of the current attempt
+	g.level.SaveRecord()
+
+	// Close the window
+	g.Exit()
+}
+
+// SaveUserData copies the current settings into the user data and saves it
+func (g *Gokoban) SaveUserData() {
 	g.userData.SfxVol = g.ui.sfxSlider.Value()
 	g.userData.MusicVol = g.ui.musicSlider.Value()
+	g.userData.AnimScale = animationScale(g.ui.speedSlider.Value())
 	g.userData.FullScreen = g.IWindow.(*window.GlfwWindow).FullScreen()
 	g.userData.Save()
+}
 
-	// Close the window
-	g.Exit()
+// SwitchProfile saves the current profile and switches to the provided user data, applying its settings and progress
+func (g *Gokoban) SwitchProfile(ud *UserData) {
+	log.Debug("Switch Profile to %q", ud.Profile())
+
+	g.SaveUserData()
+	g.userData = ud
+	SetLastProfile(ud.Profile())
+
+	// Apply settings
+	g.ui.musicSlider.SetValue(ud.MusicVol)
+	g.ui.sfxSlider.SetValue(ud.SfxVol)
+	g.ui.speedSlider.SetValue(animationScaleValue(ud.AnimScale))
+	g.ui.UpdateMusicButton(ud.MusicOn)
+	g.ui.UpdateSfxButton(ud.SfxOn)
+	g.IWindow.(*window.GlfwWindow).SetFullScreen(ud.FullScreen)
+
+	// Apply progress
+	g.SelectPack(g.lastPack())
+	g.ui.UpdateProfileButton()
 }
 
 // onKey handles keyboard events for the game
 func (g *Gokoban) onKey(evname string, ev interface{}) {
 
 	kev := ev.(*window.KeyEvent)
+
+	// Keys typed into the profile name are not game controls
+	if g.ui.profileEditing {
+		if kev.Key == window.KeyEscape {
+			gui.Manager().SetKeyFocus(nil)
+		}
+		return
+	}
+
+	// Level editor controls
+	if g.editor != nil && !g.ui.inMenu && g.editor.onKey(kev) {
+		return
+	}
+
+	// Replay controls
+	if g.replayer != nil && !g.ui.inMenu {
+		switch kev.Key {
+		case window.KeySpace:
+			g.replayer.TogglePause()
+		case window.KeyRight:
+			g.replayer.Step()
+		case window.KeyUp:
+			g.replayer.Faster()
+		case window.KeyDown:
+			g.replayer.Slower()
+		case window.KeyU, window.KeyZ, window.KeyY:
+			return
+		}
+		g.ui.UpdateReplayLabel()
+	}
+
 	switch kev.Key {
 	case window.KeyEscape:
-		g.ui.ToggleMenu()
+		if g.ui.inLevelSelect {
+			g.ui.ShowLevelSelect(false)
+		} else if g.ui.inProfiles {
+			g.ui.ShowProfiles(false)
+		} else {
+			g.ui.ToggleMenu()
+		}
 	case window.KeyF:
 		g.ToggleFullScreen()
 	case window.KeyR:
 		if !g.ui.inMenu && g.steps > 0 {
-			g.RestartLevel(true)
+			g.PlayerRestart()
+		}
+	case window.KeyH:
+		g.Hint()
+	case window.KeyU:
+		g.Undo()
+	case window.KeyZ:
+		if kev.Mods&window.ModControl != 0 {
+			if kev.Mods&window.ModShift != 0 {
+				g.Redo()
+			} else {
+				g.Undo()
+			}
+		}
+	case window.KeyY:
+		if kev.Mods&window.ModControl != 0 {
+			g.Redo()
 		}
 	}
 }
 
+// onKeyUp handles keys being released
+func (g *Gokoban) onKeyUp(evname string, ev interface{}) {
+	if g.level != nil {
+		g.level.release(ev.(*window.KeyEvent).Key)
+	}
+}
+
+// Undo takes back the last gopher step of the current level
+func (g *Gokoban) Undo() {
+	if !g.ui.inMenu && g.replayer == nil && g.level.Undo() {
+		g.unlockAfterHistoryChange()
+	}
+}
+
+// Redo reapplies the last undone gopher step of the current level
+func (g *Gokoban) Redo() {
+	if !g.ui.inMenu && g.replayer == nil && g.level.Redo() {
+		g.unlockAfterHistoryChange()
+	}
+}
+
+// unlockAfterHistoryChange gives control back to the player in case the gopher had fallen out of the world
+func (g *Gokoban) unlockAfterHistoryChange() {
+	g.gopherLocked = false
+	g.arrowNode.SetVisible(g.leveln == 0 && !g.level.test)
+}
+
 // onMouse handles mouse events for the game
 func (g *Gokoban) onMouse(evname string, ev interface{}) {
 	mev := ev.(*window.MouseEvent)
@@ -161,7 +298,7 @@ func (g *Gokoban) onMouse(evname string, ev interface{}) {
 				g.arrowNode.SetVisible(true)
 			}
 		} else if evname == window.OnMouseUp {
-			g.arrowNode.SetVisible(false)
+			g.arrowNode.SetVisible(g.level.hint != nil)
 		}
 	}
 }
@@ -192,23 +329,42 @@ func (g *Gokoban) onCursor(evname string, ev interface{}) {
 		}
 	}
 
+	// The hinted direction may now be pointed to by another arrow
+	g.UpdateHintArrow()
 }
 
 // LevelComplete updates and saves user data, enables the next button if appropriate, and checks for game completion
 func (g *Gokoban) LevelComplete() {
 	log.Debug("Level Complete")
 
+	// Levels being play-tested in the editor don't count towards the player's progress
+	if g.level.test {
+		g.editor.setStatus("Solved in " + strconv.Itoa(g.steps) + " steps - press P to go back to editing")
+		return
+	}
+
 	if g.leveln == 0 {
 		g.ui.instructions3.SetText(INSTRUCTIONS_LINE3_COMPLETE)
 	}
 
-	if g.userData.LastUnlockedLevel == g.leveln {
-		g.userData.LastUnlockedLevel++
+	// Update the level's records unless a replay completed it
+	if g.counting() {
+		g.userData.Record(g.level.id).AddCompletion(g.steps, g.pushes, g.level.playTime)
 		g.userData.Save()
-		if g.userData.LastUnlockedLevel < len(g.levels) {
+		g.ui.UpdateStatsLabel()
+		if g.level.record != nil {
+			log.Info("Solution in LURD notation: %v", sim.FormatLURD(g.level.record.History(g.level.data)))
+		}
+	}
+
+	progress := g.progress()
+	if progress.LastUnlockedLevel == g.leveln {
+		progress.LastUnlockedLevel++
+		g.userData.Save()
+		if progress.LastUnlockedLevel < len(g.levels) {
 			g.ui.nextButton.SetEnabled(true)
 		}
-		if g.userData.LastUnlockedLevel == len(g.levels) {
+		if progress.LastUnlockedLevel == len(g.levels) {
 			g.GameCompleted()
 		}
 	}
@@ -220,31 +376,41 @@ func (g *Gokoban) GameCompleted() {
 
 	g.audio.musicGame.Stop()
 	g.audio.gameComplete.Play()
-	g.ui.titleImage.SetImage(gui.ButtonDisabled, "./gui/title3_completed.png")
+	g.ui.titleImage.SetImage(gui.ButtonDisabled, Asset("gui/title3_completed.png"))
 }
 
 // InitLevel initializes the level associated to the provided index
 func (g *Gokoban) InitLevel(n int) {
 	log.Debug("Initializing Level %v", n+1)
 
+	g.closeEditor()
+
 	// Always enable the button to return to the previous level except when we are in the very first level
 	g.ui.prevButton.SetEnabled(n != 0)
 
 	// The button to go to the next level has 3 different states: disabled, locked and enabled
 	// If this is the very last level - disable it completely
 	if n == len(g.levels)-1 {
-		g.ui.nextButton.SetImage(gui.ButtonDisabled, "./gui/right_disabled2.png")
+		g.ui.nextButton.SetImage(gui.ButtonDisabled, Asset("gui/right_disabled2.png"))
 		g.ui.nextButton.SetEnabled(false)
 	} else {
-		g.ui.nextButton.SetImage(gui.ButtonDisabled, "./gui/right_disabled_locked.png")
+		g.ui.nextButton.SetImage(gui.ButtonDisabled, Asset("gui/right_disabled_locked.png"))
 		// check last completed level
-		if g.userData.LastUnlockedLevel == n {
+		if g.progress().LastUnlockedLevel == n {
 			g.ui.nextButton.SetEnabled(false)
 		} else {
 			g.ui.nextButton.SetEnabled(true)
 		}
 	}
 
+	// Stop any replay and save the attempt of the level being left
+	g.StopReplay()
+	if g.level != nil {
+		g.level.SaveRecord()
+		g.level.stopEffects()
+		g.level.cancelHint()
+	}
+
 	// Remove level.scene from levelScene and unsubscribe from events
 	if len(g.levelScene.Children()) > 0 {
 		g.levelScene.Remove(g.level.scene)
@@ -253,7 +419,7 @@ func (g *Gokoban) InitLevel(n int) {
 
 	// Update current level index and level reference
 	g.leveln = n
-	g.userData.LastLevel = n
+	g.progress().LastLevel = n
 	g.level = g.levels[g.leveln]
 
 	g.RestartLevel(false)
@@ -269,42 +435,102 @@ func (g *Gokoban) InitLevel(n int) {
 	g.SubscribeID(window.OnKeyDown, g.leveln, g.level.onKey)
 }
 
-// LoadLevels reads and parses the level files inside ./levels, building an array of Level objects
-func (g *Gokoban) LoadLevels() {
-	log.Debug("Load Levels")
-
-	files, _ := ioutil.ReadDir("./levels")
-	g.levels = make([]*Level, len(files)-1)
+// LoadPacks reads the level packs at the provided paths and parses their level files
+// Invalid packs and level files are reported and skipped
+func (g *Gokoban) LoadPacks(paths []string) {
+	log.Debug("Load Packs")
 
-	for i, f := range files {
+	for _, p := range paths {
+		pack, err := LoadPack(p)
+		if err != nil {
+			log.Error("Skipping level pack %v: %v", p, err)
+			continue
+		}
+		if g.findPack(pack.ID) != nil {
+			log.Error("Skipping level pack %v: there is already a pack named %v", p, pack.ID)
+			continue
+		}
 
-		// Skip README.md
-		if f.Name() == "README.md" {
+		// Keep the valid level files
+		files := make([]PackFile, 0, len(pack.Files))
+		for _, f := range pack.Files {
+			ld, err := sim.ParseLevel(f.Source)
+			if err != nil {
+				log.Error("Skipping invalid level file %v in %v:\n%v", f.Name, p, err)
+				continue
+			}
+			files = append(files, f)
+			pack.data = append(pack.data, ld)
+		}
+		pack.Files = files
+		if len(files) == 0 {
+			log.Error("Skipping level pack %v: it has no valid level files", p)
 			continue
 		}
 
-		log.Debug("Reading level file: %v as level %v", f.Name(), i+1)
+		log.Debug("Loaded level pack %v with %v levels", pack.ID, len(files))
+		g.packs = append(g.packs, pack)
+	}
+}
 
-		// Read level text file
-		b, err := ioutil.ReadFile("./levels/" + f.Name())
-		if err != nil {
-			fmt.Print(err)
+// findPack returns the loaded level pack with the provided ID, or nil if there is no such pack
+func (g *Gokoban) findPack(id string) *Pack {
+	for _, pack := range g.packs {
+		if pack.ID == id {
+			return pack
 		}
-		str := string(b) // convert content to a 'string'
+	}
+	return nil
+}
 
-		log.Debug("Parsing level " + strconv.Itoa(i+1))
+// lastPack returns the level pack the player played last, or the first pack if it isn't loaded
+func (g *Gokoban) lastPack() *Pack {
+	if pack := g.findPack(g.userData.LastPack); pack != nil {
+		return pack
+	}
+	return g.packs[0]
+}
 
-		// Parse level data
-		ld, errParse := ParseLevel(str)
-		if errParse != nil {
-			panic(errParse)
-		}
+// SelectPack makes the provided level pack the current one and initializes the level the player was at
+// The levels of a pack are built the first time it is played
+func (g *Gokoban) SelectPack(pack *Pack) {
+	log.Debug("Select Pack %v", pack.ID)
 
-		log.Debug("Building level " + strconv.Itoa(i+1))
+	if pack.levels == nil {
+		for i, f := range pack.Files {
+			log.Debug("Building level %v of %v", i+1, pack.ID)
+			pack.levels = append(pack.levels, NewLevel(g, path.Base(f.Name), f.Source, pack.data[i], g.levelStyle))
+		}
+	}
+	g.pack = pack
+	g.levels = pack.levels
+	g.userData.LastPack = pack.ID
+
+	// Check if user already completed all levels of the pack
+	progress := g.progress()
+	if progress.LastUnlockedLevel >= len(g.levels) {
+		g.ui.titleImage.SetImage(gui.ButtonDisabled, Asset("gui/title3_completed.png"))
+	} else {
+		g.ui.titleImage.SetImage(gui.ButtonDisabled, Asset("gui/title3.png"))
+	}
 
-		// Build level
-		g.levels[i] = NewLevel(g, ld, g.levelStyle)
+	lastLevel := progress.LastLevel
+	if lastLevel >= len(g.levels) {
+		lastLevel = 0
 	}
+	g.InitLevel(lastLevel)
+	g.gopherLocked = true
+}
+
+// counting returns whether the player is playing the current level themselves, so that it counts in their records
+// i.e. not watching a replay or play-testing a level in the editor
+func (g *Gokoban) counting() bool {
+	return g.replayer == nil && !g.level.test
+}
+
+// progress returns the player's progress in the current level pack
+func (g *Gokoban) progress() *PackProgress {
+	return g.userData.Progress(g.pack.ID)
 }
 
 // LoadSkybox loads the space skybox and adds it to the scene
@@ -312,7 +538,7 @@ func (g *Gokoban) LoadSkyBox() {
 	log.Debug("Creating Skybox...")
 
 	// Load skybox textures
-	skyboxData := graphic.SkyboxData{"./img/skybox/", "jpg", [6]string{"px", "nx", "py", "ny", "pz", "nz"}}
+	skyboxData := graphic.SkyboxData{Asset("img/skybox") + "/", "jpg", [6]string{"px", "nx", "py", "ny", "pz", "nz"}}
 	skybox, err := graphic.NewSkybox(skyboxData)
 	if err != nil {
 		panic(err)
@@ -327,7 +553,7 @@ func (g *Gokoban) LoadGopher() {
 	log.Debug("Decoding gopher model...")
 
 	// Decode model in OBJ format
-	dec, err := obj.Decode("./gopher/gopher.obj", "./gopher/gopher.mtl")
+	dec, err := obj.Decode(Asset("gopher/gopher.obj"), Asset("gopher/gopher.mtl"))
 	if err != nil {
 		panic(err.Error())
 	}
@@ -389,30 +615,35 @@ func (g *Gokoban) CreateArrowNode() {
 
 	g.arrowNode = core.NewNode()
 	arrowGeom := NewArrowGeometry(0.5)
-	arrowMaterial := material.NewStandard(&math32.Color{0.628, 0.882, 0.1})
-	arrowMaterial.SetSide(material.SideDouble)
 
-	arrowMesh := graphic.NewMesh(arrowGeom, arrowMaterial)
+	// Each arrow has its own material so that the one pointing to a hint can be tinted
+	for i := range g.arrowMaterials {
+		g.arrowMaterials[i] = material.NewStandard(&arrowColor)
+		g.arrowMaterials[i].SetSide(material.SideDouble)
+	}
+
+	arrowMesh := graphic.NewMesh(arrowGeom, g.arrowMaterials[ARROW_UP])
 	arrowMesh.SetScale(0.2, 0.2, 1)
 	arrowMesh.SetPosition(0, 0.6, 0)
 	arrowMesh.SetRotationX(-math32.Pi / 2)
 	g.arrowNode.Add(arrowMesh)
 
-	arrowMeshLeft := graphic.NewMesh(arrowGeom, arrowMaterial)
+	// The side arrows are named from the gopher's point of view - the left one points to the right of the camera
+	arrowMeshLeft := graphic.NewMesh(arrowGeom, g.arrowMaterials[ARROW_RIGHT])
 	arrowMeshLeft.SetScale(0.1, 0.1, 1)
 	arrowMeshLeft.SetPosition(0, 0.6, 0)
 	arrowMeshLeft.SetRotationX(-math32.Pi / 2)
 	arrowMeshLeft.SetRotationY(-math32.Pi / 2)
 	g.arrowNode.Add(arrowMeshLeft)
 
-	arrowMeshRight := graphic.NewMesh(arrowGeom, arrowMaterial)
+	arrowMeshRight := graphic.NewMesh(arrowGeom, g.arrowMaterials[ARROW_LEFT])
 	arrowMeshRight.SetScale(0.1, 0.1, 1)
 	arrowMeshRight.SetPosition(0, 0.6, 0)
 	arrowMeshRight.SetRotationX(-math32.Pi / 2)
 	arrowMeshRight.SetRotationY(math32.Pi / 2)
 	g.arrowNode.Add(arrowMeshRight)
 
-	arrowMeshBack := graphic.NewMesh(arrowGeom, arrowMaterial)
+	arrowMeshBack := graphic.NewMesh(arrowGeom, g.arrowMaterials[ARROW_DOWN])
 	arrowMeshBack.SetScale(0.1, 0.1, 1)
 	arrowMeshBack.SetPosition(0, 0.6, 0)
 	arrowMeshBack.SetRotationX(-math32.Pi / 2)
@@ -462,27 +693,27 @@ func (g *Gokoban) CreateArrowNode() {
 	arrowMeshBackB.SetRotationY(2 * math32.Pi / 2)
 	g.arrowNode.Add(arrowMeshBackB)
 
-	arrowMeshBB := graphic.NewMesh(arrowGeom, arrowMaterial)
+	arrowMeshBB := graphic.NewMesh(arrowGeom, g.arrowMaterials[ARROW_UP])
 	arrowMeshBB.SetScale(0.2, 0.2, 1)
 	arrowMeshBB.SetPosition(0, 0.598, 0)
 	arrowMeshBB.SetRotationX(-math32.Pi / 2)
 	g.arrowNode.Add(arrowMeshBB)
 
-	arrowMeshLeftBB := graphic.NewMesh(arrowGeom, arrowMaterial)
+	arrowMeshLeftBB := graphic.NewMesh(arrowGeom, g.arrowMaterials[ARROW_RIGHT])
 	arrowMeshLeftBB.SetScale(0.1, 0.1, 1)
 	arrowMeshLeftBB.SetPosition(0, 0.598, 0)
 	arrowMeshLeftBB.SetRotationX(-math32.Pi / 2)
 	arrowMeshLeftBB.SetRotationY(-math32.Pi / 2)
 	g.arrowNode.Add(arrowMeshLeftBB)
 
-	arrowMeshRightBB := graphic.NewMesh(arrowGeom, arrowMaterial)
+	arrowMeshRightBB := graphic.NewMesh(arrowGeom, g.arrowMaterials[ARROW_LEFT])
 	arrowMeshRightBB.SetScale(0.1, 0.1, 1)
 	arrowMeshRightBB.SetPosition(0, 0.598, 0)
 	arrowMeshRightBB.SetRotationX(-math32.Pi / 2)
 	arrowMeshRightBB.SetRotationY(math32.Pi / 2)
 	g.arrowNode.Add(arrowMeshRightBB)
 
-	arrowMeshBackBB := graphic.NewMesh(arrowGeom, arrowMaterial)
+	arrowMeshBackBB := graphic.NewMesh(arrowGeom, g.arrowMaterials[ARROW_DOWN])
 	arrowMeshBackBB.SetScale(0.1, 0.1, 1)
 	arrowMeshBackBB.SetPosition(0, 0.598, 0)
 	arrowMeshBackBB.SetRotationX(-math32.Pi / 2)
@@ -508,6 +739,11 @@ func main() {
 
 	// Parse command line flags
 	oDebug := flag.Bool("debug", false, "display the debug log and check OpenGL errors")
+	oReplay := flag.String("replay", "", "play back the provided replay file")
+	var oLevels packList
+	flag.Var(&oLevels, "levels", "play the level pack (directory or zip archive) at the provided path - can be repeated (default: the included levels and the packs in the user's packs directory)")
+	oProfile := flag.String("profile", "", "play as the provided profile, creating it if necessary (default: the last used profile)")
+	oAssets := flag.String("assets", "", "load assets from the provided directory first, falling back to the included assets (default: the assets directory inside the user data directory)")
 	flag.Parse()
 
 	// Create logger
@@ -519,6 +755,32 @@ func main() {
 	} else {
 		log.SetLevel(logger.INFO)
 	}
+
+	// Run command line tools (e.g. "gokoban solve levels/12.txt") without opening a window
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(flag.Args()))
+	}
+
+	if *oProfile != "" {
+		if err := ValidateProfileName(*oProfile); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid profile %q: %v\n", *oProfile, err)
+			os.Exit(2)
+		}
+	}
+
+	// Extract the included assets and look for replaced ones
+	InitAssets(*oAssets)
+
+	// Play the provided level packs, or the included levels and the packs the player added
+	packPaths := []string(oLevels)
+	if len(packPaths) == 0 {
+		packPaths = []string{Asset(DEFAULT_PACK_ASSET)}
+		if dir, err := UserPacksDir(); err == nil {
+			paths, _ := FindPacks(dir)
+			packPaths = append(packPaths, paths...)
+		}
+	}
+
 	log.Info("Initializing Gokoban")
 
 	// Create Gokoban instance and initialize the G3N application
@@ -533,8 +795,16 @@ func main() {
 		g.Gls().SetCheckErrors(false)
 	}
 
-	// Load or create user data file
-	g.userData = LoadOrCreateUserData()
+	// Load or create the user data of the selected profile
+	profile := LastProfile()
+	if *oProfile != "" {
+		profile = *oProfile
+		if existing, ok := findProfile(profile); ok {
+			profile = existing
+		}
+	}
+	g.userData = LoadProfile(profile)
+	SetLastProfile(profile)
 
 	// Change to full screen if user prefers it
 	g.IWindow.(*window.GlfwWindow).SetFullScreen(g.userData.FullScreen)
@@ -607,28 +877,37 @@ func main() {
 	g.LoadGopher()
 	g.CreateArrowNode()
 
-	// Load all levels
-	g.LoadLevels()
+	// Load all level packs
+	g.LoadPacks(packPaths)
+	if len(g.packs) == 0 {
+		panic("no level packs could be loaded")
+	}
 
 	// Subscribe window to events
 	g.Subscribe(window.OnKeyDown, g.onKey)
+	g.Subscribe(window.OnKeyUp, g.onKeyUp)
 	g.Subscribe(window.OnMouseUp, g.onMouse)
 	g.Subscribe(window.OnMouseDown, g.onMouse)
 	g.Subscribe(window.OnCursor, g.onCursor)
 	g.Subscribe(window.OnWindowSize, func(evname string, ev interface{}) { g.OnWindowResize() })
 
-	// Check if user already completed all levels
-	if g.userData.LastUnlockedLevel == len(g.levels) {
-		g.ui.titleImage.SetImage(gui.ButtonDisabled, "./gui/title3_completed.png")
-	}
-
 	// Trigger window resize to recompute UI
 	g.OnWindowResize()
 
 	// Done Loading - hide the loading label, show the menu, and initialize the level
 	g.ui.loadingLabel.SetVisible(false)
-	g.InitLevel(g.userData.LastLevel)
-	g.gopherLocked = true
+	g.SelectPack(g.lastPack())
+
+	// Play back the replay provided on the command line
+	if *oReplay != "" {
+		r, err := LoadReplay(*oReplay)
+		if err == nil {
+			err = g.StartReplay(r)
+		}
+		if err != nil {
+			log.Error("Error playing replay %v: %v", *oReplay, err)
+		}
+	}
 
 	// Start the render loop
 	log.Info("Starting Render Loop")
@@ -638,9 +917,20 @@ func main() {
 // Update wlll called every frame
 func (g *Gokoban) Update(rend *renderer.Renderer, deltaTime time.Duration) {
 
-	// Update the current level if any
+	// Update the current level if any, playing back the replay (if any) at its speed
 	if g.level != nil {
-		g.level.Update(deltaTime.Seconds())
+		timeDelta := deltaTime.Seconds()
+		if g.replayer != nil {
+			timeDelta *= g.replayer.Speed()
+			g.replayer.Update(timeDelta)
+		}
+		g.level.Update(timeDelta)
+		g.updateHint()
+
+		// Time the current attempt from its first step until completion
+		if !g.ui.inMenu && g.counting() && g.level.started && !g.level.state.Complete() {
+			g.level.playTime += deltaTime
+		}
 	}
 
 	// Clear the color, depth, and stencil buffers
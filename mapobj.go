@@ -5,34 +5,44 @@
 package main
 
 import (
+	"github.com/danaugrs/gokoban/sim"
 	"github.com/g3n/engine/core"
 	"github.com/g3n/engine/graphic"
 	"github.com/g3n/engine/light"
+	"github.com/g3n/engine/math32"
 )
 
 // MapObj describes the bare minimum needed by a game object that occupies a grid cell
+// Its properties are those of the simulation object it shows, if it shows one
 type MapObj struct {
 	*core.Node
-	loc      GridLoc
-	pushable bool
+	loc sim.GridLoc
+	obj sim.Obj // the simulation object shown, or none for scenery (see Level.mapObj)
 }
 
-func (mo *MapObj) Location() GridLoc {
+func (mo *MapObj) Location() sim.GridLoc {
 	return mo.loc
 }
 
-func (mo *MapObj) SetLocation(l GridLoc) {
+func (mo *MapObj) SetLocation(l sim.GridLoc) {
 	mo.loc = l
 }
 
+// Obj returns the simulation object shown by the game object
+func (mo *MapObj) Obj() sim.Obj {
+	return mo.obj
+}
+
+// IsPushable returns whether the object can be pushed or carried (see sim.Obj.IsPushable)
 func (mo *MapObj) IsPushable() bool {
-	return mo.pushable
+	return mo.obj.IsPushable()
 }
 
 type IMapObj interface {
 	core.INode
-	Location() GridLoc
-	SetLocation(GridLoc)
+	Location() sim.GridLoc
+	SetLocation(sim.GridLoc)
+	Obj() sim.Obj
 	IsPushable() bool
 }
 
@@ -41,19 +51,27 @@ type Box struct {
 	MapObj
 	mesh  *graphic.Mesh
 	light *light.Point
+	kind  sim.BoxType
 }
 
-func NewBox(loc GridLoc) *Box {
+// NewBox returns a pointer to a new Box showing the box with the provided index and type in the simulation
+func NewBox(loc sim.GridLoc, index int, kind sim.BoxType) *Box {
 	b := new(Box)
 	b.loc = loc
-	b.pushable = true
+	b.obj = sim.Obj{Kind: sim.ObjBox, Index: index}
+	b.kind = kind
 	return b
 }
 
+// Type returns the type of the box, which decides how it can be moved
+func (b *Box) Type() sim.BoxType {
+	return b.kind
+}
+
 func (b *Box) SetMeshAndLight(mesh *graphic.Mesh, light *light.Point) {
 	b.mesh = mesh
 	b.Node = &mesh.Node
-	mesh.SetPositionVec(b.loc.Vec3())
+	mesh.SetPositionVec(gridVec3(b.loc))
 	b.light = light
 	b.Add(light)
 }
@@ -64,17 +82,16 @@ type Block struct {
 	mesh *graphic.Mesh
 }
 
-func NewBlock(loc GridLoc) *Block {
+func NewBlock(loc sim.GridLoc) *Block {
 	b := new(Block)
 	b.loc = loc
-	b.pushable = false
 	return b
 }
 
 func (b *Block) SetMesh(mesh *graphic.Mesh) {
 	b.mesh = mesh
 	b.Node = &mesh.Node
-	mesh.SetPositionVec(b.loc.Vec3())
+	mesh.SetPositionVec(gridVec3(b.loc))
 }
 
 // Elevator
@@ -85,10 +102,10 @@ type Elevator struct {
 	high int
 }
 
-func NewElevator(loc GridLoc, low, high int) *Elevator {
+func NewElevator(loc sim.GridLoc, index, low, high int) *Elevator {
 	b := new(Elevator)
 	b.loc = loc
-	b.pushable = false
+	b.obj = sim.Obj{Kind: sim.ObjElevator, Index: index}
 	b.low = low
 	b.high = high
 	return b
@@ -97,40 +114,132 @@ func NewElevator(loc GridLoc, low, high int) *Elevator {
 func (b *Elevator) SetMesh(mesh *graphic.Mesh) {
 	b.mesh = mesh
 	b.Node = &mesh.Node
-	mesh.SetPositionVec(b.loc.Vec3())
+	mesh.SetPositionVec(gridVec3(b.loc))
 }
 
-// Gopher
-type Gopher struct {
+// Teleporter
+type Teleporter struct {
 	MapObj
+	mesh *graphic.Mesh
+	pair int // position of the pair's digit in sim.TELEPORTERS, which picks its color
 }
 
-func NewGopher(loc GridLoc) *Gopher {
-	g := new(Gopher)
+func NewTeleporter(loc sim.GridLoc, pair int) *Teleporter {
+	t := new(Teleporter)
+	t.loc = loc
+	t.pair = pair
+	return t
+}
+
+// SetMesh sets the mesh of the teleporter, lying on the bottom of its cell
+func (t *Teleporter) SetMesh(mesh *graphic.Mesh) {
+	t.mesh = mesh
+	t.Node = &mesh.Node
+	mesh.SetPositionVec(gridVec3(t.loc))
+	mesh.SetPositionY(float32(t.loc.Y) - 0.45)
+	mesh.SetRotationX(-math32.Pi / 2)
+}
+
+// Plate
+type Plate struct {
+	MapObj
+	mesh *graphic.Mesh
+}
+
+func NewPlate(loc sim.GridLoc) *Plate {
+	p := new(Plate)
+	p.loc = loc
+	return p
+}
+
+// SetMesh sets the mesh of the pressure plate, lying on the bottom of its cell
+func (p *Plate) SetMesh(mesh *graphic.Mesh) {
+	p.mesh = mesh
+	p.Node = &mesh.Node
+	mesh.SetPositionVec(gridVec3(p.loc))
+	mesh.SetPositionY(float32(p.loc.Y) - 0.47)
+}
+
+// Gate
+// Its mesh is inside a node of its own, so that it can be lowered into the floor when the gate opens
+type Gate struct {
+	MapObj
+	mesh *graphic.Mesh
+}
+
+// NewGate returns a pointer to a new Gate showing the gate with the provided index in the simulation,
+// or a gate that isn't simulated (e.g. in the editor) if the index is negative
+func NewGate(loc sim.GridLoc, index int) *Gate {
+	g := new(Gate)
 	g.loc = loc
-	g.pushable = true
+	if index >= 0 {
+		g.obj = sim.Obj{Kind: sim.ObjGate, Index: index}
+	}
+	g.Node = core.NewNode()
+	g.SetPositionVec(gridVec3(loc))
 	return g
 }
 
-func (b *Gopher) SetNode(node *core.Node) {
-	b.Node = node
+func (g *Gate) SetMesh(mesh *graphic.Mesh) {
+	g.mesh = mesh
+	g.Add(mesh)
+}
+
+// SetOpen shows the gate lowered into the floor if it is open, and standing otherwise
+func (g *Gate) SetOpen(open bool) {
+	g.mesh.SetScaleVec(gateScale(open))
+	g.mesh.SetPositionY(-0.5 * (1 - gateScale(open).Y))
+}
+
+// gateScale returns the scale of the mesh of an open or closed gate
+func gateScale(open bool) *math32.Vector3 {
+	if open {
+		return &math32.Vector3{1, 0.05, 1}
+	}
+	return &math32.Vector3{1, 1, 1}
 }
 
-// Pad
-type Pad struct {
+// Tile is the arrow of a conveyor belt or one-way tile
+type Tile struct {
 	MapObj
 	mesh *graphic.Mesh
+	dir  sim.Dir
 }
 
-func NewPad(loc GridLoc) *Pad {
-	b := new(Pad)
-	b.loc = loc
-	b.pushable = false
-	return b
+func NewTile(loc sim.GridLoc, dir sim.Dir) *Tile {
+	t := new(Tile)
+	t.loc = loc
+	t.dir = dir
+	return t
 }
 
-func (b *Pad) SetMesh(mesh *graphic.Mesh) {
-	b.mesh = mesh
-	b.Node = &mesh.Node
-	mesh.SetPositionVec(b.loc.Vec3())
+// SetMesh sets the mesh of the tile, an arrow lying on the bottom of its cell pointing the tile's way
+func (t *Tile) SetMesh(mesh *graphic.Mesh) {
+	t.mesh = mesh
+	t.Node = &mesh.Node
+	// The arrow points along +X from its origin and is 2 long, so scaled down it starts 0.3 behind the center
+	pos := gridVec3(t.loc)
+	pos.X -= 0.3 * float32(t.dir.X)
+	pos.Z -= 0.3 * float32(t.dir.Z)
+	pos.Y -= 0.47
+	mesh.SetPositionVec(pos)
+	mesh.SetScale(0.3, 0.4, 1)
+	mesh.SetRotationX(-math32.Pi / 2)
+	mesh.SetRotationY(math32.Atan2(-float32(t.dir.Z), float32(t.dir.X)))
+}
+
+// Gopher
+type Gopher struct {
+	MapObj
+}
+
+func NewGopher(loc sim.GridLoc) *Gopher {
+	g := new(Gopher)
+	g.loc = loc
+	g.obj = sim.Obj{Kind: sim.ObjGopher}
+	return g
+}
+
+func (b *Gopher) SetNode(node *core.Node) {
+	b.Node = node
 }
@@ -0,0 +1,284 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/danaugrs/gokoban/sim"
+
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The asset directory of the level pack that comes with the game (see Asset)
+const DEFAULT_PACK_ASSET string = "levels"
+
+// The directory (inside the user data directory) where the player can add level packs
+const PACKS_DIRNAME string = "packs"
+
+// The name of the optional file describing a level pack
+const PACK_MANIFEST_FILENAME string = "pack.json"
+
+// The extension of level files - other files in a level pack are ignored, except for puzzles in standard Sokoban formats
+const LEVEL_FILE_EXT string = ".txt"
+
+// The extensions of files with puzzles in standard Sokoban formats, which are converted when read (see ReadLevelFile)
+var IMPORT_FILE_EXTS = []string{".xsb", ".sok", ".slc"}
+
+// PackManifest describes a level pack
+// All fields are optional - by default the title is the name of the pack and it contains all of its level files sorted by name
+type PackManifest struct {
+	Title       string      `json:"title"`
+	Author      string      `json:"author"`
+	Description string      `json:"description"`
+	Difficulty  string      `json:"difficulty"` // overall difficulty of the pack e.g. "easy"
+	Levels      []PackLevel `json:"levels"`     // level files in the order they are played
+}
+
+// PackLevel is an entry in the manifest of a level pack
+type PackLevel struct {
+	File       string `json:"file"`                 // path of the level file inside the pack
+	Difficulty string `json:"difficulty,omitempty"` // difficulty of the level e.g. "hard"
+	Solution   string `json:"solution,omitempty"`   // a solution in LURD notation e.g. from gokoban generate
+}
+
+// PackFile is a level file read from a level pack
+type PackFile struct {
+	Name       string // path of the file inside the pack
+	Source     string // contents of the file
+	Difficulty string
+}
+
+// Pack is a collection of levels read from a directory or a zip archive
+type Pack struct {
+	ID       string // name of the directory or archive (without extension), used to keep the player's progress
+	Path     string
+	Manifest PackManifest
+	Files    []PackFile
+
+	data   []*sim.LevelData // parsed level files (see Gokoban.LoadPacks)
+	levels []*Level         // built the first time the pack is played
+}
+
+// Title returns the title of the pack, which defaults to its ID
+func (p *Pack) Title() string {
+	if p.Manifest.Title != "" {
+		return p.Manifest.Title
+	}
+	return p.ID
+}
+
+// IsPack returns whether the provided path looks like a level pack i.e. is a directory or a zip archive
+func IsPack(p string) bool {
+	info, err := os.Stat(p)
+	if err != nil {
+		return false
+	}
+	return info.IsDir() || strings.EqualFold(filepath.Ext(p), ".zip")
+}
+
+// LoadPack reads the manifest and level files of the level pack at the provided path (a directory or a zip archive)
+func LoadPack(p string) (*Pack, error) {
+
+	pack := new(Pack)
+	pack.Path = p
+	pack.ID = filepath.Base(filepath.Clean(p))
+
+	var fsys fs.FS
+	if strings.EqualFold(filepath.Ext(p), ".zip") {
+		pack.ID = strings.TrimSuffix(pack.ID, filepath.Ext(p))
+		zr, err := zip.OpenReader(p)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		fsys = packRoot(zr)
+	} else {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("%v is neither a directory nor a zip archive", p)
+		}
+		fsys = os.DirFS(p)
+	}
+
+	// Read the manifest, if any
+	data, err := fs.ReadFile(fsys, PACK_MANIFEST_FILENAME)
+	if err == nil {
+		err = json.Unmarshal(data, &pack.Manifest)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", PACK_MANIFEST_FILENAME, err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	// Without a list of levels in the manifest, all level files are played in order of their names
+	levels := pack.Manifest.Levels
+	if len(levels) == 0 {
+		entries, err := fs.ReadDir(fsys, ".")
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if !e.IsDir() && IsLevelFile(e.Name()) {
+				levels = append(levels, PackLevel{File: e.Name()})
+			}
+		}
+		sort.Slice(levels, func(i, j int) bool { return naturalLess(levels[i].File, levels[j].File) })
+	}
+
+	for _, l := range levels {
+		data, err := fs.ReadFile(fsys, l.File)
+		if err != nil {
+			return nil, err
+		}
+		files, err := ReadLevelFile(l.File, data)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", l.File, err)
+		}
+		for _, f := range files {
+			f.Difficulty = l.Difficulty
+			pack.Files = append(pack.Files, f)
+		}
+	}
+	if len(pack.Files) == 0 {
+		return nil, fmt.Errorf("%v has no level files", p)
+	}
+	return pack, nil
+}
+
+// IsLevelFile returns whether the provided file name has the extension of a level file or of a file with puzzles in a standard Sokoban format
+func IsLevelFile(name string) bool {
+	ext := path.Ext(name)
+	if strings.EqualFold(ext, LEVEL_FILE_EXT) {
+		return true
+	}
+	for _, e := range IMPORT_FILE_EXTS {
+		if strings.EqualFold(ext, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// ImportLevelFile reads the puzzles in a file in a standard Sokoban format: an SLC collection or XSB text with one or more puzzles
+func ImportLevelFile(name string, data []byte) (*sim.ImportedCollection, error) {
+	if strings.EqualFold(path.Ext(name), ".slc") {
+		return sim.ParseSLC(data)
+	}
+	return sim.ParseXSBCollection(string(data))
+}
+
+// ReadLevelFile returns the levels in the provided file, converting puzzles in standard Sokoban formats to Gokoban's level format
+// Each puzzle of a converted file is named after the file and its number e.g. "microban.slc#12"
+func ReadLevelFile(name string, data []byte) ([]PackFile, error) {
+	if !IsLevelFile(name) || strings.EqualFold(path.Ext(name), LEVEL_FILE_EXT) {
+		return []PackFile{{Name: name, Source: string(data)}}, nil
+	}
+	col, err := ImportLevelFile(name, data)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]PackFile, len(col.Levels))
+	for i, l := range col.Levels {
+		files[i] = PackFile{Name: fmt.Sprintf("%s#%d", name, i+1), Source: l.Source}
+	}
+	return files, nil
+}
+
+// packRoot returns the root of a zip archive's level pack
+// Archives often contain a single directory with everything inside, in which case that directory is the root
+func packRoot(zr *zip.ReadCloser) fs.FS {
+	entries, err := fs.ReadDir(zr, ".")
+	if err != nil || len(entries) != 1 || !entries[0].IsDir() {
+		return zr
+	}
+	sub, err := fs.Sub(zr, entries[0].Name())
+	if err != nil {
+		return zr
+	}
+	return sub
+}
+
+// FindPacks returns the sorted paths of the level packs (directories and zip archives) inside the provided directory
+func FindPacks(dir string) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, f := range files {
+		p := filepath.Join(dir, f.Name())
+		if f.IsDir() || strings.EqualFold(filepath.Ext(p), ".zip") {
+			paths = append(paths, p)
+		}
+	}
+	return paths, nil
+}
+
+// UserPacksDir returns the directory where the player can add level packs
+func UserPacksDir() (string, error) {
+	dataDir, err := userDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, PACKS_DIRNAME), nil
+}
+
+// naturalLess compares file names so that numbers are ordered by value e.g. 2.txt comes before 10.txt
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		na, ra := leadingNumber(a)
+		nb, rb := leadingNumber(b)
+		if na != "" && nb != "" {
+			na, nb = strings.TrimLeft(na, "0"), strings.TrimLeft(nb, "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			a, b = ra, rb
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+// leadingNumber splits the provided string into its leading digits and the rest
+func leadingNumber(s string) (string, string) {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// packList is a flag.Value holding the paths of the level packs provided on the command line
+type packList []string
+
+func (pl *packList) String() string {
+	return strings.Join(*pl, ",")
+}
+
+func (pl *packList) Set(p string) error {
+	*pl = append(*pl, p)
+	return nil
+}
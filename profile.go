@@ -0,0 +1,183 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// The directory (inside the user data directory) where the user data of each profile is stored
+const PROFILES_DIRNAME string = "profiles"
+
+// The file (inside the user data directory) storing the name of the last used profile
+const LAST_PROFILE_FILENAME string = "last-profile"
+
+// The profile used if the player never created one
+const DEFAULT_PROFILE string = "Player"
+
+// The maximum number of characters in a profile name
+const MAX_PROFILE_NAME_LENGTH int = 24
+
+// profilePath returns the path of the user data file of the provided profile
+func profilePath(name string) (string, error) {
+	dataDir, err := userDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, PROFILES_DIRNAME, name+".json"), nil
+}
+
+// ValidateProfileName returns an error describing why the provided name can't be used for a profile, if it can't
+// Names are used as file names so only letters, digits, spaces, hyphens and underscores are allowed
+func ValidateProfileName(name string) error {
+	if name == "" {
+		return errors.New("enter a name for the profile")
+	}
+	if len([]rune(name)) > MAX_PROFILE_NAME_LENGTH {
+		return fmt.Errorf("profile names can't be longer than %v characters", MAX_PROFILE_NAME_LENGTH)
+	}
+	if strings.TrimSpace(name) != name {
+		return errors.New("profile names can't start or end with a space")
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != ' ' && r != '-' && r != '_' {
+			return errors.New("profile names can only contain letters, digits, spaces, - and _")
+		}
+	}
+	return nil
+}
+
+// ListProfiles returns the sorted names of all existing profiles
+func ListProfiles() ([]string, error) {
+
+	dataDir, err := userDataDir()
+	if err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(filepath.Join(dataDir, PROFILES_DIRNAME))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0)
+	for _, f := range files {
+		name := strings.TrimSuffix(f.Name(), ".json")
+		if f.IsDir() || name == f.Name() || ValidateProfileName(name) != nil {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return strings.ToLower(names[i]) < strings.ToLower(names[j]) })
+	return names, nil
+}
+
+// findProfile returns the name of the existing profile matching the provided name regardless of case, if any
+// Case is ignored because profile names are file names, which are case-insensitive on some systems
+func findProfile(name string) (string, bool) {
+	names, _ := ListProfiles()
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return n, true
+		}
+	}
+	return "", false
+}
+
+// CreateProfile creates a new profile with default settings and returns its user data
+func CreateProfile(name string) (*UserData, error) {
+
+	if err := ValidateProfileName(name); err != nil {
+		return nil, err
+	}
+	if _, exists := findProfile(name); exists {
+		return nil, errors.New("a profile with that name already exists")
+	}
+	ud := NewUserData(name)
+	if err := ud.Save(); err != nil {
+		return nil, err
+	}
+	return ud, nil
+}
+
+// RenameProfile renames the provided user data's profile, moving its file
+func RenameProfile(ud *UserData, name string) error {
+
+	if err := ValidateProfileName(name); err != nil {
+		return err
+	}
+	if existing, exists := findProfile(name); exists && existing != ud.profile {
+		return errors.New("a profile with that name already exists")
+	}
+	oldPath, err := profilePath(ud.profile)
+	if err != nil {
+		return err
+	}
+	newPath, err := profilePath(name)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(oldPath, newPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	ud.profile = name
+	return ud.Save()
+}
+
+// DeleteProfile deletes the user data file of the provided profile
+func DeleteProfile(name string) error {
+	path, err := profilePath(name)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// LastProfile returns the name of the last used profile, or the default profile if there is none
+func LastProfile() string {
+
+	dataDir, err := userDataDir()
+	if err != nil {
+		return DEFAULT_PROFILE
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dataDir, LAST_PROFILE_FILENAME))
+	if err != nil {
+		return DEFAULT_PROFILE
+	}
+	name := strings.TrimSpace(string(data))
+	if ValidateProfileName(name) != nil {
+		return DEFAULT_PROFILE
+	}
+	return name
+}
+
+// SetLastProfile stores the name of the profile to load the next time the game starts
+func SetLastProfile(name string) {
+
+	dataDir, err := userDataDir()
+	if err == nil {
+		err = os.MkdirAll(dataDir, 0755)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dataDir, LAST_PROFILE_FILENAME), []byte(name+"\n"), 0644)
+	}
+	if err != nil {
+		log.Error("Error saving last profile: %v", err)
+	}
+}
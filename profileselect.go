@@ -0,0 +1,242 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/g3n/engine/gui"
+	"github.com/g3n/engine/math32"
+)
+
+const PROFILE_SELECT_COLUMNS int = 3
+const PROFILE_BUTTON_WIDTH float32 = 180
+const PROFILE_BUTTON_HEIGHT float32 = 40
+
+var errorTextColor = math32.Color{0.82, 0.48, 0.48}
+
+// CreateProfileScreen creates the (initially hidden) profile panel inside the menu screen
+// It lists the profiles so that the player can switch between them, and lets them create, rename and delete profiles
+func (ui *UI) CreateProfileScreen() {
+
+	ui.profilePanel = gui.NewPanel(600, 100)
+	ui.profilePanel.SetZLayerDelta(2)
+	ui.profilePanel.SetBorders(2, 2, 2, 2)
+	ui.profilePanel.SetBordersColor4(&sliderBorderColor)
+	ui.profilePanel.SetColor4(&math32.Color4{0.2, 0.2, 0.2, 0.6})
+	ui.profilePanel.SetPaddings(10, 10, 10, 10)
+	layout := gui.NewVBoxLayout()
+	layout.SetSpacing(10)
+	ui.profilePanel.SetLayout(layout)
+	ui.profilePanel.SetVisible(false)
+
+	title := gui.NewLabel("Profiles")
+	title.SetFontSize(28)
+	title.SetColor(&math32.Color{1, 1, 1})
+	title.SetEnabled(false)
+	ui.profilePanel.Add(title)
+
+	// Panel with a button for each profile - filled when shown
+	ui.profileList = gui.NewPanel(ui.profilePanel.ContentWidth(), PROFILE_BUTTON_HEIGHT)
+	ui.profileList.SetLayout(gui.NewGridLayout(PROFILE_SELECT_COLUMNS))
+	ui.profilePanel.Add(ui.profileList)
+
+	// Name of the profile to create or new name of the current profile
+	ui.profileEdit = gui.NewEdit(int(ui.profilePanel.ContentWidth()), "Profile name")
+	ui.profileEdit.MaxLength = MAX_PROFILE_NAME_LENGTH
+	ui.profileEdit.SetFontSize(20)
+	ui.profileEdit.Subscribe(gui.OnFocus, func(evname string, ev interface{}) {
+		ui.profileEditing = true
+	})
+	ui.profileEdit.Subscribe(gui.OnFocusLost, func(evname string, ev interface{}) {
+		ui.profileEditing = false
+	})
+	ui.profilePanel.Add(ui.profileEdit)
+
+	ui.profileStatus = gui.NewLabel(" ")
+	ui.profileStatus.SetFontSize(18)
+	ui.profileStatus.SetColor(&creditsColor)
+	ui.profileStatus.SetEnabled(false)
+	ui.profilePanel.Add(ui.profileStatus)
+
+	buttonRow := gui.NewPanel(ui.profilePanel.ContentWidth(), PROFILE_BUTTON_HEIGHT)
+	buttonRowLayout := gui.NewHBoxLayout()
+	buttonRowLayout.SetAlignH(gui.AlignWidth)
+	buttonRow.SetLayout(buttonRowLayout)
+	ui.profilePanel.Add(buttonRow)
+
+	addButton := func(text string, cb func()) *gui.Button {
+		b := gui.NewButton(text)
+		b.Subscribe(gui.OnClick, func(evname string, ev interface{}) {
+			ui.game.audio.click.Play()
+			cb()
+		})
+		b.Subscribe(gui.OnCursorEnter, func(evname string, ev interface{}) {
+			ui.game.audio.hover.Play()
+		})
+		buttonRow.Add(b)
+		return b
+	}
+	addButton("Create", ui.createProfile)
+	addButton("Rename current", ui.renameProfile)
+	ui.profileDeleteButton = addButton("Delete current", ui.deleteProfile)
+	addButton("Back (Esc)", func() { ui.ShowProfiles(false) })
+
+	ui.menuScreen.Add(ui.profilePanel)
+}
+
+// ShowProfiles switches the menu between the main menu panel and the profile panel
+func (ui *UI) ShowProfiles(show bool) {
+
+	ui.inProfiles = show
+	ui.menuPanel.SetVisible(!show)
+	ui.profilePanel.SetVisible(show)
+	gui.Manager().SetKeyFocus(nil)
+	if show {
+		// Make sure the current profile is saved so that it is listed
+		ui.game.SaveUserData()
+		ui.profileEdit.SetText("")
+		ui.setProfileStatus("", false)
+		ui.UpdateProfileList()
+	}
+}
+
+// UpdateProfileList recreates the profile buttons, highlighting the current profile
+func (ui *UI) UpdateProfileList() {
+
+	ui.profileDeleteArmed = false
+	ui.profileDeleteButton.Label.SetText("Delete current")
+
+	names, err := ListProfiles()
+	if err != nil {
+		ui.setProfileStatus(err.Error(), true)
+	}
+	current := ui.game.userData.Profile()
+	found := false
+	for _, name := range names {
+		found = found || name == current
+	}
+	if !found {
+		names = append(names, current)
+	}
+
+	gui.Manager().SetKeyFocus(nil)
+	ui.profileList.DisposeChildren(true)
+	for _, name := range names {
+		profile := name
+		b := gui.NewButton(profile)
+		b.SetWidth(PROFILE_BUTTON_WIDTH)
+		b.SetMargins(4, 4, 4, 4)
+		if profile == current {
+			b.SetBorders(2, 2, 2, 2)
+			b.SetBordersColor4(&sliderColor)
+		}
+		b.Subscribe(gui.OnClick, func(evname string, ev interface{}) {
+			ui.game.audio.click.Play()
+			if profile != ui.game.userData.Profile() {
+				ui.game.SwitchProfile(LoadProfile(profile))
+				ui.UpdateProfileList()
+				ui.setProfileStatus("Playing as "+profile, false)
+			}
+		})
+		b.Subscribe(gui.OnCursorEnter, func(evname string, ev interface{}) {
+			ui.game.audio.hover.Play()
+		})
+		ui.profileList.Add(b)
+	}
+
+	rows := (len(names) + PROFILE_SELECT_COLUMNS - 1) / PROFILE_SELECT_COLUMNS
+	ui.profileList.SetHeight(float32(rows) * (PROFILE_BUTTON_HEIGHT + 8))
+	ui.resizeProfilePanel()
+}
+
+// resizeProfilePanel fits the profile panel to its contents and centers it
+func (ui *UI) resizeProfilePanel() {
+	var height float32
+	for _, child := range ui.profilePanel.Children() {
+		height += child.(gui.IPanel).GetPanel().Height() + 10
+	}
+	ui.profilePanel.SetContentHeight(height - 10)
+	width, screenHeight := ui.game.GetFramebufferSize()
+	ui.Resize(width, screenHeight)
+}
+
+// setProfileStatus shows a message below the profile name
+func (ui *UI) setProfileStatus(msg string, isError bool) {
+	if msg == "" {
+		msg = " "
+	}
+	ui.profileStatus.SetText(msg)
+	if isError {
+		ui.profileStatus.SetColor(&errorTextColor)
+	} else {
+		ui.profileStatus.SetColor(&creditsColor)
+	}
+}
+
+// createProfile creates a profile with the entered name and switches to it
+func (ui *UI) createProfile() {
+	ud, err := CreateProfile(ui.profileEdit.Text())
+	if err != nil {
+		ui.setProfileStatus(err.Error(), true)
+		return
+	}
+	ui.game.SwitchProfile(ud)
+	ui.profileEdit.SetText("")
+	ui.UpdateProfileList()
+	ui.setProfileStatus("Created profile "+ud.Profile(), false)
+}
+
+// renameProfile renames the current profile to the entered name
+func (ui *UI) renameProfile() {
+	err := RenameProfile(ui.game.userData, ui.profileEdit.Text())
+	if err != nil {
+		ui.setProfileStatus(err.Error(), true)
+		return
+	}
+	SetLastProfile(ui.game.userData.Profile())
+	ui.profileEdit.SetText("")
+	ui.UpdateProfileList()
+	ui.UpdateProfileButton()
+	ui.setProfileStatus("Renamed profile to "+ui.game.userData.Profile(), false)
+}
+
+// deleteProfile deletes the current profile after asking for confirmation and switches to another one
+func (ui *UI) deleteProfile() {
+
+	current := ui.game.userData.Profile()
+	names, _ := ListProfiles()
+	var other string
+	for _, name := range names {
+		if name != current {
+			other = name
+			break
+		}
+	}
+	if other == "" {
+		ui.setProfileStatus("Can't delete the only profile - create another one first", true)
+		return
+	}
+
+	// Ask for confirmation the first time the button is clicked
+	if !ui.profileDeleteArmed {
+		ui.profileDeleteArmed = true
+		ui.profileDeleteButton.Label.SetText("Really delete?")
+		ui.setProfileStatus("Click again to delete "+current+" and all of its progress", true)
+		return
+	}
+
+	ui.game.SwitchProfile(LoadProfile(other))
+	err := DeleteProfile(current)
+	ui.UpdateProfileList()
+	if err != nil {
+		ui.setProfileStatus(err.Error(), true)
+		return
+	}
+	ui.setProfileStatus("Deleted profile "+current+" - playing as "+other, false)
+}
+
+// UpdateProfileButton shows the current profile on the main menu's profile button
+func (ui *UI) UpdateProfileButton() {
+	ui.profileButton.Label.SetText("Profile: " + ui.game.userData.Profile())
+}
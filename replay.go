@@ -0,0 +1,231 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/danaugrs/gokoban/sim"
+
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The directory (inside the user data directory) where replays of every attempt are saved
+const REPLAY_DIRNAME string = "replays"
+
+// The maximum number of replay files kept - older ones are deleted
+const MAX_REPLAY_FILES int = 100
+
+// The playback speeds available when watching a replay
+var replaySpeeds = []float64{0.25, 0.5, 1, 2, 4, 8, 16}
+
+// replayDir returns the directory where replays are saved, next to the user data
+func replayDir() (string, error) {
+	dataDir, err := userDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, REPLAY_DIRNAME), nil
+}
+
+// SaveReplay saves the provided replay as a new file in the replay directory and removes the oldest replays
+func SaveReplay(r *sim.Replay) {
+
+	dir, err := replayDir()
+	if err == nil {
+		err = os.MkdirAll(dir, 0755)
+	}
+	if err != nil {
+		log.Error("Error creating replay directory: %v", err)
+		return
+	}
+
+	name := strings.TrimSuffix(r.Level, filepath.Ext(r.Level))
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.json", name, r.Started.Format("20060102-150405.000")))
+	log.Debug("Saving replay: %v", path)
+
+	file, err := os.Create(path)
+	if err != nil {
+		log.Error("Error creating replay file: %v", err)
+		return
+	}
+	err = r.Write(file)
+	file.Close()
+	if err != nil {
+		log.Error("Error writing replay file: %v", err)
+		return
+	}
+
+	// Remove the oldest replays
+	files, err := ioutil.ReadDir(dir)
+	if err != nil || len(files) <= MAX_REPLAY_FILES {
+		return
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+	for _, f := range files[:len(files)-MAX_REPLAY_FILES] {
+		os.Remove(filepath.Join(dir, f.Name()))
+	}
+}
+
+// LoadReplay reads a replay file
+func LoadReplay(path string) (*sim.Replay, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return sim.ReadReplay(file)
+}
+
+// Replayer plays back a replay through the current level in real time
+type Replayer struct {
+	game   *Gokoban
+	replay *sim.Replay
+	next   int     // index of the next move to play
+	clock  float64 // playback time in replay seconds
+	speed  int     // index into replaySpeeds
+	paused bool
+}
+
+// NewReplayer returns a pointer to a new Replayer for the provided replay
+func NewReplayer(g *Gokoban, r *sim.Replay) *Replayer {
+	rp := new(Replayer)
+	rp.game = g
+	rp.replay = r
+	rp.speed = 2 // 1x
+	return rp
+}
+
+// Speed returns the current playback speed multiplier
+func (rp *Replayer) Speed() float64 {
+	return replaySpeeds[rp.speed]
+}
+
+// Faster increases the playback speed
+func (rp *Replayer) Faster() {
+	if rp.speed < len(replaySpeeds)-1 {
+		rp.speed++
+	}
+}
+
+// Slower decreases the playback speed
+func (rp *Replayer) Slower() {
+	if rp.speed > 0 {
+		rp.speed--
+	}
+}
+
+// TogglePause pauses or resumes the playback
+func (rp *Replayer) TogglePause() {
+	rp.paused = !rp.paused
+}
+
+// Step plays the next move right away (only while paused)
+func (rp *Replayer) Step() {
+	if rp.paused && rp.next < len(rp.replay.Moves) && !rp.game.level.animating() {
+		rp.clock = rp.replay.Moves[rp.next].Time
+		rp.playNext()
+	}
+}
+
+// Update advances the playback clock and plays the moves that are due
+func (rp *Replayer) Update(timeDelta float64) {
+
+	if rp.next == len(rp.replay.Moves) {
+		if !rp.game.level.animating() {
+			log.Info("Replay finished")
+			rp.game.StopReplay()
+		}
+		return
+	}
+	if rp.paused {
+		return
+	}
+
+	rp.clock += timeDelta
+	move := rp.replay.Moves[rp.next]
+	if move.Time <= rp.clock {
+		if rp.game.level.animating() {
+			// Wait for the previous move to finish, keeping the time between moves
+			rp.clock = move.Time
+		} else {
+			rp.playNext()
+		}
+	}
+}
+
+// playNext plays the next move of the replay
+func (rp *Replayer) playNext() {
+
+	move := rp.replay.Moves[rp.next]
+	rp.next++
+	log.Debug("Replaying move %v/%v: %v", rp.next, len(rp.replay.Moves), move.Action)
+
+	switch move.Action {
+	case sim.ACTION_UNDO:
+		rp.game.level.Undo()
+	case sim.ACTION_REDO:
+		rp.game.level.Redo()
+	default:
+		if d, ok := sim.ParseDir(move.Action); ok {
+			rp.game.level.step(d.Z, d.X)
+		}
+	}
+	rp.game.ui.UpdateReplayLabel()
+}
+
+// StartReplay plays the provided replay on the level it was recorded on
+func (g *Gokoban) StartReplay(r *sim.Replay) error {
+	log.Debug("Start Replay")
+
+	// Look for the level in every pack, starting with the current one
+	var pack *Pack
+	n := -1
+	packs := append([]*Pack{g.pack}, g.packs...)
+	for _, p := range packs {
+		for i, f := range p.Files {
+			if strings.TrimSpace(f.Source) == strings.TrimSpace(r.Source) {
+				pack, n = p, i
+				break
+			}
+		}
+		if pack != nil {
+			break
+		}
+	}
+	if n < 0 {
+		return fmt.Errorf("level %v of the replay was not found (it may have been modified)", r.Level)
+	}
+
+	if pack != g.pack {
+		g.SelectPack(pack)
+	}
+	g.InitLevel(n)
+	if g.ui.inMenu {
+		g.ui.ToggleMenu()
+	}
+
+	// Don't record the replayed moves as a new attempt
+	g.level.record = nil
+	g.replayer = NewReplayer(g, r)
+	g.gopherLocked = true
+	g.ui.UpdateReplayLabel()
+	return nil
+}
+
+// StopReplay stops the replay being played (if any) and gives control back to the player
+func (g *Gokoban) StopReplay() {
+	if g.replayer == nil {
+		return
+	}
+	log.Debug("Stop Replay")
+
+	g.replayer = nil
+	g.gopherLocked = g.ui.inMenu
+	g.ui.UpdateReplayLabel()
+}
@@ -0,0 +1,140 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sim
+
+import (
+	"sort"
+)
+
+// Deadlock describes why a level can't be completed anymore
+type Deadlock struct {
+	Boxes  []int  // indices of the boxes that can't be brought to a pad
+	Reason string // e.g. "a box is stuck in a corner"
+}
+
+// Deadlock returns why the level can't be completed from the state, or nil if it may still be
+// The analysis is conservative - it finds the usual ways of getting stuck, never a deadlock that isn't one:
+//   - frozen boxes: a box resting on a block that can't be pushed along either axis, because of blocks
+//     or other frozen boxes next to it (a box in a corner is the simplest case)
+//   - boxes below the pads: boxes only go up on elevators, so each pad needs a box of its own
+//     that is at least as high or can reach an elevator that goes that high
+func (s *State) Deadlock() *Deadlock {
+
+	if s.failed {
+		return &Deadlock{Reason: "something fell out of the world or broke"}
+	}
+	if s.Complete() {
+		return nil
+	}
+
+	// Frozen boxes never move, so they only count for the pads they are on
+	var stuck, free []int
+	freePads := make([]GridLoc, 0, len(s.data.Pads))
+	for _, p := range s.data.Pads {
+		if obj := s.Get(p); obj.Kind != ObjBox || !s.frozen(p, make(map[GridLoc]bool)) {
+			freePads = append(freePads, p)
+		}
+	}
+	for i, b := range s.boxes {
+		if !s.frozen(b, make(map[GridLoc]bool)) {
+			free = append(free, i)
+		} else if !s.data.IsPad(b) {
+			stuck = append(stuck, i)
+		}
+	}
+	if len(free) < len(freePads) {
+		reason := "there are fewer boxes than pads"
+		for _, i := range stuck {
+			if s.cornered(s.boxes[i]) {
+				reason = "a box is stuck in a corner"
+				break
+			}
+			reason = "a box is frozen against other boxes"
+		}
+		return &Deadlock{Boxes: stuck, Reason: reason}
+	}
+
+	// Match the highest pads with the boxes that can reach the highest
+	sort.Slice(freePads, func(a, b int) bool { return freePads[a].Y > freePads[b].Y })
+	sort.Slice(free, func(a, b int) bool { return s.reach(free[a]) > s.reach(free[b]) })
+	for n, p := range freePads {
+		if s.reach(free[n]) < p.Y {
+			var low []int
+			for _, i := range free {
+				if s.reach(i) < p.Y {
+					low = append(low, i)
+				}
+			}
+			return &Deadlock{Boxes: low, Reason: "boxes have fallen below the pads they are needed on"}
+		}
+	}
+	return nil
+}
+
+// frozen returns whether the box at the provided location can never move again
+// Boxes being checked further up the recursion are assumed to be frozen, to stop boxes from freeing each other
+func (s *State) frozen(loc GridLoc, assumed map[GridLoc]bool) bool {
+
+	// Only blocks are sure to stay under a box, and conveyor belts move it
+	if s.Get(GridLoc{loc.Z, loc.X, loc.Y - 1}).Kind != ObjBlock {
+		return false
+	}
+	if _, ok := s.data.Conveyor(loc); ok {
+		return false
+	}
+	assumed[loc] = true
+	defer delete(assumed, loc)
+	return s.blocked(loc, Right, assumed) && s.blocked(loc, Down, assumed)
+}
+
+// blocked returns whether the box at the provided location can't be pushed either way along the axis of the provided direction
+// Something that doesn't move on one side is enough: the box can't be pushed into it, and the gopher can't stand there to push it away
+func (s *State) blocked(loc GridLoc, d Dir, assumed map[GridLoc]bool) bool {
+	for _, side := range []GridLoc{{loc.Z + d.Z, loc.X + d.X, loc.Y}, {loc.Z - d.Z, loc.X - d.X, loc.Y}} {
+		obj := s.Get(side)
+		if obj.Kind == ObjBlock || assumed[side] || obj.Kind == ObjBox && s.frozen(side, assumed) {
+			return true
+		}
+	}
+	return false
+}
+
+// cornered returns whether a frozen box at the provided location is held by blocks alone
+func (s *State) cornered(loc GridLoc) bool {
+	block := func(d Dir) bool { return s.Get(GridLoc{loc.Z + d.Z, loc.X + d.X, loc.Y}).Kind == ObjBlock }
+	return (block(Up) || block(Down)) && (block(Left) || block(Right))
+}
+
+// reach returns the highest floor the i-th box may get to
+// Boxes only go down, except on top of elevators, which can take them up to the floor above their shafts
+// (higher still if other boxes or the gopher are stacked under them), and through teleporters,
+// which may lead to a higher floor than the one they start from
+func (s *State) reach(i int) int {
+	_, _, nfloors := s.data.Size()
+	stack := len(s.boxes) // the other boxes and the gopher
+	y := s.boxes[i].Y
+	for changed := true; changed; {
+		changed = false
+		for _, e := range s.data.Elevators {
+			top := e.High + 1 + stack
+			if top > nfloors {
+				top = nfloors
+			}
+			if e.Low+1 <= y && top > y {
+				y = top
+				changed = true
+			}
+		}
+		for _, t := range s.data.Teleporters {
+			for n, end := range t.Ends {
+				if other := t.Ends[1-n]; end.Y <= y && other.Y > y {
+					y = other.Y
+					changed = true
+				}
+			}
+		}
+	}
+	return y
+}
@@ -0,0 +1,28 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sim
+
+import (
+	"testing"
+)
+
+// A box stacked on another box rides an elevator above the floor over its shaft
+func TestDeadlockStackedOnElevator(t *testing.T) {
+
+	ld, err := ParseLevel(". e- ]] .\n]s ]xx e- .\n. . ]]oo .")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewState(ld)
+	for _, d := range []Dir{Right, Up, Right, Down} {
+		if dl := s.Deadlock(); dl != nil {
+			t.Fatalf("deadlock before completing the level: %v", dl.Reason)
+		}
+		s.StepDir(d)
+	}
+	if !s.Complete() {
+		t.Fatal("level not complete")
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sim
+
+// Dir is an absolute direction on the grid, independent of the camera
+type Dir struct {
+	Z, X int
+}
+
+var (
+	Up    = Dir{-1, 0} // towards the first row of the level file
+	Down  = Dir{1, 0}  // towards the last row of the level file
+	Left  = Dir{0, -1} // towards the first column of the level file
+	Right = Dir{0, 1}  // towards the last column of the level file
+)
+
+// Dirs lists the four directions the gopher can step to
+var Dirs = [4]Dir{Up, Down, Left, Right}
+
+func (d Dir) String() string {
+	switch d {
+	case Up:
+		return "u"
+	case Down:
+		return "d"
+	case Left:
+		return "l"
+	case Right:
+		return "r"
+	}
+	return "?"
+}
+
+// ParseDir returns the direction represented by the provided letter (see Dir.String)
+func ParseDir(s string) (Dir, bool) {
+	for _, d := range Dirs {
+		if d.String() == s {
+			return d, true
+		}
+	}
+	return Dir{}, false
+}
+
+// StepDir processes a gopher step to the provided direction (see Step)
+func (s *State) StepDir(d Dir) []Event {
+	return s.Step(d.Z, d.X)
+}
@@ -0,0 +1,48 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sim
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LevelError describes a problem with a level file
+// Row, Col and Floor are 1-based positions in the level file and are zero when not applicable
+type LevelError struct {
+	Row   int
+	Col   int
+	Floor int
+	Msg   string
+}
+
+func (e *LevelError) Error() string {
+	switch {
+	case e.Floor > 0:
+		return fmt.Sprintf("row %d, column %d, floor %d: %s", e.Row, e.Col, e.Floor, e.Msg)
+	case e.Col > 0:
+		return fmt.Sprintf("row %d, column %d: %s", e.Row, e.Col, e.Msg)
+	case e.Row > 0:
+		return fmt.Sprintf("row %d: %s", e.Row, e.Msg)
+	}
+	return e.Msg
+}
+
+// errorAt returns a LevelError for the provided grid location
+// Thanks to the padding added by ParseLevel, rows and columns of the grid match the 1-based positions in the file
+func errorAt(loc GridLoc, format string, args ...interface{}) *LevelError {
+	return &LevelError{loc.Z, loc.X, loc.Y + 1, fmt.Sprintf(format, args...)}
+}
+
+// LevelErrors is a list of problems with a level file
+type LevelErrors []*LevelError
+
+func (le LevelErrors) Error() string {
+	msgs := make([]string, len(le))
+	for i, e := range le {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
@@ -0,0 +1,111 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sim
+
+import (
+	"math"
+)
+
+type EventType int
+
+const (
+	EventBump         EventType = iota // the gopher bumped into something and did not move
+	EventWalk                          // the gopher walked one cell onto solid ground
+	EventStepOff                       // the gopher walked one cell into thin air
+	EventPush                          // a box was pushed one cell
+	EventFall                          // an object started falling
+	EventFallOut                       // an object started falling out of the world
+	EventLand                          // an object landed after falling
+	EventHurt                          // a box landed on the gopher
+	EventRide                          // an object was carried by an elevator
+	EventElevatorUp                    // an elevator started rising
+	EventElevatorDown                  // an elevator started lowering
+	EventElevatorStop                  // an elevator reached its destination
+	EventOnPad                         // a box landed on a pad
+	EventOffPad                        // a box left a pad
+	EventComplete                      // every pad has a box on it
+	EventFail                          // an object finished falling out of the world
+	EventTeleport                      // an object was sent to the other end of a teleporter, arriving after TELEPORT_TIME
+	EventSlide                         // an object slid one cell on ice
+	EventGateOpen                      // a gate opened because one of its plates was pressed
+	EventGateClose                     // a gate closed because none of its plates are pressed
+	EventConvey                        // an object was moved one cell by a conveyor belt
+	EventBreak                         // a fragile box broke after falling more than one floor
+)
+
+// TELEPORT_TIME is how long objects take to go through a teleporter, in the time units of events
+const TELEPORT_TIME float32 = 1
+
+// BREAK_TIME is how long after a fragile box breaks the level fails, in the time units of events
+const BREAK_TIME float32 = 5
+
+// FALL_GRAVITY is the acceleration of falling objects, in floors per time unit squared
+// Falling objects drop ½·FALL_GRAVITY·t² floors in t time units, so that a fall of one floor takes one time unit
+const FALL_GRAVITY float32 = 2
+
+var eventNames = [...]string{
+	"Bump", "Walk", "StepOff", "Push", "Fall", "FallOut", "Land", "Hurt", "Ride",
+	"ElevatorUp", "ElevatorDown", "ElevatorStop", "OnPad", "OffPad", "Complete", "Fail", "Teleport", "Slide", "GateOpen", "GateClose", "Convey", "Break",
+}
+
+func (t EventType) String() string {
+	if t >= 0 && int(t) < len(eventNames) {
+		return eventNames[t]
+	}
+	return "Unknown"
+}
+
+// Event describes something that happened during a step.
+// Movement events take the object from From to To, starting at Time and
+// travelling one cell per time unit, except for falls, which accelerate (see FALL_GRAVITY).
+// All other events happen instantly at Time.
+type Event struct {
+	Type  EventType
+	Obj   Obj
+	From  GridLoc
+	To    GridLoc
+	Time  float32
+	Sound bool // whether the event should be heard (e.g. only the first of several falling boxes is)
+}
+
+// IsMovement returns whether the event moves its object
+func (e Event) IsMovement() bool {
+	switch e.Type {
+	case EventWalk, EventStepOff, EventPush, EventFall, EventFallOut, EventRide, EventElevatorUp, EventElevatorDown, EventSlide, EventConvey:
+		return true
+	}
+	return false
+}
+
+// End returns the time at which the event finishes
+func (e Event) End() float32 {
+	if e.Type == EventTeleport {
+		return e.Time + TELEPORT_TIME
+	}
+	if !e.IsMovement() {
+		return e.Time
+	}
+	if e.Type == EventFall || e.Type == EventFallOut {
+		return e.Time + fallTime(distance(e.From, e.To))
+	}
+	return e.Time + distance(e.From, e.To)
+}
+
+// fallTime returns how long objects take to fall the provided number of floors, in the time units of events
+func fallTime(floors float32) float32 {
+	return float32(math.Sqrt(float64(2 * floors / FALL_GRAVITY)))
+}
+
+// distance returns the distance between two locations that differ along a single axis
+func distance(a, b GridLoc) float32 {
+	return float32(abs(a.Z-b.Z) + abs(a.X-b.X) + abs(a.Y-b.Y))
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
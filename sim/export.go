@@ -0,0 +1,177 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sim
+
+import (
+	"errors"
+	"strings"
+)
+
+// Move is a step of the gopher that changed the state, and whether it pushed a box
+type Move struct {
+	Dir  Dir // absolute direction on the grid
+	Push bool
+}
+
+// String returns the move in LURD notation: the direction's letter, uppercase if the move pushed a box
+func (m Move) String() string {
+	if m.Push {
+		return strings.ToUpper(m.Dir.String())
+	}
+	return m.Dir.String()
+}
+
+// FormatLURD returns the provided moves in LURD notation, the standard notation for Sokoban solutions
+// Up and down move across rows of the level file (and of its XSB export), left and right across columns
+func FormatLURD(moves []Move) string {
+	var sb strings.Builder
+	for _, m := range moves {
+		sb.WriteString(m.String())
+	}
+	return sb.String()
+}
+
+// stepMove makes a step and returns the resulting move, or false if the gopher bumped into something
+func stepMove(s *State, d Dir) (Move, bool) {
+	events := s.StepDir(d)
+	if len(events) == 0 || events[0].Type == EventBump {
+		return Move{}, false
+	}
+	m := Move{Dir: d}
+	for _, ev := range events {
+		if ev.Type == EventPush {
+			m.Push = true
+		}
+	}
+	return m, true
+}
+
+// PlayDirs steps in the provided directions from the initial state of the level (e.g. a solution found by the solver)
+// and returns the steps that changed the state as moves
+func PlayDirs(ld *LevelData, dirs []Dir) []Move {
+	s := NewState(ld)
+	moves := make([]Move, 0, len(dirs))
+	for _, d := range dirs {
+		if m, ok := stepMove(s, d); ok {
+			moves = append(moves, m)
+		}
+	}
+	return moves
+}
+
+// ExportXSB returns the level in the XSB format used by classic Sokoban puzzles, if it fits on a single floor
+// The floor is at the height of the gopher's start position: columns with a block at that height become walls,
+// and columns with a block right below it become floor - all boxes and pads must be on the floor,
+// there must be no elevators, teleporters, ice, plates, gates, directional tiles or special boxes, and no hole next to the floor that something could fall into
+func ExportXSB(ld *LevelData) (string, error) {
+
+	if len(ld.Elevators) > 0 {
+		return "", errors.New("levels with elevators can't be exported")
+	}
+	if len(ld.Teleporters) > 0 {
+		return "", errors.New("levels with teleporters can't be exported")
+	}
+	if len(ld.Plates) > 0 || len(ld.Gates) > 0 {
+		return "", errors.New("levels with pressure plates or gates can't be exported")
+	}
+	if len(ld.Conveyors) > 0 || len(ld.OneWays) > 0 {
+		return "", errors.New("levels with conveyor belts or one-way tiles can't be exported")
+	}
+	if ld.BoxTypes != nil {
+		return "", errors.New("levels with heavy, fragile or glued boxes can't be exported")
+	}
+	for _, row := range ld.Grid {
+		for _, column := range row {
+			for _, c := range column {
+				if c == ICE {
+					return "", errors.New("levels with ice can't be exported")
+				}
+			}
+		}
+	}
+
+	nrows, ncols, _ := ld.Size()
+	y := ld.GopherInit.Y
+	isWall := func(z, x int) bool { return ld.Get(GridLoc{z, x, y}) == BLOCK }
+	isFloor := func(z, x int) bool { return !isWall(z, x) && ld.Get(GridLoc{z, x, y - 1}) == BLOCK }
+
+	rows := make([][]rune, nrows)
+	for z := range rows {
+		rows[z] = make([]rune, ncols)
+		for x := range rows[z] {
+			switch {
+			case isWall(z, x):
+				rows[z][x] = XSB_WALL
+			case isFloor(z, x):
+				rows[z][x] = XSB_FLOOR
+				for _, d := range Dirs {
+					if !isWall(z+d.Z, x+d.X) && !isFloor(z+d.Z, x+d.X) {
+						return "", errorAt(GridLoc{z, x, y}, "floor is next to a hole, so the level doesn't fit on a single floor")
+					}
+				}
+			default:
+				rows[z][x] = XSB_FLOOR
+			}
+		}
+	}
+
+	onFloor := func(loc GridLoc, what string) (int, int, error) {
+		if loc.Y != y || !isFloor(loc.Z, loc.X) {
+			return 0, 0, errorAt(loc, "%v is not on the floor of the gopher's start position", what)
+		}
+		return loc.Z, loc.X, nil
+	}
+	for _, loc := range ld.Pads {
+		z, x, err := onFloor(loc, "pad")
+		if err != nil {
+			return "", err
+		}
+		rows[z][x] = XSB_GOAL
+	}
+	for _, loc := range ld.BoxesInit {
+		z, x, err := onFloor(loc, "box")
+		if err != nil {
+			return "", err
+		}
+		rows[z][x] = XSB_BOX
+		if ld.IsPad(loc) {
+			rows[z][x] = XSB_BOX_ON_GOAL
+		}
+	}
+	z, x, err := onFloor(ld.GopherInit, "start position")
+	if err != nil {
+		return "", err
+	}
+	rows[z][x] = XSB_PLAYER
+	if ld.IsPad(ld.GopherInit) {
+		rows[z][x] = XSB_PLAYER_GOAL
+	}
+
+	// Leave out empty rows and columns around the puzzle
+	lines := make([]string, 0, nrows)
+	indent := ncols
+	for _, row := range rows {
+		line := strings.TrimRight(string(row), string(XSB_FLOOR))
+		if line == "" && len(lines) == 0 {
+			continue
+		}
+		lines = append(lines, line)
+		if n := len(line) - len(strings.TrimLeft(line, string(XSB_FLOOR))); line != "" && n < indent {
+			indent = n
+		}
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return "", errors.New("level is empty")
+	}
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = line[indent:]
+		}
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sim
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExportXSB(t *testing.T) {
+
+	puzzles := []string{
+		"#####\n#@$.#\n#####\n",
+		"  ####\n###  #\n#@$* #\n#  . #\n######\n",
+		"####\n#+$#\n#  #\n####\n",
+	}
+	for _, xsb := range puzzles {
+		ld, err := ParseXSB(xsb)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exported, err := ExportXSB(ld)
+		if err != nil {
+			t.Fatalf("%q: %v", xsb, err)
+		}
+		if exported != xsb {
+			t.Errorf("exported\n%s\ninstead of\n%s", exported, xsb)
+		}
+		rt, err := ParseXSB(exported)
+		if err != nil {
+			t.Fatalf("%q: exported puzzle doesn't import: %v", xsb, err)
+		}
+		if !reflect.DeepEqual(rt, ld) {
+			t.Errorf("%q: exported puzzle imports to a different level", xsb)
+		}
+	}
+}
+
+func TestExportXSBErrors(t *testing.T) {
+
+	cases := []struct {
+		name  string
+		level string
+		err   string
+	}{
+		{"elevator", "]s e- ]]x ]]o", "levels with elevators can't be exported"},
+		{"teleporter", "]s ]1 ]x ]o ]1", "levels with teleporters can't be exported"},
+		{"ice", "]s ]x i ]o", "levels with ice can't be exported"},
+		{"special box", "]s ]h ]o", "levels with heavy, fragile or glued boxes can't be exported"},
+		{"box on a wall", "]]] ]]] ]]] ]]] ]]]\n]]] ]]s ]]]x ]]o ]]]\n]]] ]]] ]]] ]]] ]]]", "box is not on the floor of the gopher's start position"},
+		{"hole", "]] ]] ]] ]] ]]\n]] ]s ]x ]o ]]\n]] . ]] ]] ]]", "floor is next to a hole, so the level doesn't fit on a single floor"},
+	}
+	for _, c := range cases {
+		ld, err := ParseLevel(c.level)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		_, err = ExportXSB(ld)
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: got error %v instead of %q", c.name, err, c.err)
+		}
+	}
+}
+
+func TestFormatLURD(t *testing.T) {
+
+	ld, err := ParseLevel("]] ]] ]] ]] ]] ]]\n]] ]s ]  ]x ]o ]]\n]] ]] ]] ]] ]] ]]")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Bumps and undone steps are left out of the history
+	r := NewReplay("lurd.txt", "")
+	for _, a := range []string{"u", "r", "r", "l", ACTION_UNDO, ACTION_REDO, "l", "r", ACTION_UNDO} {
+		r.Add(a)
+	}
+	if lurd := FormatLURD(r.History(ld)); lurd != "rRll" {
+		t.Errorf("replay exported as %q instead of %q", lurd, "rRll")
+	}
+
+	if lurd := FormatLURD(PlayDirs(ld, []Dir{Down, Right, Right})); lurd != "rR" {
+		t.Errorf("solution exported as %q instead of %q", lurd, "rR")
+	}
+}
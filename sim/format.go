@@ -0,0 +1,131 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sim
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Cells returns a copy of the level grid without the padding added by ParseLevel,
+// leaving out the empty cells at the top of each column
+func (ld *LevelData) Cells() [][][]CELL_TYPE {
+
+	nrows, ncols, _ := ld.Size()
+	if nrows < 2 || ncols < 2 {
+		return nil
+	}
+	cells := make([][][]CELL_TYPE, nrows-2)
+	for i := range cells {
+		cells[i] = make([][]CELL_TYPE, ncols-2)
+		for j := range cells[i] {
+			column := ld.Grid[i+1][j+1]
+			n := len(column)
+			for n > 0 && column[n-1] == NONE {
+				n--
+			}
+			cells[i][j] = append([]CELL_TYPE(nil), column[:n]...)
+		}
+	}
+	return cells
+}
+
+// FormatLevel returns the level in the format read by ParseLevel, without the padding it adds
+// Parsing the result gives back the same level data (see CheckRoundTrip)
+func FormatLevel(ld *LevelData) string {
+
+	cells := ld.Cells()
+	if len(cells) == 0 || len(cells[0]) == 0 {
+		return ""
+	}
+
+	// Keep the height of the level even if its tallest columns end with empty cells
+	_, _, nfloors := ld.Size()
+	height := 0
+	for _, row := range cells {
+		for _, column := range row {
+			if len(column) > height {
+				height = len(column)
+			}
+		}
+	}
+	for height < nfloors-ADD_TO_NFLOORS && len(cells[0][0]) < nfloors-ADD_TO_NFLOORS {
+		cells[0][0] = append(cells[0][0], NONE)
+	}
+	return FormatGrid(cells)
+}
+
+// FormatGrid returns a level file with the provided cells, indexed by [z][x][y] (see LevelData.Cells)
+// Every row must have the same number of columns, but columns can have any height
+// Empty columns are written as a single spacer (.)
+func FormatGrid(cells [][][]CELL_TYPE) string {
+
+	if len(cells) == 0 {
+		return ""
+	}
+	columns := make([][]string, len(cells))
+	for i, row := range cells {
+		columns[i] = make([]string, len(row))
+		for j, column := range row {
+			s := ""
+			for _, c := range column {
+				s += string(c)
+			}
+			if s == "" {
+				s = string(NONE)
+			}
+			columns[i][j] = s
+		}
+	}
+	return formatCells(columns)
+}
+
+// CheckRoundTrip returns an error if the level doesn't survive being written by FormatLevel and parsed again,
+// i.e. if the parsed level has a different grid, start position, boxes (or box types), pads, elevators, teleporters, plates, gates or tiles
+func CheckRoundTrip(ld *LevelData) error {
+
+	rt, err := ParseLevel(FormatLevel(ld))
+	if err != nil {
+		return fmt.Errorf("written level is invalid: %v", err)
+	}
+
+	nrows, ncols, nfloors := ld.Size()
+	if rtrows, rtcols, rtfloors := rt.Size(); rtrows != nrows || rtcols != ncols || rtfloors != nfloors {
+		return fmt.Errorf("written level has %dx%dx%d cells instead of %dx%dx%d", rtrows, rtcols, rtfloors, nrows, ncols, nfloors)
+	}
+	for i, row := range ld.Grid {
+		for j, column := range row {
+			for k, c := range column {
+				if rtc := rt.Grid[i][j][k]; rtc != c {
+					return errorAt(GridLoc{i, j, k}, "written level has %q instead of %q", rtc, c)
+				}
+			}
+		}
+	}
+
+	switch {
+	case rt.GopherInit != ld.GopherInit:
+		return errorAt(rt.GopherInit, "written level has its start position here instead of at %v", ld.GopherInit)
+	case !reflect.DeepEqual(rt.BoxesInit, ld.BoxesInit):
+		return fmt.Errorf("written level has boxes at %v instead of %v", rt.BoxesInit, ld.BoxesInit)
+	case !reflect.DeepEqual(rt.BoxTypes, ld.BoxTypes):
+		return fmt.Errorf("written level has box types %v instead of %v", rt.BoxTypes, ld.BoxTypes)
+	case !reflect.DeepEqual(rt.Pads, ld.Pads):
+		return fmt.Errorf("written level has pads at %v instead of %v", rt.Pads, ld.Pads)
+	case !reflect.DeepEqual(rt.Elevators, ld.Elevators):
+		return fmt.Errorf("written level has elevators %v instead of %v", rt.Elevators, ld.Elevators)
+	case !reflect.DeepEqual(rt.Teleporters, ld.Teleporters):
+		return fmt.Errorf("written level has teleporters %v instead of %v", rt.Teleporters, ld.Teleporters)
+	case !reflect.DeepEqual(rt.Plates, ld.Plates):
+		return fmt.Errorf("written level has pressure plates %v instead of %v", rt.Plates, ld.Plates)
+	case !reflect.DeepEqual(rt.Gates, ld.Gates):
+		return fmt.Errorf("written level has gates %v instead of %v", rt.Gates, ld.Gates)
+	case !reflect.DeepEqual(rt.Conveyors, ld.Conveyors):
+		return fmt.Errorf("written level has conveyor belts %v instead of %v", rt.Conveyors, ld.Conveyors)
+	case !reflect.DeepEqual(rt.OneWays, ld.OneWays):
+		return fmt.Errorf("written level has one-way tiles %v instead of %v", rt.OneWays, ld.OneWays)
+	}
+	return nil
+}
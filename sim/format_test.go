@@ -0,0 +1,198 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sim
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// roundTrip parses a level, writes it with FormatLevel and parses the result, failing the test if the grids differ
+func roundTrip(t *testing.T, name, source string) {
+
+	ld, err := ParseLevel(source)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	written := FormatLevel(ld)
+	rt, err := ParseLevel(written)
+	if err != nil {
+		t.Fatalf("%s: written level doesn't parse: %v\n%s", name, err, written)
+	}
+	if !reflect.DeepEqual(rt.Grid, ld.Grid) {
+		t.Errorf("%s: written level has grid %v instead of %v\n%s", name, rt.Grid, ld.Grid, written)
+	}
+	if err := CheckRoundTrip(ld); err != nil {
+		t.Errorf("%s: %v", name, err)
+	}
+}
+
+func TestFormatLevels(t *testing.T) {
+
+	files, err := filepath.Glob("../levels/*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no levels found")
+	}
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		roundTrip(t, filepath.Base(f), string(data))
+	}
+}
+
+func TestFormatCases(t *testing.T) {
+
+	cases := map[string]string{
+		"spacers":         "]s ].] ]x\n. ]o ]",
+		"empty column":    "]s . ]x\n] ]o .",
+		"shafts":          "]s e--- ]x\n] ]o ]",
+		"shaft and block": "]s e-] ]x\n] ]o ]",
+		"unaligned":       "]s   ]x  ]o\n]  ]  ]",
+		"high start":      ".  ..]s\n]x ]o",
+	}
+	for name, source := range cases {
+		roundTrip(t, name, source)
+	}
+}
+
+// MAX_SHAFT is the highest elevator shaft in the levels generated by randomLevel
+const MAX_SHAFT int = 3
+
+// randomLevel returns a random valid level file, with columns of blocks, ice and spacers of random heights
+// and every kind of object piled on top of them
+func randomLevel(r *rand.Rand) string {
+
+	nrows, ncols := 1+r.Intn(4), 1+r.Intn(5)
+	columns := make([][]string, nrows)
+	for i := range columns {
+		columns[i] = make([]string, ncols)
+		for j := range columns[i] {
+			for k := r.Intn(5); k > 0; k-- {
+				columns[i][j] += string("]]]i."[r.Intn(5)])
+			}
+		}
+	}
+
+	// Every box needs a pad, and a start position on a pad needs a box too
+	var objects []string
+	tile := func() string { return string(DirTile(Dirs[r.Intn(len(Dirs))])) }
+	box := func() string { return string(BoxCell(BoxType(r.Intn(BoxTypes)), false)) }
+	if r.Intn(4) == 0 {
+		objects = append(objects, string(START_ON_PAD), box())
+	} else {
+		objects = append(objects, string(START))
+	}
+	for n := r.Intn(4); n > 0; n-- {
+		if r.Intn(3) == 0 {
+			objects = append(objects, string(BoxCell(BoxType(r.Intn(BoxTypes)), true)))
+		} else {
+			objects = append(objects, box(), string(PAD))
+		}
+	}
+	for n := r.Intn(3); n > 0; n-- {
+		objects = append(objects, string(ELEVATOR)+strings.Repeat(string(ELEVATOR_SHAFT), 1+r.Intn(MAX_SHAFT)))
+	}
+	for n := r.Intn(3); n > 0; n-- {
+		objects = append(objects, TELEPORTERS[n-1:n], TELEPORTERS[n-1:n])
+	}
+	for n := r.Intn(3); n > 0; n-- {
+		objects = append(objects, PLATES[n-1:n], GATES[n-1:n])
+	}
+	for n := r.Intn(3); n > 0; n-- {
+		objects = append(objects, string(CONVEYOR)+tile())
+	}
+	for n := r.Intn(3); n > 0; n-- {
+		objects = append(objects, tile())
+	}
+	for n := r.Intn(3); n > 0; n-- {
+		objects = append(objects, string(BLOCK), string(NONE)+string(NONE))
+	}
+	r.Shuffle(len(objects), func(a, b int) { objects[a], objects[b] = objects[b], objects[a] })
+	for _, obj := range objects {
+		i, j := r.Intn(nrows), r.Intn(ncols)
+		columns[i][j] += obj
+	}
+
+	// Separate the columns by a random amount of whitespace
+	rows := make([]string, nrows)
+	for i, row := range columns {
+		for j, column := range row {
+			if column == "" {
+				column = string(NONE)
+			}
+			if j > 0 {
+				rows[i] += strings.Repeat(" ", 1+r.Intn(3))
+			}
+			rows[i] += column
+		}
+	}
+	return strings.Join(rows, "\n")
+}
+
+// Random levels are written and parsed back into the same level data
+func TestFormatRandomLevels(t *testing.T) {
+
+	r := rand.New(rand.NewSource(1))
+	cells := make(map[CELL_TYPE]bool)
+	shafts := make(map[int]bool)
+	floors := 0
+	for n := 0; n < 2000; n++ {
+		source := randomLevel(r)
+		ld, err := ParseLevel(source)
+		if err != nil {
+			t.Fatalf("generated level is invalid: %v\n%s", err, source)
+		}
+		for _, row := range ld.Grid {
+			for _, column := range row {
+				for _, c := range column {
+					cells[c] = true
+				}
+			}
+		}
+		for _, e := range ld.Elevators {
+			shafts[e.High-e.Low] = true
+		}
+		if _, _, nfloors := ld.Size(); nfloors > floors {
+			floors = nfloors
+		}
+
+		if err := CheckRoundTrip(ld); err != nil {
+			t.Fatalf("%v\n%s", err, source)
+		}
+		written := FormatLevel(ld)
+		if rt, _ := ParseLevel(written); !reflect.DeepEqual(rt, ld) {
+			t.Fatalf("written level parses into %+v instead of %+v\n%s\nwritten from\n%s", rt, ld, written, source)
+		}
+	}
+
+	// Check that the levels cover every cell type and elevator height
+	all := []CELL_TYPE{
+		START, BLOCK, ICE, CONVEYOR, PAD, START_ON_PAD, ELEVATOR, ELEVATOR_SHAFT, NONE,
+		TILE_UP, TILE_DOWN, TILE_LEFT, TILE_RIGHT, CELL_TYPE(TELEPORTERS[0]), CELL_TYPE(PLATES[0]), CELL_TYPE(GATES[0]),
+	}
+	for bt := BoxType(0); int(bt) < BoxTypes; bt++ {
+		all = append(all, BoxCell(bt, false), BoxCell(bt, true))
+	}
+	for _, c := range all {
+		if !cells[c] {
+			t.Errorf("no generated level has %q", c)
+		}
+	}
+	for h := 1; h <= MAX_SHAFT; h++ {
+		if !shafts[h] {
+			t.Errorf("no generated level has an elevator shaft %d floors high", h)
+		}
+	}
+	t.Logf("generated levels up to %d floors high", floors)
+}
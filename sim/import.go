@@ -0,0 +1,290 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sim
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Characters of the XSB format used by classic Sokoban puzzles
+const (
+	XSB_WALL        = '#'
+	XSB_FLOOR       = ' '
+	XSB_BOX         = '$'
+	XSB_GOAL        = '.'
+	XSB_BOX_ON_GOAL = '*'
+	XSB_PLAYER      = '@'
+	XSB_PLAYER_GOAL = '+'
+)
+
+// ImportedLevel is a puzzle read from a file in a standard Sokoban format
+type ImportedLevel struct {
+	Title  string
+	Source string // the puzzle in Gokoban's level format (see ConvertXSB)
+}
+
+// ImportedCollection is a collection of puzzles read from a file in a standard Sokoban format
+type ImportedCollection struct {
+	Title       string
+	Author      string
+	Description string
+	Levels      []ImportedLevel
+}
+
+// isXSBRow returns whether the provided line is a row of an XSB puzzle
+// Besides spaces, "-" and "_" are also used for floor since some tools strip trailing spaces
+func isXSBRow(line string) bool {
+	line = strings.TrimRight(line, " \t")
+	if !strings.ContainsRune(line, XSB_WALL) {
+		return false
+	}
+	for _, c := range line {
+		if !strings.ContainsRune("#$.*@+ -_\t", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// ConvertXSB converts an XSB puzzle into Gokoban's level format
+// Floor becomes a block with everything on top of it and walls become two-high columns of blocks,
+// so that the gopher can't climb them and nothing can fall out of the world
+// Cells outside the walls, which the player can't reach, are left empty
+func ConvertXSB(xsb string) (string, error) {
+
+	var rows [][]rune
+	ncols := 0
+	for _, line := range strings.Split(strings.Replace(xsb, "\r", "", -1), "\n") {
+		line = strings.TrimRight(line, " \t")
+		if line == "" {
+			continue
+		}
+		if !isXSBRow(line) {
+			return "", fmt.Errorf("invalid XSB row %q", line)
+		}
+		row := []rune(strings.NewReplacer("\t", "    ", "-", " ", "_", " ").Replace(line))
+		rows = append(rows, row)
+		if len(row) > ncols {
+			ncols = len(row)
+		}
+	}
+	if len(rows) == 0 {
+		return "", errors.New("puzzle is empty")
+	}
+
+	// Make all rows equally long
+	for i := range rows {
+		for len(rows[i]) < ncols {
+			rows[i] = append(rows[i], XSB_FLOOR)
+		}
+	}
+
+	// Find the cells inside the walls by flooding from the player, and keep any boxes and goals outside
+	inside := make([][]bool, len(rows))
+	for i := range inside {
+		inside[i] = make([]bool, ncols)
+	}
+	var queue [][2]int
+	for i, row := range rows {
+		for j, c := range row {
+			if c != XSB_WALL && c != XSB_FLOOR {
+				inside[i][j] = true
+				queue = append(queue, [2]int{i, j})
+			}
+		}
+	}
+	for len(queue) > 0 {
+		i, j := queue[0][0], queue[0][1]
+		queue = queue[1:]
+		for _, d := range Dirs {
+			ni, nj := i+d.Z, j+d.X
+			if ni < 0 || ni >= len(rows) || nj < 0 || nj >= ncols || inside[ni][nj] || rows[ni][nj] == XSB_WALL {
+				continue
+			}
+			inside[ni][nj] = true
+			queue = append(queue, [2]int{ni, nj})
+		}
+	}
+
+	cells := make([][]string, len(rows))
+	for i, row := range rows {
+		cells[i] = make([]string, ncols)
+		for j, c := range row {
+			cell := string(NONE)
+			switch c {
+			case XSB_WALL:
+				cell = string(BLOCK + BLOCK)
+			case XSB_BOX:
+				cell = string(BLOCK + BOX)
+			case XSB_GOAL:
+				cell = string(BLOCK + PAD)
+			case XSB_BOX_ON_GOAL:
+				cell = string(BLOCK + BOX_ON_PAD)
+			case XSB_PLAYER:
+				cell = string(BLOCK + START)
+			case XSB_PLAYER_GOAL:
+				cell = string(BLOCK + START_ON_PAD)
+			case XSB_FLOOR:
+				if inside[i][j] {
+					cell = string(BLOCK)
+				}
+			}
+			cells[i][j] = cell
+		}
+	}
+	return formatCells(cells), nil
+}
+
+// formatCells returns the level file with the provided columns, aligned so that it is easy to read
+func formatCells(cells [][]string) string {
+
+	widths := make([]int, len(cells[0]))
+	for _, row := range cells {
+		for j, cell := range row {
+			if len(cell) > widths[j] {
+				widths[j] = len(cell)
+			}
+		}
+	}
+
+	var sb strings.Builder
+	for _, row := range cells {
+		line := ""
+		for j, cell := range row {
+			if j > 0 {
+				line += " "
+			}
+			line += cell + strings.Repeat(" ", widths[j]-len(cell))
+		}
+		sb.WriteString(strings.TrimRight(line, " "))
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// ParseXSB parses an XSB puzzle into level data (see ConvertXSB)
+func ParseXSB(xsb string) (*LevelData, error) {
+	source, err := ConvertXSB(xsb)
+	if err != nil {
+		return nil, err
+	}
+	return ParseLevel(source)
+}
+
+// ParseXSBCollection parses a text file with one or more XSB puzzles, separated by any other lines
+// A "Title:" line after a puzzle or a comment (starting with ";") before it is used as the title of the puzzle
+func ParseXSBCollection(data string) (*ImportedCollection, error) {
+
+	col := new(ImportedCollection)
+	var puzzle []string
+	var comment string
+
+	endPuzzle := func() error {
+		if len(puzzle) == 0 {
+			return nil
+		}
+		source, err := ConvertXSB(strings.Join(puzzle, "\n"))
+		if err != nil {
+			return fmt.Errorf("puzzle %d: %v", len(col.Levels)+1, err)
+		}
+		col.Levels = append(col.Levels, ImportedLevel{comment, source})
+		puzzle = nil
+		comment = ""
+		return nil
+	}
+
+	for _, line := range strings.Split(strings.Replace(data, "\r", "", -1), "\n") {
+		if isXSBRow(line) {
+			puzzle = append(puzzle, line)
+			continue
+		}
+		if err := endPuzzle(); err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(strings.ToLower(line), "title:"):
+			if n := len(col.Levels); n > 0 && col.Levels[n-1].Title == "" {
+				col.Levels[n-1].Title = strings.TrimSpace(line[len("title:"):])
+			}
+		case strings.HasPrefix(line, ";"):
+			comment = strings.TrimSpace(strings.TrimLeft(line, ";"))
+		}
+	}
+	if err := endPuzzle(); err != nil {
+		return nil, err
+	}
+
+	if len(col.Levels) == 0 {
+		return nil, errors.New("no puzzles found")
+	}
+	return col, nil
+}
+
+// slcFile is the XML structure of an SLC collection
+type slcFile struct {
+	Title       string `xml:"Title"`
+	Description string `xml:"Description"`
+	Collection  struct {
+		Author string `xml:"Author,attr"`
+		Levels []struct {
+			ID   string   `xml:"Id,attr"`
+			Rows []string `xml:"L"`
+		} `xml:"Level"`
+	} `xml:"LevelCollection"`
+}
+
+// ParseSLC parses an SLC file, the XML format used by most Sokoban collections
+func ParseSLC(data []byte) (*ImportedCollection, error) {
+
+	var f slcFile
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.CharsetReader = latin1Reader
+	err := dec.Decode(&f)
+	if err != nil {
+		return nil, err
+	}
+
+	col := new(ImportedCollection)
+	col.Title = strings.TrimSpace(f.Title)
+	col.Author = strings.TrimSpace(f.Collection.Author)
+	col.Description = strings.TrimSpace(f.Description)
+	for i, l := range f.Collection.Levels {
+		source, err := ConvertXSB(strings.Join(l.Rows, "\n"))
+		if err != nil {
+			return nil, fmt.Errorf("level %d (%v): %v", i+1, l.ID, err)
+		}
+		col.Levels = append(col.Levels, ImportedLevel{strings.TrimSpace(l.ID), source})
+	}
+
+	if len(col.Levels) == 0 {
+		return nil, errors.New("no levels found")
+	}
+	return col, nil
+}
+
+// latin1Reader converts the ISO-8859-1 text declared by most SLC files to UTF-8
+func latin1Reader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "windows-1252", "us-ascii":
+	default:
+		return nil, fmt.Errorf("unsupported charset %v", charset)
+	}
+	data, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return strings.NewReader(string(runes)), nil
+}
@@ -0,0 +1,126 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sim
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConvertXSB(t *testing.T) {
+
+	cases := []struct {
+		name   string
+		xsb    string
+		source string
+	}{{
+		"corridor",
+		"#####\n#@$.#\n#####",
+		"]] ]] ]] ]] ]]\n]] ]s ]x ]o ]]\n]] ]] ]] ]] ]]\n",
+	}, {
+		"outside the walls",
+		"  ####\n###  #\n#@$* #\n#  . #\n######",
+		".  .  ]] ]] ]] ]]\n]] ]] ]] ]  ]  ]]\n]] ]s ]x ]X ]  ]]\n]] ]  ]  ]o ]  ]]\n]] ]] ]] ]] ]] ]]\n",
+	}, {
+		"player on goal and floor written as dashes",
+		"####\r\n#+$#\r\n#-_#\r\n####\r\n",
+		"]] ]] ]] ]]\n]] ]S ]x ]]\n]] ]  ]  ]]\n]] ]] ]] ]]\n",
+	}}
+	for _, c := range cases {
+		source, err := ConvertXSB(c.xsb)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if source != c.source {
+			t.Errorf("%s: converted to\n%s\ninstead of\n%s", c.name, source, c.source)
+		}
+		if _, err := ParseLevel(source); err != nil {
+			t.Errorf("%s: converted level doesn't parse: %v", c.name, err)
+		}
+	}
+
+	for _, xsb := range []string{"", "#@$.#\n#abc#"} {
+		if _, err := ConvertXSB(xsb); err == nil {
+			t.Errorf("%q converted without an error", xsb)
+		}
+	}
+}
+
+func TestParseXSB(t *testing.T) {
+
+	ld, err := ParseXSB("#####\n#@$.#\n#####")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ld.GopherInit != (GridLoc{2, 2, 1}) {
+		t.Errorf("gopher starts at %v instead of %v", ld.GopherInit, GridLoc{2, 2, 1})
+	}
+	if !reflect.DeepEqual(ld.BoxesInit, []GridLoc{{2, 3, 1}}) {
+		t.Errorf("boxes start at %v instead of %v", ld.BoxesInit, []GridLoc{{2, 3, 1}})
+	}
+	if !reflect.DeepEqual(ld.Pads, []GridLoc{{2, 4, 1}}) {
+		t.Errorf("pads at %v instead of %v", ld.Pads, []GridLoc{{2, 4, 1}})
+	}
+	for x := 1; x <= 5; x++ {
+		if c := ld.Get(GridLoc{1, x, 1}); c != BLOCK {
+			t.Errorf("wall at column %d is %q on the gopher's floor instead of a block", x, c)
+		}
+	}
+}
+
+func TestParseXSBCollection(t *testing.T) {
+
+	data := "; First\n#####\n#@$.#\n#####\n\n#####\n#.$@#\n#####\nTitle: Second\nAuthor: someone\n"
+	col, err := ParseXSBCollection(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(col.Levels) != 2 {
+		t.Fatalf("found %d puzzles instead of 2", len(col.Levels))
+	}
+	for i, title := range []string{"First", "Second"} {
+		if col.Levels[i].Title != title {
+			t.Errorf("puzzle %d has title %q instead of %q", i+1, col.Levels[i].Title, title)
+		}
+		if _, err := ParseLevel(col.Levels[i].Source); err != nil {
+			t.Errorf("puzzle %d: %v", i+1, err)
+		}
+	}
+
+	if _, err := ParseXSBCollection("no puzzles here\n"); err == nil {
+		t.Error("collection without puzzles parsed without an error")
+	}
+}
+
+func TestParseSLC(t *testing.T) {
+
+	data := []byte("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>\n" +
+		"<SokobanLevels>\n" +
+		"<Title>Caf\xe9 </Title>\n" +
+		"<Description>Two puzzles</Description>\n" +
+		"<LevelCollection Copyright=\"none\" MaxWidth=\"5\" MaxHeight=\"3\" Author=\"Someone\">\n" +
+		"<Level Id=\"One\" Width=\"5\" Height=\"3\"><L>#####</L><L>#@$.#</L><L>#####</L></Level>\n" +
+		"<Level Id=\"Two\" Width=\"5\" Height=\"3\"><L>#####</L><L>#.$@#</L><L>#####</L></Level>\n" +
+		"</LevelCollection>\n" +
+		"</SokobanLevels>\n")
+	col, err := ParseSLC(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if col.Title != "Café" || col.Author != "Someone" || col.Description != "Two puzzles" {
+		t.Errorf("collection is %q by %q (%q)", col.Title, col.Author, col.Description)
+	}
+	if len(col.Levels) != 2 || col.Levels[0].Title != "One" || col.Levels[1].Title != "Two" {
+		t.Fatalf("found levels %+v", col.Levels)
+	}
+	want, _ := ConvertXSB("#####\n#@$.#\n#####")
+	if col.Levels[0].Source != want {
+		t.Errorf("first level converted to\n%s\ninstead of\n%s", col.Levels[0].Source, want)
+	}
+
+	if _, err := ParseSLC([]byte("<SokobanLevels><LevelCollection></LevelCollection></SokobanLevels>")); err == nil {
+		t.Error("collection without levels parsed without an error")
+	}
+}
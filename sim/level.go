@@ -0,0 +1,506 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sim implements the rules of Gokoban independently of any rendering,
+// so that levels can be simulated, tested and solved without a window.
+package sim
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+type CELL_TYPE string
+
+const (
+	START          CELL_TYPE = "s"
+	BLOCK          CELL_TYPE = "]"
+	ICE            CELL_TYPE = "i" // a slippery block: objects that move onto it keep sliding
+	CONVEYOR       CELL_TYPE = "=" // a conveyor belt block, which needs a directional tile above it e.g. =>
+	BOX            CELL_TYPE = "x"
+	PAD            CELL_TYPE = "o"
+	BOX_ON_PAD     CELL_TYPE = "X" // a box that starts on a pad
+	HEAVY_BOX      CELL_TYPE = "h" // see BoxHeavy
+	HEAVY_ON_PAD   CELL_TYPE = "H"
+	FRAGILE_BOX    CELL_TYPE = "f" // see BoxFragile
+	FRAGILE_ON_PAD CELL_TYPE = "F"
+	GLUED_BOX      CELL_TYPE = "g" // see BoxGlued
+	GLUED_ON_PAD   CELL_TYPE = "G"
+	START_ON_PAD   CELL_TYPE = "S" // a start position on a pad
+	ELEVATOR       CELL_TYPE = "e"
+	ELEVATOR_SHAFT CELL_TYPE = "-"
+	NONE           CELL_TYPE = "."
+
+	// Directional tiles: on top of a conveyor belt they set the way it moves things,
+	// anywhere else they can only be entered going their way (or from above)
+	TILE_UP    CELL_TYPE = "^" // towards the first row
+	TILE_DOWN  CELL_TYPE = "v" // towards the last row
+	TILE_LEFT  CELL_TYPE = "<" // towards the first column
+	TILE_RIGHT CELL_TYPE = ">" // towards the last column
+)
+
+// tileDirs are the directions of the directional tiles
+var tileDirs = map[CELL_TYPE]Dir{TILE_UP: Up, TILE_DOWN: Down, TILE_LEFT: Left, TILE_RIGHT: Right}
+
+// TileDir returns the direction of a directional tile, if the cell type is one
+func (c CELL_TYPE) TileDir() (Dir, bool) {
+	d, ok := tileDirs[c]
+	return d, ok
+}
+
+// IsTile returns whether the cell type is a directional tile
+func (c CELL_TYPE) IsTile() bool {
+	_, ok := tileDirs[c]
+	return ok
+}
+
+// DirTile returns the directional tile with the provided direction
+func DirTile(d Dir) CELL_TYPE {
+	for c, cd := range tileDirs {
+		if cd == d {
+			return c
+		}
+	}
+	return NONE
+}
+
+// BoxType is the kind of a box, which changes how it can be moved
+type BoxType int
+
+const (
+	BoxNormal  BoxType = iota
+	BoxHeavy           // can't be pushed while another box is on top of it
+	BoxFragile         // breaks if it falls more than one floor, which fails the level
+	BoxGlued           // stuck to the box right below it (if there is one), so that they only move together
+)
+
+// boxCells are the cell types of each type of box, on its own and on a pad
+var boxCells = [...][2]CELL_TYPE{
+	BoxNormal:  {BOX, BOX_ON_PAD},
+	BoxHeavy:   {HEAVY_BOX, HEAVY_ON_PAD},
+	BoxFragile: {FRAGILE_BOX, FRAGILE_ON_PAD},
+	BoxGlued:   {GLUED_BOX, GLUED_ON_PAD},
+}
+
+// BoxTypes is the number of box types
+const BoxTypes int = len(boxCells)
+
+// BoxCell returns the cell type of a box of the provided type, on a pad or not
+func BoxCell(t BoxType, onPad bool) CELL_TYPE {
+	if onPad {
+		return boxCells[t][1]
+	}
+	return boxCells[t][0]
+}
+
+// Box returns the type of the box the cell type starts with and whether it starts on a pad, if it has one
+func (c CELL_TYPE) Box() (t BoxType, onPad bool, ok bool) {
+	for i, cells := range boxCells {
+		for j, bc := range cells {
+			if c == bc {
+				return BoxType(i), j == 1, true
+			}
+		}
+	}
+	return BoxNormal, false, false
+}
+
+// TELEPORTERS are the cell types of teleporters: each digit marks the two ends of a pair, e.g. `]1` in two columns
+const TELEPORTERS string = "123456789"
+
+// IsTeleporter returns whether the cell type is an end of a teleporter pair
+func (c CELL_TYPE) IsTeleporter() bool {
+	return len(c) == 1 && strings.Contains(TELEPORTERS, string(c))
+}
+
+// PLATES are the cell types of pressure plates, and GATES those of the gates they open, linked by letter e.g. `]a` opens `]A`
+const PLATES string = "abcd"
+const GATES string = "ABCD"
+
+// IsPlate returns whether the cell type is a pressure plate
+func (c CELL_TYPE) IsPlate() bool {
+	return len(c) == 1 && strings.Contains(PLATES, string(c))
+}
+
+// IsGate returns whether the cell type is a gate
+func (c CELL_TYPE) IsGate() bool {
+	return len(c) == 1 && strings.Contains(GATES, string(c))
+}
+
+// Link returns the plate cell type that links a plate or gate to the others, e.g. a for both a and A
+func (c CELL_TYPE) Link() CELL_TYPE {
+	return CELL_TYPE(strings.ToLower(string(c)))
+}
+
+// ADD_TO_NFLOORS is the number of empty floors added above the tallest column of a level
+const ADD_TO_NFLOORS int = 2
+
+// GridLoc is a location in the level grid: Z is the row, X is the column and Y is the floor
+type GridLoc struct {
+	Z, X, Y int
+}
+
+// ElevatorData describes the initial location of an elevator and its range of motion
+type ElevatorData struct {
+	Loc  GridLoc
+	Low  int
+	High int
+}
+
+// TeleporterData describes the two ends of a teleporter pair
+type TeleporterData struct {
+	Cell CELL_TYPE // the digit the pair is written as
+	Ends [2]GridLoc
+}
+
+// PlateData describes a pressure plate, which opens the gates with the same link while something is on it
+type PlateData struct {
+	Link CELL_TYPE // the plate's letter
+	Loc  GridLoc
+}
+
+// GateData describes a gate, which is solid unless one of the plates with the same link is pressed
+// Gates can't close on something, so they stay open until they are empty
+type GateData struct {
+	Link CELL_TYPE // the letter of the plates that open the gate
+	Loc  GridLoc
+}
+
+// TileData describes a directional tile: a conveyor belt (the cell right above the belt) or a one-way tile
+type TileData struct {
+	Loc GridLoc
+	Dir Dir
+}
+
+// LevelData contains all the logical information about a level
+type LevelData struct {
+	Grid        [][][]CELL_TYPE // cell types indexed by [z][x][y], including padding
+	GopherInit  GridLoc
+	BoxesInit   []GridLoc
+	BoxTypes    []BoxType // the type of each box in BoxesInit, if any isn't normal
+	Pads        []GridLoc
+	Elevators   []ElevatorData
+	Teleporters []TeleporterData // ordered by digit
+	Plates      []PlateData
+	Gates       []GateData
+	Conveyors   []TileData // objects in these cells are moved one cell their way after every step
+	OneWays     []TileData // these cells can only be entered going their way
+}
+
+// Size returns the dimensions of the level grid, including padding
+func (ld *LevelData) Size() (nrows, ncols, nfloors int) {
+	nrows = len(ld.Grid)
+	if nrows > 0 {
+		ncols = len(ld.Grid[0])
+		if ncols > 0 {
+			nfloors = len(ld.Grid[0][0])
+		}
+	}
+	return
+}
+
+// Center returns the center of the level in grid coordinates
+func (ld *LevelData) Center() (x, y, z float32) {
+	nrows, ncols, nfloors := ld.Size()
+	x = float32(ncols)/2 - 0.5
+	y = float32(nfloors-ADD_TO_NFLOORS)/2 - 0.5
+	z = float32(nrows)/2 - 0.5
+	return
+}
+
+// InBounds returns whether the provided location is inside the level grid
+func (ld *LevelData) InBounds(loc GridLoc) bool {
+	nrows, ncols, nfloors := ld.Size()
+	return loc.Z >= 0 && loc.Z < nrows && loc.X >= 0 && loc.X < ncols && loc.Y >= 0 && loc.Y < nfloors
+}
+
+// Get returns the cell type at the provided location as it was parsed
+func (ld *LevelData) Get(loc GridLoc) CELL_TYPE {
+	if !ld.InBounds(loc) {
+		return NONE
+	}
+	return ld.Grid[loc.Z][loc.X][loc.Y]
+}
+
+func (ld *LevelData) IsPad(pl GridLoc) bool {
+	for _, a := range ld.Pads {
+		if a == pl {
+			return true
+		}
+	}
+	return false
+}
+
+// Teleport returns the other end of the teleporter at the provided location, if there is one
+func (ld *LevelData) Teleport(loc GridLoc) (GridLoc, bool) {
+	for _, t := range ld.Teleporters {
+		if t.Ends[0] == loc {
+			return t.Ends[1], true
+		}
+		if t.Ends[1] == loc {
+			return t.Ends[0], true
+		}
+	}
+	return GridLoc{}, false
+}
+
+// Conveyor returns the direction of the conveyor belt under the provided location, if there is one
+func (ld *LevelData) Conveyor(loc GridLoc) (Dir, bool) {
+	for _, t := range ld.Conveyors {
+		if t.Loc == loc {
+			return t.Dir, true
+		}
+	}
+	return Dir{}, false
+}
+
+// CanEnter returns whether the provided location can be entered going the provided way, which isn't the case
+// for one-way tiles pointing another way
+func (ld *LevelData) CanEnter(loc GridLoc, d Dir) bool {
+	for _, t := range ld.OneWays {
+		if t.Loc == loc {
+			return t.Dir == d
+		}
+	}
+	return true
+}
+
+// BoxType returns the type of the i-th box
+func (ld *LevelData) BoxType(i int) BoxType {
+	if i >= len(ld.BoxTypes) {
+		return BoxNormal
+	}
+	return ld.BoxTypes[i]
+}
+
+// linked returns whether there is a gate (or a plate) with the provided link
+func (ld *LevelData) linked(link CELL_TYPE, gate bool) bool {
+	if gate {
+		for _, g := range ld.Gates {
+			if g.Link == link {
+				return true
+			}
+		}
+		return false
+	}
+	for _, p := range ld.Plates {
+		if p.Link == link {
+			return true
+		}
+	}
+	return false
+}
+
+// LevelID returns a stable identifier for a level based on the cells of its grid rather than the layout of its file,
+// so that rewriting a level (e.g. with FormatLevel) keeps the identifier. Files that don't parse are identified by their text
+func LevelID(source string) string {
+	key := strings.TrimSpace(strings.Replace(source, "\r", "", -1))
+	if ld, err := ParseLevel(source); err == nil {
+		key = ld.gridKey()
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// gridKey encodes the cells of the level without the padding added by ParseLevel, each column from the bottom floor
+// up to its highest cell that isn't empty, with columns separated by "|" and rows by "/"
+func (ld *LevelData) gridKey() string {
+	var b strings.Builder
+	nrows, ncols, _ := ld.Size()
+	for i := 1; i < nrows-1; i++ {
+		if i > 1 {
+			b.WriteByte('/')
+		}
+		for j := 1; j < ncols-1; j++ {
+			if j > 1 {
+				b.WriteByte('|')
+			}
+			column := ld.Grid[i][j]
+			top := len(column)
+			for top > 0 && column[top-1] == NONE {
+				top--
+			}
+			for _, c := range column[:top] {
+				b.WriteString(string(c))
+			}
+		}
+	}
+	return b.String()
+}
+
+// ParseLevel parses a level file, returning LevelErrors describing every problem found if it isn't valid
+func ParseLevel(data string) (*LevelData, error) {
+
+	ld := new(LevelData)
+	var errs LevelErrors
+
+	// Ignore carriage returns and trailing empty lines
+	data = strings.TrimRight(strings.Replace(data, "\r", "", -1), "\n")
+	if strings.TrimSpace(data) == "" {
+		return nil, LevelErrors{{Msg: "level is empty"}}
+	}
+
+	// Check that all rows have the same number of columns
+	rows := strings.Split(data, "\n")
+	ncols := len(strings.Fields(rows[0]))
+	for i, row := range rows {
+		if n := len(strings.Fields(row)); n != ncols {
+			errs = append(errs, &LevelError{Row: i + 1, Msg: fmt.Sprintf("row has %d columns but the first row has %d", n, ncols)})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	// Pad row-wise
+	for i, row := range rows {
+		rows[i] = ". " + row + " ."
+	}
+
+	// Pad column-wise
+	ncols += 2
+	padding_row := strings.Repeat(". ", ncols)
+	rows = append([]string{padding_row}, rows...)
+	rows = append(rows, padding_row)
+	nrows := len(rows)
+
+	// Calculate max number of floors
+	cells := strings.Fields(data)
+	nfloors := 1
+	for _, c := range cells {
+		if len(c) > nfloors {
+			nfloors = len(c)
+		}
+	}
+	nfloors += ADD_TO_NFLOORS // necessary
+
+	// Initialize slices
+	ld.Grid = make([][][]CELL_TYPE, nrows)
+	for i := range ld.Grid {
+		ld.Grid[i] = make([][]CELL_TYPE, ncols)
+		for j := range ld.Grid[i] {
+			ld.Grid[i][j] = make([]CELL_TYPE, nfloors)
+			for k := range ld.Grid[i][j] {
+				ld.Grid[i][j][k] = NONE
+			}
+		}
+	}
+
+	var starts []GridLoc
+	var boxTypes []BoxType
+	special := false // whether there are boxes that aren't normal
+	teleporters := make(map[CELL_TYPE][]GridLoc)
+	for i, row := range rows {
+		cells := strings.Fields(row)
+		for j, cell := range cells {
+			for k, c := range cell {
+				loc := GridLoc{i, j, k}
+				cc := CELL_TYPE(c)
+				ld.Grid[i][j][k] = cc
+				switch cc {
+				case START:
+					ld.GopherInit = loc
+					starts = append(starts, loc)
+				case BOX, HEAVY_BOX, FRAGILE_BOX, GLUED_BOX, BOX_ON_PAD, HEAVY_ON_PAD, FRAGILE_ON_PAD, GLUED_ON_PAD:
+					t, onPad, _ := cc.Box()
+					ld.BoxesInit = append(ld.BoxesInit, loc)
+					boxTypes = append(boxTypes, t)
+					if t != BoxNormal {
+						special = true
+					}
+					if onPad {
+						ld.Pads = append(ld.Pads, loc)
+					}
+				case PAD:
+					ld.Pads = append(ld.Pads, loc)
+				case START_ON_PAD:
+					ld.GopherInit = loc
+					starts = append(starts, loc)
+					ld.Pads = append(ld.Pads, loc)
+				case ELEVATOR:
+					// Calculate number of floors
+					var high int
+					for high = k; (high+1) < len(cell) && string(cell[high+1]) == string(ELEVATOR_SHAFT); high++ {
+					}
+					if high == k {
+						errs = append(errs, errorAt(loc, "elevator has no shaft (add hyphens above it e.g. e--)"))
+					}
+					ld.Elevators = append(ld.Elevators, ElevatorData{loc, k, high})
+				case ELEVATOR_SHAFT:
+					if k == 0 || (string(cell[k-1]) != string(ELEVATOR) && string(cell[k-1]) != string(ELEVATOR_SHAFT)) {
+						errs = append(errs, errorAt(loc, "elevator shaft has no elevator below it"))
+					}
+				case CONVEYOR:
+					if (k+1) >= len(cell) || !CELL_TYPE(cell[k+1]).IsTile() {
+						errs = append(errs, errorAt(loc, "conveyor belt has no direction (add an arrow above it e.g. =>)"))
+					}
+				case TILE_UP, TILE_DOWN, TILE_LEFT, TILE_RIGHT:
+					d, _ := cc.TileDir()
+					if k > 0 && CELL_TYPE(cell[k-1]) == CONVEYOR {
+						ld.Conveyors = append(ld.Conveyors, TileData{loc, d})
+					} else {
+						ld.OneWays = append(ld.OneWays, TileData{loc, d})
+					}
+				case BLOCK, ICE, NONE:
+				default:
+					if cc.IsTeleporter() {
+						teleporters[cc] = append(teleporters[cc], loc)
+						break
+					}
+					if cc.IsPlate() {
+						ld.Plates = append(ld.Plates, PlateData{cc, loc})
+						break
+					}
+					if cc.IsGate() {
+						ld.Gates = append(ld.Gates, GateData{cc.Link(), loc})
+						break
+					}
+					errs = append(errs, errorAt(loc, "unknown character %q", c))
+				}
+			}
+		}
+	}
+
+	if len(starts) == 0 {
+		errs = append(errs, &LevelError{Msg: "level has no start position (s or S)"})
+	}
+	if len(starts) > 1 {
+		for _, loc := range starts {
+			errs = append(errs, errorAt(loc, "level has %d start positions but must have exactly one", len(starts)))
+		}
+	}
+	if special {
+		ld.BoxTypes = boxTypes
+	}
+	for _, c := range TELEPORTERS {
+		ends := teleporters[CELL_TYPE(c)]
+		if len(ends) == 2 {
+			ld.Teleporters = append(ld.Teleporters, TeleporterData{CELL_TYPE(c), [2]GridLoc{ends[0], ends[1]}})
+			continue
+		}
+		for _, loc := range ends {
+			errs = append(errs, errorAt(loc, "teleporter %c must have exactly two ends, not %d", c, len(ends)))
+		}
+	}
+	for _, p := range ld.Plates {
+		if !ld.linked(p.Link, true) {
+			errs = append(errs, errorAt(p.Loc, "pressure plate %v has no gate (%v) to open", p.Link, strings.ToUpper(string(p.Link))))
+		}
+	}
+	for _, g := range ld.Gates {
+		if !ld.linked(g.Link, false) {
+			errs = append(errs, errorAt(g.Loc, "gate %v has no pressure plate (%v) to open it", strings.ToUpper(string(g.Link)), g.Link))
+		}
+	}
+	if len(ld.BoxesInit) != len(ld.Pads) {
+		errs = append(errs, &LevelError{Msg: fmt.Sprintf("level has %d boxes but %d pads", len(ld.BoxesInit), len(ld.Pads))})
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return ld, nil
+}
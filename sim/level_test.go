@@ -0,0 +1,35 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sim
+
+import (
+	"testing"
+)
+
+func TestLevelID(t *testing.T) {
+
+	id := LevelID("]s ]x ]o\n] . ]")
+	same := []string{
+		"]s ]x ]o\n] . ]\n",
+		"  ]s  ]x ]o\r\n]   .  ]",
+		"]s ]x ]o\n] .. ]",
+	}
+	for _, source := range same {
+		if LevelID(source) != id {
+			t.Errorf("%q has ID %v instead of %v", source, LevelID(source), id)
+		}
+	}
+	different := []string{
+		"]s ]o ]x\n] . ]",
+		"]s ]x ]o\n] ] ]",
+		"]s ]x ]o ]\n] . ] .",
+		"]s ]x ]o\n] . ]\n. . .",
+	}
+	for _, source := range different {
+		if LevelID(source) == id {
+			t.Errorf("%q has the same ID as a different level", source)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sim
+
+// Lint checks a parsed level for design problems that ParseLevel accepts
+func Lint(ld *LevelData) LevelErrors {
+
+	var errs LevelErrors
+
+	// Pads should be on top of a block (see levels/README.md)
+	for _, pad := range ld.Pads {
+		below := pad
+		below.Y--
+		if c := ld.Get(below); c != BLOCK && c != ICE {
+			errs = append(errs, errorAt(pad, "pad has no block under it"))
+		}
+	}
+
+	if d := NewState(ld).Deadlock(); d != nil {
+		errs = append(errs, errorAt(ld.GopherInit, "level can't be won from the start: %v", d.Reason))
+	}
+
+	for _, i := range unreachableBoxes(ld) {
+		errs = append(errs, errorAt(ld.BoxesInit[i], "box can't be reached from the start position"))
+	}
+
+	return errs
+}
+
+// LINT_MAX_STATES is the maximum number of states Lint visits looking for the boxes the gopher can reach
+const LINT_MAX_STATES int = 200000
+
+// unreachableBoxes returns the indices of the boxes the gopher can't get to from the start position
+// A box is reached once the gopher stands next to it or something moves it. Levels with too many states
+// to explore are assumed to have every box within reach, so that only sure problems are reported
+func unreachableBoxes(ld *LevelData) []int {
+
+	reached := make([]bool, len(ld.BoxesInit))
+	left := len(reached)
+	reach := func(box Obj) {
+		if box.Kind == ObjBox && !reached[box.Index] {
+			reached[box.Index] = true
+			left--
+		}
+	}
+
+	start := NewState(ld)
+	visited := map[string]bool{start.Key(): true}
+	queue := []*State{start}
+
+	for len(queue) > 0 && left > 0 {
+		s := queue[0]
+		queue = queue[1:]
+
+		for _, d := range Dirs {
+			ahead, _ := s.getCellRelativeTo(gopher, d.Z, d.X, 0)
+			reach(ahead)
+
+			next := s.Clone()
+			events := next.StepDir(d)
+			if next.Failed() {
+				continue
+			}
+			for _, ev := range events {
+				reach(ev.Obj)
+			}
+
+			key := next.Key()
+			if !visited[key] {
+				if len(visited) >= LINT_MAX_STATES {
+					return nil
+				}
+				visited[key] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	var unreached []int
+	for i, ok := range reached {
+		if !ok {
+			unreached = append(unreached, i)
+		}
+	}
+	return unreached
+}
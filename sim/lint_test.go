@@ -0,0 +1,62 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sim
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLintLevels(t *testing.T) {
+
+	files, err := filepath.Glob("../levels/*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ld, err := ParseLevel(string(data))
+		if err != nil {
+			t.Fatalf("%s: %v", filepath.Base(f), err)
+		}
+		if errs := Lint(ld); len(errs) > 0 {
+			t.Errorf("%s: %v", filepath.Base(f), errs)
+		}
+	}
+}
+
+func TestLint(t *testing.T) {
+
+	cases := []struct {
+		name  string
+		level string
+		errs  []string // the messages of the errors expected, in order
+	}{
+		{"clean", "]s ]x ]o", nil},
+		{"pad without block", "]s ]x ] o", []string{"pad has no block under it"}},
+		{"cornered box", "]] ]] ]\n]] ]x ]s\n. ]o ]", []string{"level can't be won from the start: a box is stuck in a corner"}},
+		{"unreachable box", "]s ]x ]o ]] ]x ]o", []string{"box can't be reached from the start position"}},
+		{"no box reachable", "]s ]] ]x ]o", []string{"box can't be reached from the start position"}},
+	}
+	for _, c := range cases {
+		ld, err := ParseLevel(c.level)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		errs := Lint(ld)
+		var msgs []string
+		for _, e := range errs {
+			msgs = append(msgs, e.Msg)
+		}
+		if strings.Join(msgs, "\n") != strings.Join(c.errs, "\n") {
+			t.Errorf("%s: lint errors %q instead of %q", c.name, msgs, c.errs)
+		}
+	}
+}
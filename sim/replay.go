@@ -0,0 +1,127 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sim
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// REPLAY_VERSION is the version of the replay file format written by Replay.Write
+const REPLAY_VERSION int = 1
+
+// Replay actions other than steps (steps are stored as the direction's letter)
+const (
+	ACTION_UNDO string = "undo"
+	ACTION_REDO string = "redo"
+)
+
+// Replay is the recording of a single attempt at a level
+type Replay struct {
+	Version int          `json:"version"`
+	Level   string       `json:"level"`  // name of the level file
+	Source  string       `json:"source"` // contents of the level file, so the replay can be checked against it
+	Started time.Time    `json:"started"`
+	Moves   []ReplayMove `json:"moves"`
+}
+
+// ReplayMove is a single action taken by the player during an attempt
+type ReplayMove struct {
+	Time   float64 `json:"t"` // seconds since the start of the attempt
+	Action string  `json:"a"` // "u", "d", "l" or "r" for steps (see Dir), or one of the ACTION_ constants
+}
+
+// NewReplay returns a pointer to a new, empty Replay for the provided level
+func NewReplay(level, source string) *Replay {
+	r := new(Replay)
+	r.Version = REPLAY_VERSION
+	r.Level = level
+	r.Source = source
+	r.Started = time.Now()
+	return r
+}
+
+// Add records an action taken now
+func (r *Replay) Add(action string) {
+	r.Moves = append(r.Moves, ReplayMove{time.Since(r.Started).Seconds(), action})
+}
+
+// Write writes the replay to w as indented JSON
+func (r *Replay) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(r)
+}
+
+// ReadReplay reads a replay written by Replay.Write
+func ReadReplay(rd io.Reader) (*Replay, error) {
+	r := new(Replay)
+	if err := json.NewDecoder(rd).Decode(r); err != nil {
+		return nil, err
+	}
+	if r.Version < 1 || r.Version > REPLAY_VERSION {
+		return nil, fmt.Errorf("unsupported replay version %d", r.Version)
+	}
+	for i, m := range r.Moves {
+		if _, ok := ParseDir(m.Action); !ok && m.Action != ACTION_UNDO && m.Action != ACTION_REDO {
+			return nil, fmt.Errorf("move %d: unknown action %q", i+1, m.Action)
+		}
+	}
+	return r, nil
+}
+
+// Play applies all the moves of the replay to a new state of the provided level and returns the final state
+func (r *Replay) Play(ld *LevelData) *State {
+	s, _ := r.play(ld)
+	return s
+}
+
+// History returns the moves that lead from the initial state of the level to the final state of the replay
+// Steps that bumped into something and steps that were undone are left out
+func (r *Replay) History(ld *LevelData) []Move {
+	_, history := r.play(ld)
+	return history
+}
+
+// replayStep is a state that can be returned to by undoing or redoing, along with the move that led to it
+type replayStep struct {
+	state *State
+	move  Move
+}
+
+func (r *Replay) play(ld *LevelData) (*State, []Move) {
+
+	s := NewState(ld)
+	var history []Move
+	var undo, redo []replayStep
+	for _, m := range r.Moves {
+		switch m.Action {
+		case ACTION_UNDO:
+			if len(undo) > 0 {
+				redo = append(redo, replayStep{s, history[len(history)-1]})
+				s, undo = undo[len(undo)-1].state, undo[:len(undo)-1]
+				history = history[:len(history)-1]
+			}
+		case ACTION_REDO:
+			if len(redo) > 0 {
+				undo = append(undo, replayStep{state: s})
+				next := redo[len(redo)-1]
+				s, redo = next.state, redo[:len(redo)-1]
+				history = append(history, next.move)
+			}
+		default:
+			d, _ := ParseDir(m.Action)
+			prev := s.Clone()
+			if move, ok := stepMove(s, d); ok {
+				undo = append(undo, replayStep{state: prev})
+				redo = nil
+				history = append(history, move)
+			}
+		}
+	}
+	return s, history
+}
@@ -0,0 +1,532 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sim
+
+// FALL_OUT_Y is the floor that objects falling out of the world are sent to
+const FALL_OUT_Y int = -20
+
+// Step processes a gopher step to the provided direction and returns everything that happened as a result.
+// All consequences of the step (pushes, falls and elevators) are resolved before returning, followed by
+// the conveyor belts moving what is on them (see tick). The returned events are ordered by the time at which they happen.
+func (s *State) Step(zd, xd int) []Event {
+
+	s.now = 0
+	s.events = nil
+	if s.failed {
+		return nil
+	}
+
+	// Check if can move
+	d := Dir{zd, xd}
+	c, cl := s.getCellRelativeTo(gopher, zd, xd, 0)
+	moved := false
+
+	if !s.data.CanEnter(cl, d) {
+		s.emit(EventBump, gopher)
+	} else if !c.IsNone() {
+		if c.IsPushable() {
+			// Check if box can be pushed (if there is space behind it)
+			cn, cnl := s.getCellRelativeTo(gopher, 2*zd, 2*xd, 0)
+			if cn.IsNone() && s.data.CanEnter(cnl, d) && s.canPush(c, d) {
+				s.pushBox(c, cnl)
+				s.moveGopherTo(cl)
+				moved = true
+			} else {
+				s.emit(EventBump, gopher)
+			}
+		} else {
+			s.emit(EventBump, gopher)
+		}
+	} else {
+		s.moveGopherTo(cl)
+		moved = true
+	}
+
+	s.run()
+	if moved && !s.failed {
+		s.tick()
+		s.run()
+	}
+
+	events := s.events
+	s.events = nil
+	return events
+}
+
+// tick moves everything resting on a conveyor belt one cell its way, along with what is piled on top of it
+// Objects move in a chain: one whose way is blocked by another object moves once that one is out of the way
+func (s *State) tick() {
+
+	conveyed := make(map[Obj]bool)
+	for progress := true; progress; {
+		progress = false
+		for _, t := range s.data.Conveyors {
+			obj := s.Get(t.Loc)
+			if !obj.IsPushable() || conveyed[obj] {
+				continue
+			}
+			dest := GridLoc{t.Loc.Z + t.Dir.Z, t.Loc.X + t.Dir.X, t.Loc.Y}
+			if !s.Get(dest).IsNone() || !s.data.CanEnter(dest, t.Dir) || !s.canMove(s.gluedOn(obj), t.Dir) {
+				continue
+			}
+			conveyed[obj] = true
+			s.moveStack(obj, dest, EventConvey)
+			progress = true
+		}
+	}
+}
+
+// run calls the scheduled callbacks in chronological order until there are none left
+func (s *State) run() {
+
+	for len(s.pending) > 0 {
+		// Callbacks scheduled for the same time run in the order they were scheduled
+		next := 0
+		for i, cb := range s.pending {
+			if cb.time < s.pending[next].time {
+				next = i
+			}
+		}
+		cb := s.pending[next]
+		s.pending = append(s.pending[:next], s.pending[next+1:]...)
+		s.now = cb.time
+		cb.fn()
+		s.updateGates()
+	}
+}
+
+// emit records an instantaneous event for the provided object
+func (s *State) emit(t EventType, obj Obj) {
+	loc := s.Location(obj)
+	s.events = append(s.events, Event{Type: t, Obj: obj, From: loc, To: loc, Time: s.now, Sound: true})
+}
+
+// animate records a movement event for an object, moves the object in the grid
+// and schedules the callback for when the movement finishes
+func (s *State) animate(t EventType, obj Obj, dest GridLoc, delete bool, sound bool, cb func(Obj)) {
+
+	oloc := s.Location(obj)
+	ev := Event{Type: t, Obj: obj, From: oloc, To: dest, Time: s.now, Sound: sound}
+	s.events = append(s.events, ev)
+
+	// Move in matrix
+	s.set(oloc, none)
+	if !delete {
+		s.set(dest, obj)
+	}
+	s.setLocation(obj, dest)
+
+	if cb != nil {
+		s.pending = append(s.pending, callback{ev.End(), func() { cb(obj) }})
+	}
+}
+
+// getCellRelativeToLoc returns the object and location
+// relative to the provided location using the provided deltas
+func (s *State) getCellRelativeToLoc(p GridLoc, zd, xd, yd int) (Obj, GridLoc) {
+	cell_loc := p
+	cell_loc.X += xd
+	cell_loc.Y += yd
+	cell_loc.Z += zd
+	return s.Get(cell_loc), cell_loc
+}
+
+// getCellRelativeTo returns the object and location
+// relative to the location of the provided object using the provided deltas
+func (s *State) getCellRelativeTo(c Obj, zd, xd, yd int) (Obj, GridLoc) {
+	return s.getCellRelativeToLoc(s.Location(c), zd, xd, yd)
+}
+
+// moveGopherTo moves the gopher and sets up the appropriate callbacks
+func (s *State) moveGopherTo(pos GridLoc) {
+
+	t := EventWalk
+	floor, _ := s.getCellRelativeToLoc(pos, 0, 0, -1)
+	if floor.IsNone() {
+		t = EventStepOff
+	}
+
+	oldloc := s.gopher
+	d := Dir{pos.Z - oldloc.Z, pos.X - oldloc.X}
+	s.animate(t, gopher, pos, false, true, func(obj Obj) {
+		s.moveAwayFrom(oldloc)
+		s.afterMove(obj, d)
+	})
+}
+
+// boxOnPad handles what happens when a box enters a pad
+func (s *State) boxOnPad(box Obj) {
+	if !s.lit[box.Index] {
+		s.lit[box.Index] = true
+		s.emit(EventOnPad, box)
+		if s.Complete() {
+			s.emit(EventComplete, box)
+		}
+	}
+}
+
+// boxOffPad handles what happens when a box leaves a pad
+func (s *State) boxOffPad(box Obj) {
+	if s.lit[box.Index] {
+		s.lit[box.Index] = false
+		s.emit(EventOffPad, box)
+	}
+}
+
+// afterFall records how an object landed
+func (s *State) afterFall(obj Obj, sound bool) {
+
+	t := EventLand
+	floor, _ := s.getCellRelativeTo(obj, 0, 0, -1)
+	if obj.Kind == ObjBox && floor.Kind == ObjGopher {
+		t = EventHurt
+	}
+	loc := s.Location(obj)
+	s.events = append(s.events, Event{Type: t, Obj: obj, From: loc, To: loc, Time: s.now, Sound: sound})
+}
+
+// afterNewFloor
+func (s *State) afterNewFloor(obj Obj) {
+	if !s.teleport(obj) {
+		s.onFloor(obj)
+	}
+}
+
+// onFloor handles what the object found under it and where it stopped
+func (s *State) onFloor(obj Obj) {
+
+	floor, _ := s.getCellRelativeTo(obj, 0, 0, -1)
+	if floor.Kind == ObjElevator {
+		s.elevate(floor)
+	} else if obj.Kind == ObjBox && s.data.IsPad(s.Location(obj)) {
+		s.boxOnPad(obj)
+	}
+}
+
+// teleport sends an object that stopped on a teleporter to its other end, if that is free, and returns whether it did
+// Objects with something on top of them stay where they are
+func (s *State) teleport(obj Obj) bool {
+
+	oldloc := s.Location(obj)
+	dest, ok := s.data.Teleport(oldloc)
+	if !ok || !s.Get(dest).IsNone() {
+		return false
+	}
+	if above, _ := s.getCellRelativeTo(obj, 0, 0, 1); !above.IsNone() {
+		return false
+	}
+
+	s.events = append(s.events, Event{Type: EventTeleport, Obj: obj, From: oldloc, To: dest, Time: s.now, Sound: true})
+	s.set(oldloc, none)
+	s.set(dest, obj)
+	s.setLocation(obj, dest)
+	s.moveAwayFrom(oldloc)
+
+	// Arriving doesn't teleport the object back, but it may fall from there
+	s.pending = append(s.pending, callback{s.now + TELEPORT_TIME, func() {
+		if floor, _ := s.getCellRelativeTo(obj, 0, 0, -1); floor.IsNone() {
+			s.fall(obj, true)
+		} else {
+			s.onFloor(obj)
+		}
+	}})
+	return true
+}
+
+// fall
+func (s *State) fall(obj Obj, sound bool) {
+
+	posStart := s.Location(obj)
+	pfall := s.posAfterFallFrom(posStart)
+	if pfall.Y == 0 {
+		// Out of game
+		s.failed = true
+		pfall.Y = FALL_OUT_Y
+		s.animate(EventFallOut, obj, pfall, true, true, func(obj Obj) {
+			s.emit(EventFail, obj)
+		})
+	} else {
+		s.animate(EventFall, obj, pfall, false, sound, func(obj Obj) {
+			if s.isBox(obj, BoxFragile) && posStart.Y-pfall.Y > 1 {
+				s.shatter(obj)
+				return
+			}
+			s.afterFall(obj, sound)
+			s.afterNewFloor(obj)
+		})
+	}
+}
+
+// shatter breaks a fragile box, which fails the level, and whatever was on it falls
+func (s *State) shatter(box Obj) {
+
+	loc := s.Location(box)
+	s.emit(EventBreak, box)
+	s.failed = true
+	s.set(loc, none)
+	s.setLocation(box, GridLoc{loc.Z, loc.X, FALL_OUT_Y})
+	s.moveAwayFrom(loc)
+	s.pending = append(s.pending, callback{s.now + BREAK_TIME, func() {
+		s.emit(EventFail, box)
+	}})
+}
+
+func (s *State) posAfterFallFrom(pos GridLoc) GridLoc {
+	pos.Y--
+	for ; pos.Y >= 0 && s.Get(pos).IsNone(); pos.Y-- {
+	}
+	pos.Y++
+	return pos
+}
+
+// afterMove handles an object that moved in the provided direction, which keeps going if it is on ice
+func (s *State) afterMove(obj Obj, d Dir) {
+
+	floor, floorLoc := s.getCellRelativeTo(obj, 0, 0, -1)
+	if floor.IsNone() {
+		s.fall(obj, true)
+	} else if s.data.Get(floorLoc) != ICE || !s.slide(obj, d) {
+		s.afterNewFloor(obj)
+	}
+}
+
+// slide moves an object on ice one cell further in the provided direction, if it is free, and returns whether it did
+// Boxes glued on top of a sliding box slide along, and other boxes that were on top of it are left behind and fall where it was
+func (s *State) slide(obj Obj, d Dir) bool {
+
+	loc := s.Location(obj)
+	next, nextLoc := s.getCellRelativeToLoc(loc, d.Z, d.X, 0)
+	if !next.IsNone() || !s.data.CanEnter(nextLoc, d) {
+		return false
+	}
+	glued := s.gluedOn(obj)
+	if !s.canMove(glued, d) {
+		return false
+	}
+	if obj.Kind == ObjBox && s.data.IsPad(loc) && !s.data.IsPad(nextLoc) {
+		s.boxOffPad(obj)
+	}
+	s.animate(EventSlide, obj, nextLoc, false, true, func(obj Obj) {
+		s.afterMove(obj, d)
+	})
+	for _, box := range glued {
+		s.animate(EventSlide, box, GridLoc{nextLoc.Z, nextLoc.X, s.Location(box).Y}, false, false, func(obj Obj) {
+			s.afterMove(obj, d)
+		})
+	}
+	return true
+}
+
+// glued returns whether the object is a glued box stuck to a box right below it
+func (s *State) glued(obj Obj) bool {
+	below, _ := s.getCellRelativeTo(obj, 0, 0, -1)
+	return s.isBox(obj, BoxGlued) && below.Kind == ObjBox
+}
+
+// gluedOn returns the boxes stuck on top of the provided object, from the bottom up
+func (s *State) gluedOn(obj Obj) []Obj {
+	var boxes []Obj
+	for above, _ := s.getCellRelativeTo(obj, 0, 0, 1); s.glued(above); above, _ = s.getCellRelativeTo(above, 0, 0, 1) {
+		boxes = append(boxes, above)
+	}
+	return boxes
+}
+
+// canMove returns whether all the provided objects can move one cell in the provided direction
+func (s *State) canMove(objs []Obj, d Dir) bool {
+	for _, obj := range objs {
+		next, nextLoc := s.getCellRelativeTo(obj, d.Z, d.X, 0)
+		if !next.IsNone() || !s.data.CanEnter(nextLoc, d) {
+			return false
+		}
+	}
+	return true
+}
+
+// canPush returns whether the gopher can push the provided box in the provided direction, once the cell ahead of it is known to be free
+// Heavy boxes can't be pushed with a box on top of them, and glued boxes only move along with the box they are stuck to
+func (s *State) canPush(box Obj, d Dir) bool {
+	if s.glued(box) {
+		return false
+	}
+	if above, _ := s.getCellRelativeTo(box, 0, 0, 1); s.isBox(box, BoxHeavy) && above.Kind == ObjBox {
+		return false
+	}
+	return s.canMove(s.gluedOn(box), d)
+}
+
+// pushBox
+func (s *State) pushBox(box Obj, dest GridLoc) {
+	s.moveStack(box, dest, EventPush)
+}
+
+// moveStack moves an object one cell to the provided destination along with the boxes piled on top of it,
+// recording the movement with the provided event type
+// Boxes of the pile whose way is blocked fall once the object has moved, along with the boxes glued to them
+func (s *State) moveStack(box Obj, dest GridLoc, t EventType) {
+
+	from := s.Location(box)
+	d := Dir{dest.Z - from.Z, dest.X - from.X}
+
+	toMove := make([]Obj, 0)
+	toFall := make([]Obj, 0)
+	foundBarrier := false
+
+	// Check if leaving pad
+	if box.Kind == ObjBox && s.data.IsPad(s.Location(box)) && !s.data.IsPad(dest) {
+		s.boxOffPad(box)
+	}
+
+	// Iterate through piled boxes, each with the boxes glued on top of it
+	for box.IsPushable() {
+
+		unit := append([]Obj{box}, s.gluedOn(box)...)
+		if !foundBarrier && s.canMove(unit, d) {
+			toMove = append(toMove, unit...)
+		} else {
+			foundBarrier = true
+			toFall = append(toFall, unit...)
+		}
+
+		// Update current box
+		box, _ = s.getCellRelativeTo(unit[len(unit)-1], 0, 0, 1)
+	}
+
+	// Move boxes toMove, adding a callback to the first one for boxes toFall
+	for i, box := range toMove {
+		cb := func(obj Obj) { s.afterMove(obj, d) }
+		if i == 0 {
+			cb = func(obj Obj) {
+				s.afterMove(obj, d)
+				for j, boxToFall := range toFall {
+					s.fall(boxToFall, j == 0) // only play sound for the first one
+				}
+			}
+		}
+		s.animate(t, box, GridLoc{dest.Z, dest.X, s.Location(box).Y}, false, i == 0, cb)
+	}
+}
+
+// moveAwayFrom
+func (s *State) moveAwayFrom(pos GridLoc) {
+
+	floor, _ := s.getCellRelativeToLoc(pos, 0, 0, -1)
+	if floor.Kind == ObjElevator {
+		s.lowerElev(floor)
+	}
+
+	ceil, _ := s.getCellRelativeToLoc(pos, 0, 0, 1)
+	if ceil.IsPushable() {
+		// Stepped out from under box(es)
+		box := ceil
+		for box.IsPushable() {
+			box_above, _ := s.getCellRelativeTo(box, 0, 0, 1)
+			s.fall(box, true)
+			box = box_above
+		}
+	} else if ceil.Kind == ObjElevator {
+		if len(s.getCargo(ceil)) == 0 {
+			s.lowerElev(ceil)
+		}
+	}
+}
+
+// pressed returns whether something is on one of the plates with the provided link
+func (s *State) pressed(link CELL_TYPE) bool {
+	for _, p := range s.data.Plates {
+		if p.Link == link && s.Get(p.Loc).IsPushable() {
+			return true
+		}
+	}
+	return false
+}
+
+// updateGates opens the gates with a pressed plate and closes the others, once objects have stopped on or left the plates
+// Whatever rests on a gate that opens falls through it, and a gate with something in it stays open until it is empty
+func (s *State) updateGates() {
+
+	for i, g := range s.data.Gates {
+		pressed := s.pressed(g.Link)
+		gate := Obj{ObjGate, i}
+		if pressed && !s.gates[i] {
+			s.gates[i] = true
+			s.set(g.Loc, none)
+			s.emit(EventGateOpen, gate)
+			s.moveAwayFrom(g.Loc)
+		} else if !pressed && s.gates[i] && s.Get(g.Loc).IsNone() {
+			s.gates[i] = false
+			s.set(g.Loc, gate)
+			s.emit(EventGateClose, gate)
+		}
+	}
+}
+
+// lowerElev lowers the specified elevator as far as it can go
+func (s *State) lowerElev(elev Obj) {
+
+	low := s.data.Elevators[elev.Index].Low
+	oldloc := s.Location(elev)
+	newloc := oldloc
+	for newloc.Y = oldloc.Y - 1; newloc.Y >= low && s.Get(newloc).IsNone(); newloc.Y-- {
+	}
+	newloc.Y++
+	if newloc.Y != oldloc.Y {
+		s.animate(EventElevatorDown, elev, newloc, false, true, func(obj Obj) {
+			s.events = append(s.events, Event{Type: EventElevatorStop, Obj: obj, From: oldloc, To: newloc, Time: s.now, Sound: true})
+		})
+	}
+}
+
+// getCargo returns the list of objects on top of the specified elevator
+func (s *State) getCargo(elev Obj) []Obj {
+
+	cargo := make([]Obj, 0)
+	for y := 1; ; y++ {
+		c, _ := s.getCellRelativeTo(elev, 0, 0, y)
+		if !c.IsPushable() {
+			break
+		}
+		cargo = append(cargo, c)
+	}
+
+	return cargo
+}
+
+// elevate moves elevator and cargo up as far as it can go
+func (s *State) elevate(elev Obj) {
+
+	var spaces_above_cargo int
+	oldloc := s.Location(elev)
+	max_elevation := s.data.Elevators[elev.Index].High - oldloc.Y
+
+	cargo := s.getCargo(elev)
+	if max_elevation <= 0 || len(cargo) == 0 {
+		return
+	}
+	last := cargo[len(cargo)-1]
+
+	// Iterate above cargo, and calculate how many floors we can move up
+	for y := 1; spaces_above_cargo < max_elevation; y++ {
+		c, _ := s.getCellRelativeTo(last, 0, 0, y)
+		if !c.IsNone() {
+			break
+		}
+		spaces_above_cargo++
+	}
+
+	// Move elevator and cargo up (need to move highest/last things first)
+	for i := len(cargo) - 1; i >= 0; i-- {
+		c := cargo[i]
+		up := s.Location(c)
+		up.Y += spaces_above_cargo
+		s.animate(EventRide, c, up, false, true, nil)
+	}
+
+	up := oldloc
+	up.Y += spaces_above_cargo
+	s.animate(EventElevatorUp, elev, up, false, true, func(obj Obj) {
+		s.events = append(s.events, Event{Type: EventElevatorStop, Obj: obj, From: oldloc, To: up, Time: s.now, Sound: true})
+	})
+}
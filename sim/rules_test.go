@@ -0,0 +1,413 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sim
+
+import (
+	"reflect"
+	"testing"
+)
+
+// stepTest plays steps in a level and describes what the last one should do
+// Locations include the padding added by ParseLevel, so the first cell of a level file is at row 1, column 1
+type stepTest struct {
+	name     string
+	level    string
+	moves    []Dir
+	events   []EventType // types of the events of the last step, in order
+	gopher   GridLoc     // where the gopher ends up
+	boxes    []GridLoc   // where each box ends up
+	failed   bool
+	complete bool
+}
+
+// runStepTests plays each test with StepDir and checks the events of its last step and the final state
+func runStepTests(t *testing.T, tests []stepTest) {
+
+	for _, tt := range tests {
+		ld, err := ParseLevel(tt.level)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		s := NewState(ld)
+		var events []Event
+		for _, d := range tt.moves {
+			events = s.StepDir(d)
+		}
+
+		types := make([]EventType, len(events))
+		for i, ev := range events {
+			types[i] = ev.Type
+		}
+		if !reflect.DeepEqual(types, tt.events) {
+			t.Errorf("%s: events %v instead of %v", tt.name, types, tt.events)
+		}
+		if s.Gopher() != tt.gopher {
+			t.Errorf("%s: gopher at %v instead of %v", tt.name, s.Gopher(), tt.gopher)
+		}
+		boxes := make([]GridLoc, s.NumBoxes())
+		for i := range boxes {
+			boxes[i] = s.Box(i)
+		}
+		if len(boxes) > 0 && !reflect.DeepEqual(boxes, tt.boxes) {
+			t.Errorf("%s: boxes at %v instead of %v", tt.name, boxes, tt.boxes)
+		}
+		if s.Failed() != tt.failed {
+			t.Errorf("%s: failed is %v instead of %v", tt.name, s.Failed(), tt.failed)
+		}
+		if s.Complete() != tt.complete {
+			t.Errorf("%s: complete is %v instead of %v", tt.name, s.Complete(), tt.complete)
+		}
+	}
+}
+
+func TestStep(t *testing.T) {
+
+	runStepTests(t, []stepTest{{
+		name:     "walk",
+		level:    "]s ]",
+		moves:    []Dir{Right},
+		events:   []EventType{EventWalk},
+		gopher:   GridLoc{1, 2, 1},
+		complete: true,
+	}, {
+		name:     "bump",
+		level:    "]s ]]",
+		moves:    []Dir{Right},
+		events:   []EventType{EventBump},
+		gopher:   GridLoc{1, 1, 1},
+		complete: true,
+	}, {
+		name:   "push",
+		level:  "]s ]x ] ]o",
+		moves:  []Dir{Right},
+		events: []EventType{EventPush, EventWalk},
+		gopher: GridLoc{1, 2, 1},
+		boxes:  []GridLoc{{1, 3, 1}},
+	}, {
+		name:   "stacked push",
+		level:  "]s ]xx ] ]oo",
+		moves:  []Dir{Right},
+		events: []EventType{EventPush, EventPush, EventWalk},
+		gopher: GridLoc{1, 2, 1},
+		boxes:  []GridLoc{{1, 3, 1}, {1, 3, 2}},
+	}, {
+		name:   "stacked push under a block",
+		level:  "]s ]xx ].] ]oo",
+		moves:  []Dir{Right},
+		events: []EventType{EventPush, EventWalk, EventFall, EventHurt},
+		gopher: GridLoc{1, 2, 1},
+		boxes:  []GridLoc{{1, 3, 1}, {1, 2, 2}},
+	}, {
+		name:   "fall one floor",
+		level:  "]]s ]]x ] ]]o",
+		moves:  []Dir{Right},
+		events: []EventType{EventPush, EventWalk, EventFall, EventLand},
+		gopher: GridLoc{1, 2, 2},
+		boxes:  []GridLoc{{1, 3, 1}},
+	}, {
+		name:   "fall out of the world",
+		level:  "]s ]x . ]o",
+		moves:  []Dir{Right},
+		events: []EventType{EventPush, EventWalk, EventFallOut, EventFail},
+		gopher: GridLoc{1, 2, 1},
+		boxes:  []GridLoc{{1, 3, FALL_OUT_Y}},
+		failed: true,
+	}, {
+		name:   "step off into the void",
+		level:  "]s . ]x ]o",
+		moves:  []Dir{Right},
+		events: []EventType{EventStepOff, EventFallOut, EventFail},
+		gopher: GridLoc{1, 2, FALL_OUT_Y},
+		boxes:  []GridLoc{{1, 3, 1}},
+		failed: true,
+	}, {
+		name:   "elevator ride",
+		level:  "]s e- ]]x ]]o",
+		moves:  []Dir{Right},
+		events: []EventType{EventWalk, EventRide, EventElevatorUp, EventElevatorStop},
+		gopher: GridLoc{1, 2, 2},
+		boxes:  []GridLoc{{1, 3, 2}},
+	}, {
+		name:   "elevator lowers when left",
+		level:  "]s e- ]]x ]]o\n] ] ] ]",
+		moves:  []Dir{Right, Down},
+		events: []EventType{EventStepOff, EventElevatorDown, EventFall, EventElevatorStop, EventLand},
+		gopher: GridLoc{2, 2, 1},
+		boxes:  []GridLoc{{1, 3, 2}},
+	}, {
+		name:     "pad completion",
+		level:    "]s ]x ]o",
+		moves:    []Dir{Right},
+		events:   []EventType{EventPush, EventWalk, EventOnPad, EventComplete},
+		gopher:   GridLoc{1, 2, 1},
+		boxes:    []GridLoc{{1, 3, 1}},
+		complete: true,
+	}, {
+		name:   "push off a pad",
+		level:  "]s ]X ]",
+		moves:  []Dir{Right},
+		events: []EventType{EventOffPad, EventPush, EventWalk},
+		gopher: GridLoc{1, 2, 1},
+		boxes:  []GridLoc{{1, 3, 1}},
+	}})
+}
+
+// Falls accelerate, so a fall of four floors takes twice as long as a fall of one
+func TestFallTime(t *testing.T) {
+
+	ld, err := ParseLevel("]]]]]s ]]]]]x ] ]o")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fall, land *Event
+	events := NewState(ld).StepDir(Right)
+	for i, ev := range events {
+		switch ev.Type {
+		case EventFall:
+			fall = &events[i]
+		case EventLand:
+			land = &events[i]
+		}
+	}
+	if fall == nil || land == nil {
+		t.Fatalf("box didn't fall and land: %v", events)
+	}
+	if fall.From.Y-fall.To.Y != 4 {
+		t.Fatalf("box fell from floor %d to %d instead of four floors", fall.From.Y, fall.To.Y)
+	}
+	if d := land.Time - fall.Time; d != 2 || fall.End() != land.Time {
+		t.Errorf("fall took %v time units (ending at %v) instead of 2", d, fall.End())
+	}
+}
+
+func TestTeleporters(t *testing.T) {
+
+	runStepTests(t, []stepTest{{
+		name:   "gopher teleports",
+		level:  "]s ]1 ] ]1 ]x ]o",
+		moves:  []Dir{Right},
+		events: []EventType{EventWalk, EventTeleport},
+		gopher: GridLoc{1, 4, 1},
+		boxes:  []GridLoc{{1, 5, 1}},
+	}, {
+		name:   "pushed box teleports",
+		level:  "]s ]x ]1 ] ]1 ]o",
+		moves:  []Dir{Right},
+		events: []EventType{EventPush, EventWalk, EventTeleport},
+		gopher: GridLoc{1, 2, 1},
+		boxes:  []GridLoc{{1, 5, 1}},
+	}, {
+		name:   "exit occupied",
+		level:  "]s ]x ]1 ] ]1 ]o",
+		moves:  []Dir{Right, Right},
+		events: []EventType{EventWalk},
+		gopher: GridLoc{1, 3, 1},
+		boxes:  []GridLoc{{1, 5, 1}},
+	}, {
+		name:   "box with another on top stays",
+		level:  "]s ]xx ]1 ] ]1 ]oo",
+		moves:  []Dir{Right},
+		events: []EventType{EventPush, EventPush, EventWalk},
+		gopher: GridLoc{1, 2, 1},
+		boxes:  []GridLoc{{1, 3, 1}, {1, 3, 2}},
+	}})
+}
+
+func TestIce(t *testing.T) {
+
+	runStepTests(t, []stepTest{{
+		name:     "gopher slides",
+		level:    "]s i i ]",
+		moves:    []Dir{Right},
+		events:   []EventType{EventWalk, EventSlide, EventSlide},
+		gopher:   GridLoc{1, 4, 1},
+		complete: true,
+	}, {
+		name:   "box slides to a wall",
+		level:  "]s ]x i i i ]] ]o",
+		moves:  []Dir{Right},
+		events: []EventType{EventPush, EventWalk, EventSlide, EventSlide},
+		gopher: GridLoc{1, 2, 1},
+		boxes:  []GridLoc{{1, 5, 1}},
+	}, {
+		name:   "box slides to a box",
+		level:  "]s ]x i i ]x ]o ]o",
+		moves:  []Dir{Right},
+		events: []EventType{EventPush, EventWalk, EventSlide},
+		gopher: GridLoc{1, 2, 1},
+		boxes:  []GridLoc{{1, 4, 1}, {1, 5, 1}},
+	}, {
+		name:     "box slides onto a pad",
+		level:    "]s ]x i ]o",
+		moves:    []Dir{Right},
+		events:   []EventType{EventPush, EventWalk, EventSlide, EventOnPad, EventComplete},
+		gopher:   GridLoc{1, 2, 1},
+		boxes:    []GridLoc{{1, 4, 1}},
+		complete: true,
+	}, {
+		name:   "box slides off the edge",
+		level:  "]s ]x i . ]o",
+		moves:  []Dir{Right},
+		events: []EventType{EventPush, EventWalk, EventSlide, EventFallOut, EventFail},
+		gopher: GridLoc{1, 2, 1},
+		boxes:  []GridLoc{{1, 4, FALL_OUT_Y}},
+		failed: true,
+	}})
+}
+
+func TestGates(t *testing.T) {
+
+	runStepTests(t, []stepTest{{
+		name:   "closed gate",
+		level:  "]s ]A ]a ]x ]o",
+		moves:  []Dir{Right},
+		events: []EventType{EventBump},
+		gopher: GridLoc{1, 1, 1},
+		boxes:  []GridLoc{{1, 4, 1}},
+	}, {
+		name:   "box on a plate opens the gate",
+		level:  "]s ]x ]a ]A ]o",
+		moves:  []Dir{Right},
+		events: []EventType{EventPush, EventWalk, EventGateOpen},
+		gopher: GridLoc{1, 2, 1},
+		boxes:  []GridLoc{{1, 3, 1}},
+	}, {
+		name:   "gate stays open with the gopher in it",
+		level:  "]s ]a ]A ]x ] ]o",
+		moves:  []Dir{Right, Right},
+		events: []EventType{EventWalk},
+		gopher: GridLoc{1, 3, 1},
+		boxes:  []GridLoc{{1, 4, 1}},
+	}, {
+		name:   "gate closes once empty",
+		level:  "]s ]a ]A ]x ] ]o",
+		moves:  []Dir{Right, Right, Right},
+		events: []EventType{EventPush, EventWalk, EventGateClose},
+		gopher: GridLoc{1, 4, 1},
+		boxes:  []GridLoc{{1, 5, 1}},
+	}, {
+		name:   "gate closes when the plate is left",
+		level:  "]s ]a ] .A ]x ]o",
+		moves:  []Dir{Right, Right},
+		events: []EventType{EventWalk, EventGateClose},
+		gopher: GridLoc{1, 3, 1},
+		boxes:  []GridLoc{{1, 5, 1}},
+	}})
+
+	// The gate is open while the gopher is on the plate, and closed otherwise
+	ld, err := ParseLevel("]s ]a ] .A ]x ]o")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewState(ld)
+	for _, d := range []Dir{Right, Left, Right, Right} {
+		s.StepDir(d)
+		if open := s.Gopher().X == 2; s.GateOpen(0) != open {
+			t.Errorf("gate open is %v with the gopher at %v", s.GateOpen(0), s.Gopher())
+		}
+	}
+}
+
+func TestConveyors(t *testing.T) {
+
+	runStepTests(t, []stepTest{{
+		name:   "pushed box is conveyed",
+		level:  "]s ]x => ] ]o",
+		moves:  []Dir{Right},
+		events: []EventType{EventPush, EventWalk, EventConvey},
+		gopher: GridLoc{1, 2, 1},
+		boxes:  []GridLoc{{1, 4, 1}},
+	}, {
+		name:   "gopher is conveyed",
+		level:  "]s => ] ]x ]o",
+		moves:  []Dir{Right},
+		events: []EventType{EventWalk, EventConvey},
+		gopher: GridLoc{1, 3, 1},
+		boxes:  []GridLoc{{1, 4, 1}},
+	}, {
+		name:   "blocked belt",
+		level:  "]s => ]] ]x ]o",
+		moves:  []Dir{Right},
+		events: []EventType{EventWalk},
+		gopher: GridLoc{1, 2, 1},
+		boxes:  []GridLoc{{1, 4, 1}},
+	}, {
+		name:   "one-way tile entered its way",
+		level:  "]s ]> ] ]x ]o",
+		moves:  []Dir{Right},
+		events: []EventType{EventWalk},
+		gopher: GridLoc{1, 2, 1},
+		boxes:  []GridLoc{{1, 4, 1}},
+	}, {
+		name:   "one-way tile entered the other way",
+		level:  "]s ]< ] ]x ]o",
+		moves:  []Dir{Right},
+		events: []EventType{EventBump},
+		gopher: GridLoc{1, 1, 1},
+		boxes:  []GridLoc{{1, 4, 1}},
+	}, {
+		name:   "box pushed against a one-way tile",
+		level:  "]s ]x ]< ]o",
+		moves:  []Dir{Right},
+		events: []EventType{EventBump},
+		gopher: GridLoc{1, 1, 1},
+		boxes:  []GridLoc{{1, 2, 1}},
+	}})
+}
+
+func TestBoxTypes(t *testing.T) {
+
+	runStepTests(t, []stepTest{{
+		name:   "heavy box",
+		level:  "]s ]h ] ]o",
+		moves:  []Dir{Right},
+		events: []EventType{EventPush, EventWalk},
+		gopher: GridLoc{1, 2, 1},
+		boxes:  []GridLoc{{1, 3, 1}},
+	}, {
+		name:   "heavy box under another",
+		level:  "]s ]hx ] ]oo",
+		moves:  []Dir{Right},
+		events: []EventType{EventBump},
+		gopher: GridLoc{1, 1, 1},
+		boxes:  []GridLoc{{1, 2, 1}, {1, 2, 2}},
+	}, {
+		name:   "fragile box dropped one floor",
+		level:  "]]s ]]f ] ]]o",
+		moves:  []Dir{Right},
+		events: []EventType{EventPush, EventWalk, EventFall, EventLand},
+		gopher: GridLoc{1, 2, 2},
+		boxes:  []GridLoc{{1, 3, 1}},
+	}, {
+		name:   "fragile box dropped two floors",
+		level:  "]]]s ]]]f ] ]]]o",
+		moves:  []Dir{Right},
+		events: []EventType{EventPush, EventWalk, EventFall, EventBreak, EventFail},
+		gopher: GridLoc{1, 2, 3},
+		boxes:  []GridLoc{{1, 3, FALL_OUT_Y}},
+		failed: true,
+	}, {
+		name:   "glued box moves with the box below",
+		level:  "]s ]xg ] ]oo",
+		moves:  []Dir{Right},
+		events: []EventType{EventPush, EventPush, EventWalk},
+		gopher: GridLoc{1, 2, 1},
+		boxes:  []GridLoc{{1, 3, 1}, {1, 3, 2}},
+	}, {
+		name:   "glued box blocked above",
+		level:  "]s ]xg ].] ]oo",
+		moves:  []Dir{Right},
+		events: []EventType{EventBump},
+		gopher: GridLoc{1, 1, 1},
+		boxes:  []GridLoc{{1, 2, 1}, {1, 2, 2}},
+	}, {
+		name:   "glued box pushed on its own",
+		level:  "]]s ]xg ] ]oo",
+		moves:  []Dir{Right},
+		events: []EventType{EventBump},
+		gopher: GridLoc{1, 1, 2},
+		boxes:  []GridLoc{{1, 2, 1}, {1, 2, 2}},
+	}})
+}
@@ -0,0 +1,290 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sim
+
+import (
+	"sort"
+)
+
+type ObjKind int
+
+const (
+	ObjNone ObjKind = iota
+	ObjBlock
+	ObjGopher
+	ObjBox
+	ObjElevator
+	ObjGate // a closed gate - open gates aren't in the grid
+)
+
+// Obj identifies an object occupying a grid cell
+type Obj struct {
+	Kind  ObjKind
+	Index int // index of the box or elevator in the state
+}
+
+var (
+	none   = Obj{}
+	wall   = Obj{Kind: ObjBlock} // everything outside the grid behaves like a block
+	gopher = Obj{Kind: ObjGopher}
+)
+
+// IsNone returns whether the object is the absence of an object
+func (o Obj) IsNone() bool {
+	return o.Kind == ObjNone
+}
+
+// IsPushable returns whether the object can be pushed or carried
+func (o Obj) IsPushable() bool {
+	return o.Kind == ObjBox || o.Kind == ObjGopher
+}
+
+// State is the dynamic state of a level being played
+type State struct {
+	data      *LevelData
+	grid      [][][]Obj
+	gopher    GridLoc
+	boxes     []GridLoc
+	lit       []bool
+	elevators []GridLoc
+	gates     []bool // whether each gate is open
+	failed    bool
+
+	// Bookkeeping used while resolving a step
+	now     float32
+	pending []callback
+	events  []Event
+}
+
+// callback is a function scheduled to run once a movement finishes
+type callback struct {
+	time float32
+	fn   func()
+}
+
+// NewState returns a pointer to a new State with every object at its initial location
+func NewState(ld *LevelData) *State {
+
+	s := new(State)
+	s.data = ld
+
+	nrows, ncols, nfloors := ld.Size()
+	s.grid = make([][][]Obj, nrows)
+	for i := range s.grid {
+		s.grid[i] = make([][]Obj, ncols)
+		for j := range s.grid[i] {
+			s.grid[i][j] = make([]Obj, nfloors)
+			for k, c := range ld.Grid[i][j] {
+				if c == BLOCK || c == ICE || c == CONVEYOR {
+					s.grid[i][j][k] = wall
+				}
+			}
+		}
+	}
+
+	s.gopher = ld.GopherInit
+	s.set(s.gopher, gopher)
+
+	s.boxes = make([]GridLoc, len(ld.BoxesInit))
+	s.lit = make([]bool, len(ld.BoxesInit))
+	for i, loc := range ld.BoxesInit {
+		s.boxes[i] = loc
+		s.lit[i] = ld.IsPad(loc)
+		s.set(loc, Obj{ObjBox, i})
+	}
+
+	s.elevators = make([]GridLoc, len(ld.Elevators))
+	for i, e := range ld.Elevators {
+		s.elevators[i] = e.Loc
+		s.set(e.Loc, Obj{ObjElevator, i})
+	}
+
+	// Gates start open if something starts on one of their plates
+	s.gates = make([]bool, len(ld.Gates))
+	for i, g := range ld.Gates {
+		s.gates[i] = s.pressed(g.Link)
+		if !s.gates[i] {
+			s.set(g.Loc, Obj{ObjGate, i})
+		}
+	}
+
+	return s
+}
+
+// Clone returns a deep copy of the state
+func (s *State) Clone() *State {
+
+	c := new(State)
+	c.data = s.data
+	c.grid = make([][][]Obj, len(s.grid))
+	for i := range s.grid {
+		c.grid[i] = make([][]Obj, len(s.grid[i]))
+		for j := range s.grid[i] {
+			c.grid[i][j] = append([]Obj(nil), s.grid[i][j]...)
+		}
+	}
+	c.gopher = s.gopher
+	c.boxes = append([]GridLoc(nil), s.boxes...)
+	c.lit = append([]bool(nil), s.lit...)
+	c.elevators = append([]GridLoc(nil), s.elevators...)
+	c.gates = append([]bool(nil), s.gates...)
+	c.failed = s.failed
+	return c
+}
+
+// Data returns the level data the state was created from
+func (s *State) Data() *LevelData {
+	return s.data
+}
+
+// Get returns the object at the provided location
+func (s *State) Get(loc GridLoc) Obj {
+	if !s.data.InBounds(loc) {
+		return wall
+	}
+	return s.grid[loc.Z][loc.X][loc.Y]
+}
+
+func (s *State) set(loc GridLoc, obj Obj) {
+	if s.data.InBounds(loc) {
+		s.grid[loc.Z][loc.X][loc.Y] = obj
+	}
+}
+
+// Location returns the current location of the provided object
+func (s *State) Location(obj Obj) GridLoc {
+	switch obj.Kind {
+	case ObjGopher:
+		return s.gopher
+	case ObjBox:
+		return s.boxes[obj.Index]
+	case ObjElevator:
+		return s.elevators[obj.Index]
+	case ObjGate:
+		return s.data.Gates[obj.Index].Loc
+	}
+	return GridLoc{}
+}
+
+func (s *State) setLocation(obj Obj, loc GridLoc) {
+	switch obj.Kind {
+	case ObjGopher:
+		s.gopher = loc
+	case ObjBox:
+		s.boxes[obj.Index] = loc
+	case ObjElevator:
+		s.elevators[obj.Index] = loc
+	}
+}
+
+// Gopher returns the current location of the gopher
+func (s *State) Gopher() GridLoc {
+	return s.gopher
+}
+
+// NumBoxes returns the number of boxes in the level
+func (s *State) NumBoxes() int {
+	return len(s.boxes)
+}
+
+// Box returns the current location of the i-th box
+func (s *State) Box(i int) GridLoc {
+	return s.boxes[i]
+}
+
+// BoxType returns the type of the i-th box
+func (s *State) BoxType(i int) BoxType {
+	return s.data.BoxType(i)
+}
+
+// isBox returns whether the object is a box of the provided type
+func (s *State) isBox(obj Obj, t BoxType) bool {
+	return obj.Kind == ObjBox && s.data.BoxType(obj.Index) == t
+}
+
+// BoxLit returns whether the i-th box is lit up by a pad
+func (s *State) BoxLit(i int) bool {
+	return s.lit[i]
+}
+
+// NumElevators returns the number of elevators in the level
+func (s *State) NumElevators() int {
+	return len(s.elevators)
+}
+
+// Elevator returns the current location of the i-th elevator
+func (s *State) Elevator(i int) GridLoc {
+	return s.elevators[i]
+}
+
+// NumGates returns the number of gates in the level
+func (s *State) NumGates() int {
+	return len(s.gates)
+}
+
+// GateOpen returns whether the i-th gate is open
+func (s *State) GateOpen(i int) bool {
+	return s.gates[i]
+}
+
+// Failed returns whether an object fell out of the world or a fragile box broke
+func (s *State) Failed() bool {
+	return s.failed
+}
+
+// Complete returns true if all the pads have boxes on them
+func (s *State) Complete() bool {
+	for _, p := range s.data.Pads {
+		if s.Get(p).Kind != ObjBox {
+			return false
+		}
+	}
+	return true
+}
+
+// Key returns a compact string that is equal for two states if and only if they are equivalent.
+// Boxes of the same type are interchangeable, so their order does not affect the key.
+func (s *State) Key() string {
+
+	boxes := make([]int, len(s.boxes))
+	for i, b := range s.boxes {
+		boxes[i] = (s.packLoc(b)*BoxTypes + int(s.data.BoxType(i))) << 1
+		if s.lit[i] {
+			boxes[i] |= 1
+		}
+	}
+	sort.Ints(boxes)
+
+	key := make([]byte, 0, 3*(1+len(boxes)+len(s.elevators))+len(s.gates))
+	put := func(n int) {
+		key = append(key, byte(n), byte(n>>8), byte(n>>16))
+	}
+	put(s.packLoc(s.gopher))
+	for _, b := range boxes {
+		put(b)
+	}
+	for _, e := range s.elevators {
+		put(s.packLoc(e))
+	}
+	for _, open := range s.gates {
+		if open {
+			key = append(key, 1)
+		} else {
+			key = append(key, 0)
+		}
+	}
+	return string(key)
+}
+
+// packLoc returns a unique non-negative number for a location inside the grid
+// Locations below the grid (objects that fell out of the world) share the bottom floor's numbers
+func (s *State) packLoc(loc GridLoc) int {
+	_, ncols, nfloors := s.data.Size()
+	y := loc.Y
+	if y < 0 {
+		y = 0
+	}
+	return (loc.Z*ncols+loc.X)*(nfloors+1) + y
+}
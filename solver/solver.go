@@ -0,0 +1,143 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package solver finds shortest solutions to Gokoban levels using the rules in package sim.
+package solver
+
+import (
+	"errors"
+	"time"
+
+	"github.com/danaugrs/gokoban/sim"
+)
+
+// ErrLimit is returned when the search gives up before finding a solution or proving there is none
+var ErrLimit = errors.New("solver: state limit reached")
+
+// ErrCanceled is returned when the search is stopped by closing its cancel channel
+var ErrCanceled = errors.New("solver: search canceled")
+
+// DEFAULT_MAX_STATES is the default maximum number of distinct states the solver will visit
+const DEFAULT_MAX_STATES int = 2000000
+
+// Result describes the outcome of a search
+type Result struct {
+	Moves    []sim.Dir     // a shortest sequence of gopher steps that completes the level (nil if none was found)
+	Pushes   int           // number of steps in Moves that push a box
+	Solvable bool          // whether a solution was found
+	Visited  int           // number of distinct states visited
+	MaxDepth int           // depth of the deepest state expanded
+	Elapsed  time.Duration // time taken by the search
+}
+
+// node is a visited state in the search tree
+type node struct {
+	parent *node
+	move   sim.Dir
+	depth  int
+}
+
+// Solve searches for a shortest solution to the provided level
+func Solve(ld *sim.LevelData, maxStates int) (*Result, error) {
+	return SolveFrom(sim.NewState(ld), maxStates, nil)
+}
+
+// SolveFrom searches for a shortest sequence of steps that completes the level from the provided state.
+// The search is breadth-first, so if it finishes without a solution the level cannot be completed
+// from that state. If more than maxStates distinct states are visited ErrLimit is returned along with
+// the statistics gathered so far. The provided state is not modified.
+// States found to be deadlocked by sim.State.Deadlock are not explored.
+// Closing the cancel channel (which may be nil) stops the search with ErrCanceled.
+func SolveFrom(start *sim.State, maxStates int, cancel <-chan struct{}) (*Result, error) {
+
+	t0 := time.Now()
+	res := new(Result)
+	defer func() { res.Elapsed = time.Since(t0) }()
+
+	if start.Deadlock() != nil {
+		return res, nil
+	}
+	if start.Complete() {
+		res.Solvable = true
+		res.Moves = []sim.Dir{}
+		return res, nil
+	}
+
+	visited := map[string]bool{start.Key(): true}
+	frontier := []*sim.State{start}
+	nodes := []*node{{}}
+
+	for len(frontier) > 0 {
+		var nextFrontier []*sim.State
+		var nextNodes []*node
+
+		for i, s := range frontier {
+			select {
+			case <-cancel:
+				return res, ErrCanceled
+			default:
+			}
+			n := nodes[i]
+			if n.depth > res.MaxDepth {
+				res.MaxDepth = n.depth
+			}
+
+			for _, d := range sim.Dirs {
+				next := s.Clone()
+				events := next.StepDir(d)
+				if len(events) == 0 || events[0].Type == sim.EventBump || next.Deadlock() != nil {
+					continue
+				}
+				key := next.Key()
+				if visited[key] {
+					continue
+				}
+				visited[key] = true
+				res.Visited = len(visited)
+
+				child := &node{n, d, n.depth + 1}
+				if next.Complete() {
+					res.Solvable = true
+					res.Moves = child.path()
+					res.Pushes = CountPushes(start, res.Moves)
+					return res, nil
+				}
+				if len(visited) >= maxStates {
+					return res, ErrLimit
+				}
+				nextFrontier = append(nextFrontier, next)
+				nextNodes = append(nextNodes, child)
+			}
+		}
+
+		frontier = nextFrontier
+		nodes = nextNodes
+	}
+
+	return res, nil
+}
+
+// path returns the moves that lead from the root of the search tree to the node
+func (n *node) path() []sim.Dir {
+	moves := make([]sim.Dir, n.depth)
+	for ; n.parent != nil; n = n.parent {
+		moves[n.depth-1] = n.move
+	}
+	return moves
+}
+
+// CountPushes returns how many of the provided moves push a box when played from the provided state
+func CountPushes(start *sim.State, moves []sim.Dir) int {
+	s := start.Clone()
+	pushes := 0
+	for _, d := range moves {
+		for _, ev := range s.StepDir(d) {
+			if ev.Type == sim.EventPush {
+				pushes++
+				break
+			}
+		}
+	}
+	return pushes
+}
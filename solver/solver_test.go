@@ -0,0 +1,116 @@
+// Copyright 2017 Daniel Salvadori. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package solver
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/danaugrs/gokoban/sim"
+)
+
+// The lengths of the shortest solutions to the included levels
+var shortest = map[string]int{
+	"01.txt": 8, "02.txt": 5, "03.txt": 4, "04.txt": 7, "05.txt": 7,
+	"06.txt": 16, "07.txt": 28, "08.txt": 22, "09.txt": 40, "10.txt": 29,
+	"11.txt": 26, "12.txt": 37, "13.txt": 35, "14.txt": 75, "15.txt": 40,
+}
+
+func TestSolveLevels(t *testing.T) {
+
+	files, err := filepath.Glob("../levels/*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(shortest) {
+		t.Fatalf("found %d levels instead of %d", len(files), len(shortest))
+	}
+	for _, f := range files {
+		name := filepath.Base(f)
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ld, err := sim.ParseLevel(string(data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		res, err := Solve(ld, DEFAULT_MAX_STATES)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !res.Solvable || len(res.Moves) != shortest[name] {
+			t.Errorf("%s: solved in %d moves (solvable %v) instead of %d", name, len(res.Moves), res.Solvable, shortest[name])
+		}
+		checkSolution(t, name, ld, res)
+	}
+}
+
+// checkSolution plays the moves of a result and fails the test if they don't complete the level
+func checkSolution(t *testing.T, name string, ld *sim.LevelData, res *Result) {
+
+	s := sim.NewState(ld)
+	for _, d := range res.Moves {
+		s.StepDir(d)
+	}
+	if !s.Complete() {
+		t.Errorf("%s: the solution doesn't complete the level", name)
+	}
+	if pushes := CountPushes(sim.NewState(ld), res.Moves); pushes != res.Pushes {
+		t.Errorf("%s: solution has %d pushes but the result says %d", name, pushes, res.Pushes)
+	}
+}
+
+func TestSolveUnsolvable(t *testing.T) {
+
+	// The gopher can't get behind the box to push it towards the pad
+	ld, err := sim.ParseLevel("]x ]s ]o")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Solve(ld, DEFAULT_MAX_STATES)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Solvable || res.Moves != nil {
+		t.Errorf("unsolvable level solved in %v", res.Moves)
+	}
+}
+
+func TestSolveLimit(t *testing.T) {
+
+	data, err := ioutil.ReadFile("../levels/09.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ld, err := sim.ParseLevel(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Solve(ld, 100)
+	if err != ErrLimit {
+		t.Fatalf("got error %v instead of %v", err, ErrLimit)
+	}
+	if res.Solvable || res.Visited != 100 {
+		t.Errorf("gave up after %d states (solvable %v) instead of 100", res.Visited, res.Solvable)
+	}
+}
+
+// A box stacked on another box rides an elevator above the floor over its shaft
+func TestSolveStackedOnElevator(t *testing.T) {
+
+	ld, err := sim.ParseLevel(". e- ]] .\n]s ]xx e- .\n. . ]]oo .")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Solve(ld, DEFAULT_MAX_STATES)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Solvable || len(res.Moves) != 4 {
+		t.Errorf("solved in %d moves (solvable %v) instead of 4", len(res.Moves), res.Solvable)
+	}
+}
@@ -9,6 +9,9 @@ import (
 	"github.com/g3n/engine/gui"
 	"github.com/g3n/engine/math32"
 	"github.com/g3n/engine/window"
+
+	"fmt"
+	"time"
 )
 
 var creditsColor = math32.Color{0.6, 0.6, 0.6}
@@ -36,9 +39,35 @@ type UI struct {
 	playButton       *gui.ImageButton
 	sfxButton        *gui.ImageButton
 	sfxSlider        *gui.Slider
+	speedLabel       *gui.Label
+	speedSlider      *gui.Slider
 	musicButton      *gui.ImageButton
 	musicSlider      *gui.Slider
 	fullScreenButton *gui.ImageButton
+	levelsButton     *gui.Button
+	profileButton    *gui.Button
+	editorButton     *gui.Button
+
+	// Level select
+	inLevelSelect    bool
+	levelSelectPanel *gui.Panel
+	levelSelectGrid  *gui.Panel
+	levelSelectBack  *gui.Button
+	levelTiles       []*levelTile
+	levelTilesPack   *Pack // level pack the tiles were created for
+	packLabel        *gui.Label
+	packPrevButton   *gui.Button
+	packNextButton   *gui.Button
+
+	// Profiles
+	inProfiles          bool
+	profileEditing      bool // whether the profile name is being typed
+	profileDeleteArmed  bool // whether the next click on the delete button deletes the current profile
+	profilePanel        *gui.Panel
+	profileList         *gui.Panel
+	profileEdit         *gui.Edit
+	profileStatus       *gui.Label
+	profileDeleteButton *gui.Button
 
 	// In-game controls and HUD
 	gameScreen          *gui.Panel
@@ -46,15 +75,24 @@ type UI struct {
 	gameScreenFooter    *gui.Panel
 	levelLabelImage     *gui.ImageLabel
 	levelLabelText      *gui.Label
+	statsLabel          *gui.Label
 	nextButton          *gui.ImageButton
 	prevButton          *gui.ImageButton
 	restartButton       *gui.ImageButton
+	hintButton          *gui.Button
+	hintLabel           *gui.Label
+	deadlockLabel       *gui.Label
+	deadlockUndo        *gui.Button
+	deadlockRestart     *gui.Button
 	menuButton          *gui.ImageButton
 	instructions1       *gui.ImageLabel
 	instructions2       *gui.ImageLabel
 	instructions3       *gui.ImageLabel
 	instructionsRestart *gui.ImageLabel
 	instructionsMenu    *gui.ImageLabel
+	replayLabel         *gui.Label
+	editorLabel         *gui.Label
+	editorHelpLabel     *gui.Label
 }
 
 // NewUI creates a ui panel with a loading label and title
@@ -76,11 +114,11 @@ func NewUI(game *Gokoban) *UI {
 	ui.Add(ui.loadingLabel)
 
 	// Title
-	ui.titleImage, err = gui.NewImageButton("./gui/title3.png")
+	ui.titleImage, err = gui.NewImageButton(Asset("gui/title3.png"))
 	if err != nil {
 		panic(err)
 	}
-	ui.titleImage.SetImage(gui.ButtonDisabled, "./gui/title3.png")
+	ui.titleImage.SetImage(gui.ButtonDisabled, Asset("gui/title3.png"))
 	ui.titleImage.SetEnabled(false)
 	ui.titleImage.SetZLayerDelta(1)
 	ui.titleImage.SetPositionX((ui.ContentWidth() - ui.titleImage.ContentWidth()) / 2)
@@ -142,6 +180,10 @@ func (ui *UI) Resize(width, height int) {
 	// Menu Screen
 	ui.menuPanel.SetPositionX(math32.Round((float32(width)-ui.menuPanel.Width())/2) + 0.5)
 	ui.menuPanel.SetPositionY(math32.Round((float32(height)-ui.menuPanel.Height())/1.6) + 0.5)
+	ui.levelSelectPanel.SetPositionX(math32.Round((float32(width)-ui.levelSelectPanel.Width())/2) + 0.5)
+	ui.levelSelectPanel.SetPositionY(math32.Round((float32(height)-ui.levelSelectPanel.Height())/1.6) + 0.5)
+	ui.profilePanel.SetPositionX(math32.Round((float32(width)-ui.profilePanel.Width())/2) + 0.5)
+	ui.profilePanel.SetPositionY(math32.Round((float32(height)-ui.profilePanel.Height())/1.6) + 0.5)
 
 	// Game Screen
 	// Note: for some reason calling SetPosition instead of SetPositionX and SetPositionY (separately) results in the same visual bleeding artifact
@@ -149,8 +191,13 @@ func (ui *UI) Resize(width, height int) {
 	ui.prevButton.SetPositionY(math32.Round(gameScreenPadding) + 0.5)
 	ui.levelLabelImage.SetPositionX(math32.Round((float32(width)-ui.levelLabelImage.ContentWidth())/2) + 0.5)
 	ui.levelLabelText.SetPositionX(math32.Round((float32(width) - ui.levelLabelText.ContentWidth()) / 2))
+	ui.statsLabel.SetPositionX(math32.Round((float32(width) - ui.statsLabel.ContentWidth()) / 2))
 	ui.nextButton.SetPositionX(math32.Round(float32(width)-ui.prevButton.ContentWidth()-gameScreenPadding) + 0.5)
 	ui.restartButton.SetPositionY(math32.Round(float32(height)-ui.restartButton.ContentHeight()-gameScreenPadding) + 0.5)
+	ui.hintButton.SetPositionX(math32.Round(2*gameScreenPadding+ui.restartButton.ContentWidth()) + 0.5)
+	ui.hintButton.SetPositionY(math32.Round(float32(height)-ui.hintButton.Height()-gameScreenPadding) + 0.5)
+	ui.hintLabel.SetPositionX(math32.Round((float32(width) - ui.hintLabel.ContentWidth()) / 2))
+	ui.layoutDeadlock(float32(width))
 	ui.menuButton.SetPositionX(math32.Round(float32(width)-ui.menuButton.Width()-gameScreenPadding) + 0.5)
 	ui.menuButton.SetPositionY(math32.Round(float32(height)-ui.menuButton.Height()-gameScreenPadding) + 0.5)
 	ui.instructions1.SetWidth(float32(width))
@@ -164,22 +211,34 @@ func (ui *UI) Resize(width, height int) {
 	ui.instructionsRestart.SetPositionY(float32(height) - 6*ui.instructionsRestart.ContentHeight())
 	ui.instructionsMenu.SetPositionX(float32(width) - ui.instructionsMenu.ContentWidth() - buttonInstructionsPad)
 	ui.instructionsMenu.SetPositionY(float32(height) - 6*ui.instructionsMenu.ContentHeight())
+	ui.replayLabel.SetPositionX(math32.Round((float32(width) - ui.replayLabel.ContentWidth()) / 2))
+	ui.editorLabel.SetPositionX(math32.Round((float32(width) - ui.editorLabel.ContentWidth()) / 2))
+	ui.editorHelpLabel.SetPositionX(math32.Round((float32(width) - ui.editorHelpLabel.ContentWidth()) / 2))
 }
 
 // ToggleMenu switched the menu, title, and credits overlay for the in-level corner buttons
 func (ui *UI) ToggleMenu() {
 	if ui.inMenu {
+		if ui.inLevelSelect {
+			ui.ShowLevelSelect(false)
+		}
+		if ui.inProfiles {
+			ui.ShowProfiles(false)
+		}
+
 		// Dispatch OnCursorLeave and OnMouseUp to sliders in case user had cursor over sliders when they pressed Esc to hide menu
 		ui.sfxSlider.Dispatch(gui.OnCursorLeave, &window.MouseEvent{})
 		ui.sfxSlider.Dispatch(gui.OnMouseUp, &window.MouseEvent{})
 		ui.musicSlider.Dispatch(gui.OnCursorLeave, &window.MouseEvent{})
 		ui.musicSlider.Dispatch(gui.OnMouseUp, &window.MouseEvent{})
+		ui.speedSlider.Dispatch(gui.OnCursorLeave, &window.MouseEvent{})
+		ui.speedSlider.Dispatch(gui.OnMouseUp, &window.MouseEvent{})
 
 		ui.Remove(ui.menuScreen)
 		ui.Add(ui.gameScreen)
 		
 		ui.game.orbit.SetEnabled(camera.OrbitRot + camera.OrbitZoom)
-		ui.game.gopherLocked = false
+		ui.game.gopherLocked = ui.game.replayer != nil || ui.game.editing()
 		ui.game.audio.musicMenu.Stop()
 		ui.game.audio.musicGame.Play()
 	} else {
@@ -223,10 +282,10 @@ func (ui *UI) CreateMenuScreen() {
 	// Music Control
 	musicControl := gui.NewPanel(130, 100)
 	musicControl.SetLayout(topRowLayout)
-	ui.musicButton, err = gui.NewImageButton("./gui/music_normal.png")
-	ui.musicButton.SetImage(gui.ButtonOver, "./gui/music_hover.png")
-	ui.musicButton.SetImage(gui.ButtonPressed, "./gui/music_click.png")
-	ui.musicButton.SetImage(gui.ButtonDisabled, "./gui/music_disabled2.png")
+	ui.musicButton, err = gui.NewImageButton(Asset("gui/music_normal.png"))
+	ui.musicButton.SetImage(gui.ButtonOver, Asset("gui/music_hover.png"))
+	ui.musicButton.SetImage(gui.ButtonPressed, Asset("gui/music_click.png"))
+	ui.musicButton.SetImage(gui.ButtonDisabled, Asset("gui/music_disabled2.png"))
 	if err != nil {
 		panic(err)
 	}
@@ -258,10 +317,10 @@ func (ui *UI) CreateMenuScreen() {
 	sfxControl := gui.NewPanel(130, 100)
 	sfxControl.SetLayout(topRowLayout)
 
-	ui.sfxButton, err = gui.NewImageButton("./gui/sound_normal.png")
-	ui.sfxButton.SetImage(gui.ButtonOver, "./gui/sound_hover.png")
-	ui.sfxButton.SetImage(gui.ButtonPressed, "./gui/sound_click.png")
-	ui.sfxButton.SetImage(gui.ButtonDisabled, "./gui/sound_disabled2.png")
+	ui.sfxButton, err = gui.NewImageButton(Asset("gui/sound_normal.png"))
+	ui.sfxButton.SetImage(gui.ButtonOver, Asset("gui/sound_hover.png"))
+	ui.sfxButton.SetImage(gui.ButtonPressed, Asset("gui/sound_click.png"))
+	ui.sfxButton.SetImage(gui.ButtonDisabled, Asset("gui/sound_disabled2.png"))
 	if err != nil {
 		panic(err)
 	}
@@ -289,11 +348,37 @@ func (ui *UI) CreateMenuScreen() {
 
 	topRow.Add(sfxControl)
 
+	// Animation Speed Control
+	speedControl := gui.NewPanel(130, 100)
+	speedControl.SetLayout(topRowLayout)
+
+	ui.speedLabel = gui.NewLabel("")
+	ui.speedLabel.SetFontSize(20)
+	ui.speedLabel.SetColor(&math32.Color{1, 1, 1})
+	ui.speedLabel.SetLayoutParams(&alignCenterVerical)
+	speedControl.Add(ui.speedLabel)
+
+	// Animation Speed Slider
+	ui.speedSlider = gui.NewVSlider(20, 80)
+	ui.speedSlider.SetValue(animationScaleValue(ui.game.userData.AnimScale))
+	ui.speedSlider.Subscribe(gui.OnChange, func(evname string, ev interface{}) {
+		ui.game.userData.AnimScale = animationScale(ui.speedSlider.Value())
+		ui.UpdateSpeedLabel()
+	})
+	ui.speedSlider.Subscribe(gui.OnCursorEnter, func(evname string, ev interface{}) {
+		ui.game.audio.hover.Play()
+	})
+	ui.speedSlider.SetLayoutParams(&alignCenterVerical)
+	speedControl.Add(ui.speedSlider)
+	ui.UpdateSpeedLabel()
+
+	topRow.Add(speedControl)
+
 	// FullScreen Button
-	ui.fullScreenButton, err = gui.NewImageButton("./gui/screen_normal.png")
-	ui.fullScreenButton.SetImage(gui.ButtonOver, "./gui/screen_hover.png")
-	ui.fullScreenButton.SetImage(gui.ButtonPressed, "./gui/screen_click.png")
-	ui.fullScreenButton.SetImage(gui.ButtonDisabled, "./gui/screen_disabled2.png")
+	ui.fullScreenButton, err = gui.NewImageButton(Asset("gui/screen_normal.png"))
+	ui.fullScreenButton.SetImage(gui.ButtonOver, Asset("gui/screen_hover.png"))
+	ui.fullScreenButton.SetImage(gui.ButtonPressed, Asset("gui/screen_click.png"))
+	ui.fullScreenButton.SetImage(gui.ButtonDisabled, Asset("gui/screen_disabled2.png"))
 	if err != nil {
 		panic(err)
 	}
@@ -314,10 +399,10 @@ func (ui *UI) CreateMenuScreen() {
 	buttonRow.SetLayout(buttonRowLayout)
 
 	// Quit Button
-	ui.quitButton, err = gui.NewImageButton("./gui/quit_normal.png")
-	ui.quitButton.SetImage(gui.ButtonOver, "./gui/quit_hover.png")
-	ui.quitButton.SetImage(gui.ButtonPressed, "./gui/quit_click.png")
-	ui.quitButton.SetImage(gui.ButtonDisabled, "./gui/quit_disabled2.png")
+	ui.quitButton, err = gui.NewImageButton(Asset("gui/quit_normal.png"))
+	ui.quitButton.SetImage(gui.ButtonOver, Asset("gui/quit_hover.png"))
+	ui.quitButton.SetImage(gui.ButtonPressed, Asset("gui/quit_click.png"))
+	ui.quitButton.SetImage(gui.ButtonDisabled, Asset("gui/quit_disabled2.png"))
 	if err != nil {
 		panic(err)
 	}
@@ -329,11 +414,51 @@ func (ui *UI) CreateMenuScreen() {
 	})
 	buttonRow.Add(ui.quitButton)
 
+	// Level Select Button
+	ui.levelsButton = gui.NewButton("Levels")
+	ui.levelsButton.SetLayoutParams(&alignCenterVerical)
+	ui.levelsButton.Subscribe(gui.OnClick, func(evname string, ev interface{}) {
+		ui.game.audio.click.Play()
+		ui.ShowLevelSelect(true)
+	})
+	ui.levelsButton.Subscribe(gui.OnCursorEnter, func(evname string, ev interface{}) {
+		ui.game.audio.hover.Play()
+	})
+	buttonRow.Add(ui.levelsButton)
+
+	// Profile Button
+	ui.profileButton = gui.NewButton("Profile: " + ui.game.userData.Profile())
+	ui.profileButton.SetLayoutParams(&alignCenterVerical)
+	ui.profileButton.Subscribe(gui.OnClick, func(evname string, ev interface{}) {
+		ui.game.audio.click.Play()
+		ui.ShowProfiles(true)
+	})
+	ui.profileButton.Subscribe(gui.OnCursorEnter, func(evname string, ev interface{}) {
+		ui.game.audio.hover.Play()
+	})
+	buttonRow.Add(ui.profileButton)
+
+	// Level Editor Button
+	ui.editorButton = gui.NewButton("Editor")
+	ui.editorButton.SetLayoutParams(&alignCenterVerical)
+	ui.editorButton.Subscribe(gui.OnClick, func(evname string, ev interface{}) {
+		ui.game.audio.click.Play()
+		if ui.game.editor != nil {
+			ui.game.StopEditor()
+		} else {
+			ui.game.StartEditor()
+		}
+	})
+	ui.editorButton.Subscribe(gui.OnCursorEnter, func(evname string, ev interface{}) {
+		ui.game.audio.hover.Play()
+	})
+	buttonRow.Add(ui.editorButton)
+
 	// Play Button
-	ui.playButton, err = gui.NewImageButton("./gui/play_normal.png")
-	ui.playButton.SetImage(gui.ButtonOver, "./gui/play_hover.png")
-	ui.playButton.SetImage(gui.ButtonPressed, "./gui/play_click.png")
-	ui.playButton.SetImage(gui.ButtonDisabled, "./gui/play_disabled2.png")
+	ui.playButton, err = gui.NewImageButton(Asset("gui/play_normal.png"))
+	ui.playButton.SetImage(gui.ButtonOver, Asset("gui/play_hover.png"))
+	ui.playButton.SetImage(gui.ButtonPressed, Asset("gui/play_click.png"))
+	ui.playButton.SetImage(gui.ButtonDisabled, Asset("gui/play_disabled2.png"))
 	if err != nil {
 		panic(err)
 	}
@@ -369,7 +494,7 @@ func (ui *UI) CreateMenuScreen() {
 
 	// G3N logo
 	g3n := gui.NewImageLabel("")
-	g3n.SetImageFromFile("./gui/g3n.png")
+	g3n.SetImageFromFile(Asset("gui/g3n.png"))
 	g3n.SetSize(50, 87)
 	ui.menuScreen.Subscribe(gui.OnResize, func(evname string, ev interface{}) {
 		g3n.SetPositionX(math32.Round(ui.menuScreen.ContentWidth()-g3n.Width()) + 0.5)
@@ -378,20 +503,23 @@ func (ui *UI) CreateMenuScreen() {
 	ui.menuScreen.Add(g3n)
 
 	ui.menuScreen.Add(ui.menuPanel)
+
+	ui.CreateLevelSelectScreen()
+	ui.CreateProfileScreen()
 }
 
 // UpdateMusicButton updates the state of the music button, slider, and the appropriate audio setting
 func (ui *UI) UpdateMusicButton(on bool) {
 	if on {
-		ui.musicButton.SetImage(gui.ButtonNormal, "./gui/music_normal.png")
-		ui.musicButton.SetImage(gui.ButtonOver, "./gui/music_hover.png")
-		ui.musicButton.SetImage(gui.ButtonPressed, "./gui/music_click.png")
+		ui.musicButton.SetImage(gui.ButtonNormal, Asset("gui/music_normal.png"))
+		ui.musicButton.SetImage(gui.ButtonOver, Asset("gui/music_hover.png"))
+		ui.musicButton.SetImage(gui.ButtonPressed, Asset("gui/music_click.png"))
 		ui.musicSlider.SetEnabled(true)
 		ui.musicSlider.SetValue(ui.musicSlider.Value())
 	} else {
-		ui.musicButton.SetImage(gui.ButtonNormal, "./gui/music_normal_off.png")
-		ui.musicButton.SetImage(gui.ButtonOver, "./gui/music_hover_off.png")
-		ui.musicButton.SetImage(gui.ButtonPressed, "./gui/music_click_off.png")
+		ui.musicButton.SetImage(gui.ButtonNormal, Asset("gui/music_normal_off.png"))
+		ui.musicButton.SetImage(gui.ButtonOver, Asset("gui/music_hover_off.png"))
+		ui.musicButton.SetImage(gui.ButtonPressed, Asset("gui/music_click_off.png"))
 		ui.musicSlider.SetEnabled(false)
 		ui.game.audio.SetMusicVolume(0)
 	}
@@ -400,20 +528,25 @@ func (ui *UI) UpdateMusicButton(on bool) {
 // UpdateSfxButton updates the state of the sfx button, slider, and the appropriate audio setting
 func (ui *UI) UpdateSfxButton(on bool) {
 	if on {
-		ui.sfxButton.SetImage(gui.ButtonNormal, "./gui/sound_normal.png")
-		ui.sfxButton.SetImage(gui.ButtonOver, "./gui/sound_hover.png")
-		ui.sfxButton.SetImage(gui.ButtonPressed, "./gui/sound_click.png")
+		ui.sfxButton.SetImage(gui.ButtonNormal, Asset("gui/sound_normal.png"))
+		ui.sfxButton.SetImage(gui.ButtonOver, Asset("gui/sound_hover.png"))
+		ui.sfxButton.SetImage(gui.ButtonPressed, Asset("gui/sound_click.png"))
 		ui.sfxSlider.SetEnabled(true)
 		ui.sfxSlider.SetValue(ui.sfxSlider.Value())
 	} else {
-		ui.sfxButton.SetImage(gui.ButtonNormal, "./gui/sound_normal_off.png")
-		ui.sfxButton.SetImage(gui.ButtonOver, "./gui/sound_hover_off.png")
-		ui.sfxButton.SetImage(gui.ButtonPressed, "./gui/sound_click_off.png")
+		ui.sfxButton.SetImage(gui.ButtonNormal, Asset("gui/sound_normal_off.png"))
+		ui.sfxButton.SetImage(gui.ButtonOver, Asset("gui/sound_hover_off.png"))
+		ui.sfxButton.SetImage(gui.ButtonPressed, Asset("gui/sound_click_off.png"))
 		ui.sfxSlider.SetEnabled(false)
 		ui.game.audio.SetSfxVolume(0)
 	}
 }
 
+// UpdateSpeedLabel shows the animation speed chosen with the speed slider
+func (ui *UI) UpdateSpeedLabel() {
+	ui.speedLabel.SetText(fmt.Sprintf("Speed\n%.1fx", animationScale(ui.speedSlider.Value())))
+}
+
 // CreateGameScreen creates the game screen widgets
 func (ui *UI) CreateGameScreen() {
 
@@ -424,10 +557,10 @@ func (ui *UI) CreateGameScreen() {
 	ui.gameScreen.SetEnabled(false)
 
 	// Previous Level Button
-	ui.prevButton, err = gui.NewImageButton("./gui/left_normal.png")
-	ui.prevButton.SetImage(gui.ButtonOver, "./gui/left_hover.png")
-	ui.prevButton.SetImage(gui.ButtonPressed, "./gui/left_click.png")
-	ui.prevButton.SetImage(gui.ButtonDisabled, "./gui/left_disabled2.png")
+	ui.prevButton, err = gui.NewImageButton(Asset("gui/left_normal.png"))
+	ui.prevButton.SetImage(gui.ButtonOver, Asset("gui/left_hover.png"))
+	ui.prevButton.SetImage(gui.ButtonPressed, Asset("gui/left_click.png"))
+	ui.prevButton.SetImage(gui.ButtonDisabled, Asset("gui/left_disabled2.png"))
 	if err != nil {
 		panic(err)
 	}
@@ -448,7 +581,7 @@ func (ui *UI) CreateGameScreen() {
 
 	// Level Label Image
 	ui.levelLabelImage = gui.NewImageLabel("")
-	ui.levelLabelImage.SetImageFromFile("./gui/panel.png")
+	ui.levelLabelImage.SetImageFromFile(Asset("gui/panel.png"))
 	ui.levelLabelImage.SetHeight(92)
 	ui.levelLabelImage.SetEnabled(false)
 	ui.gameScreen.Add(ui.levelLabelImage)
@@ -461,11 +594,19 @@ func (ui *UI) CreateGameScreen() {
 	ui.levelLabelText.SetEnabled(false)
 	ui.gameScreen.Add(ui.levelLabelText)
 
+	// Level Statistics Label
+	ui.statsLabel = gui.NewLabel("")
+	ui.statsLabel.SetFontSize(18)
+	ui.statsLabel.SetColor(&creditsColor)
+	ui.statsLabel.SetPositionY(96)
+	ui.statsLabel.SetEnabled(false)
+	ui.gameScreen.Add(ui.statsLabel)
+
 	// Next Level Button
-	ui.nextButton, err = gui.NewImageButton("./gui/right_normal.png")
-	ui.nextButton.SetImage(gui.ButtonOver, "./gui/right_hover.png")
-	ui.nextButton.SetImage(gui.ButtonPressed, "./gui/right_click.png")
-	ui.nextButton.SetImage(gui.ButtonDisabled, "./gui/right_disabled2.png")
+	ui.nextButton, err = gui.NewImageButton(Asset("gui/right_normal.png"))
+	ui.nextButton.SetImage(gui.ButtonOver, Asset("gui/right_hover.png"))
+	ui.nextButton.SetImage(gui.ButtonPressed, Asset("gui/right_click.png"))
+	ui.nextButton.SetImage(gui.ButtonDisabled, Asset("gui/right_disabled2.png"))
 	if err != nil {
 		panic(err)
 	}
@@ -486,10 +627,10 @@ func (ui *UI) CreateGameScreen() {
 	ui.gameScreen.Add(ui.nextButton)
 
 	// Restart Level Button
-	ui.restartButton, err = gui.NewImageButton("./gui/restart_normal.png")
-	ui.restartButton.SetImage(gui.ButtonOver, "./gui/restart_hover.png")
-	ui.restartButton.SetImage(gui.ButtonPressed, "./gui/restart_click.png")
-	ui.restartButton.SetImage(gui.ButtonDisabled, "./gui/restart_disabled2.png")
+	ui.restartButton, err = gui.NewImageButton(Asset("gui/restart_normal.png"))
+	ui.restartButton.SetImage(gui.ButtonOver, Asset("gui/restart_hover.png"))
+	ui.restartButton.SetImage(gui.ButtonPressed, Asset("gui/restart_click.png"))
+	ui.restartButton.SetImage(gui.ButtonDisabled, Asset("gui/restart_disabled2.png"))
 	if err != nil {
 		panic(err)
 	}
@@ -497,7 +638,7 @@ func (ui *UI) CreateGameScreen() {
 		if !ui.restartButton.Enabled() {
 			return
 		}
-		ui.game.RestartLevel(true)
+		ui.game.PlayerRestart()
 	})
 	ui.restartButton.Subscribe(gui.OnCursorEnter, func(evname string, ev interface{}) {
 		if !ui.restartButton.Enabled() {
@@ -508,11 +649,55 @@ func (ui *UI) CreateGameScreen() {
 	ui.restartButton.SetPositionX(gameScreenPadding + 0.5)
 	ui.gameScreen.Add(ui.restartButton)
 
+	// Hint Button
+	ui.hintButton = gui.NewButton("Hint (H)")
+	ui.hintButton.Subscribe(gui.OnClick, func(evname string, ev interface{}) {
+		ui.game.audio.click.Play()
+		ui.game.Hint()
+	})
+	ui.hintButton.Subscribe(gui.OnCursorEnter, func(evname string, ev interface{}) {
+		ui.game.audio.hover.Play()
+	})
+	ui.gameScreen.Add(ui.hintButton)
+
+	// Hint status
+	ui.hintLabel = gui.NewLabel("")
+	ui.hintLabel.SetFontSize(20)
+	ui.hintLabel.SetColor(&creditsColor)
+	ui.hintLabel.SetPositionY(150)
+	ui.hintLabel.SetEnabled(false)
+	ui.hintLabel.SetVisible(false)
+	ui.gameScreen.Add(ui.hintLabel)
+
+	// Deadlock warning
+	ui.deadlockLabel = gui.NewLabel("")
+	ui.deadlockLabel.SetFontSize(22)
+	ui.deadlockLabel.SetColor(&math32.Color{0.82, 0.48, 0.48})
+	ui.deadlockLabel.SetPositionY(176)
+	ui.deadlockLabel.SetEnabled(false)
+	ui.deadlockLabel.SetVisible(false)
+	ui.gameScreen.Add(ui.deadlockLabel)
+
+	ui.deadlockUndo = gui.NewButton("Undo (U)")
+	ui.deadlockUndo.Subscribe(gui.OnClick, func(evname string, ev interface{}) {
+		ui.game.audio.click.Play()
+		ui.game.Undo()
+	})
+	ui.deadlockUndo.SetVisible(false)
+	ui.gameScreen.Add(ui.deadlockUndo)
+
+	ui.deadlockRestart = gui.NewButton("Restart (R)")
+	ui.deadlockRestart.Subscribe(gui.OnClick, func(evname string, ev interface{}) {
+		ui.game.PlayerRestart()
+	})
+	ui.deadlockRestart.SetVisible(false)
+	ui.gameScreen.Add(ui.deadlockRestart)
+
 	// Show Menu Button
-	ui.menuButton, err = gui.NewImageButton("./gui/menu_normal.png")
-	ui.menuButton.SetImage(gui.ButtonOver, "./gui/menu_hover.png")
-	ui.menuButton.SetImage(gui.ButtonPressed, "./gui/menu_click.png")
-	ui.menuButton.SetImage(gui.ButtonDisabled, "./gui/menu_disabled2.png")
+	ui.menuButton, err = gui.NewImageButton(Asset("gui/menu_normal.png"))
+	ui.menuButton.SetImage(gui.ButtonOver, Asset("gui/menu_hover.png"))
+	ui.menuButton.SetImage(gui.ButtonPressed, Asset("gui/menu_click.png"))
+	ui.menuButton.SetImage(gui.ButtonDisabled, Asset("gui/menu_disabled2.png"))
 	if err != nil {
 		panic(err)
 	}
@@ -561,4 +746,138 @@ func (ui *UI) CreateGameScreen() {
 	ui.instructionsMenu.SetFontSize(20)
 	ui.instructionsMenu.SetEnabled(false)
 	ui.gameScreen.Add(ui.instructionsMenu)
+
+	// Replay status
+	ui.replayLabel = gui.NewLabel("")
+	ui.replayLabel.SetFontSize(20)
+	ui.replayLabel.SetColor(&creditsColor)
+	ui.replayLabel.SetPositionY(124)
+	ui.replayLabel.SetEnabled(false)
+	ui.replayLabel.SetVisible(false)
+	ui.gameScreen.Add(ui.replayLabel)
+
+	// Level editor status and help
+	ui.editorLabel = gui.NewLabel("")
+	ui.editorLabel.SetFontSize(20)
+	ui.editorLabel.SetColor(&creditsColor)
+	ui.editorLabel.SetPositionY(124)
+	ui.editorLabel.SetEnabled(false)
+	ui.editorLabel.SetVisible(false)
+	ui.gameScreen.Add(ui.editorLabel)
+
+	ui.editorHelpLabel = gui.NewLabel(EDITOR_HELP)
+	ui.editorHelpLabel.SetFontSize(18)
+	ui.editorHelpLabel.SetColor(&creditsColor)
+	ui.editorHelpLabel.SetPositionY(150)
+	ui.editorHelpLabel.SetEnabled(false)
+	ui.editorHelpLabel.SetVisible(false)
+	ui.gameScreen.Add(ui.editorHelpLabel)
+}
+
+// UpdateReplayLabel shows the state of the replay being played back, or hides the label if there is none
+func (ui *UI) UpdateReplayLabel() {
+	rp := ui.game.replayer
+	if rp == nil {
+		ui.replayLabel.SetVisible(false)
+		return
+	}
+	state := fmt.Sprintf("Replay %v/%v at %vx", rp.next, len(rp.replay.Moves), rp.Speed())
+	if rp.paused {
+		state += " (paused - Right: step)"
+	}
+	ui.replayLabel.SetText(state + "   Space: pause   Up/Down: speed")
+	ui.replayLabel.SetVisible(true)
+	ui.replayLabel.SetPositionX(math32.Round((ui.gameScreen.ContentWidth() - ui.replayLabel.ContentWidth()) / 2))
+}
+
+// UpdateEditorButton updates the text of the level editor button depending on whether the editor is open
+func (ui *UI) UpdateEditorButton() {
+	if ui.game.editor != nil {
+		ui.editorButton.Label.SetText("Close editor")
+	} else {
+		ui.editorButton.Label.SetText("Editor")
+	}
+}
+
+// UpdateEditorLabel shows the status of the level editor and the cell under its cursor, or hides the labels if it is closed
+func (ui *UI) UpdateEditorLabel() {
+	e := ui.game.editor
+	ui.editorLabel.SetVisible(e != nil)
+	ui.editorHelpLabel.SetVisible(e != nil && e.test == nil)
+	ui.statsLabel.SetVisible(e == nil)
+	ui.hintButton.SetVisible(!ui.game.editing())
+	if e == nil {
+		return
+	}
+	text := e.status
+	if e.test == nil {
+		modified := ""
+		if e.modified {
+			modified = " (modified)"
+		}
+		text = fmt.Sprintf("%v%v   Row %v, column %v, floor %v: %v", e.status, modified,
+			e.cursor.Z+1, e.cursor.X+1, e.cursor.Y+1, editorCellName(e.get(e.cursor)))
+	}
+	ui.editorLabel.SetText(text)
+	ui.editorLabel.SetPositionX(math32.Round((ui.gameScreen.ContentWidth() - ui.editorLabel.ContentWidth()) / 2))
+	ui.editorHelpLabel.SetPositionX(math32.Round((ui.gameScreen.ContentWidth() - ui.editorHelpLabel.ContentWidth()) / 2))
+}
+
+// UpdateHintLabel shows the hint status of the current level, or hides the label if there is none
+func (ui *UI) UpdateHintLabel() {
+	if ui.game.level == nil || ui.game.level.hintStatus == "" {
+		ui.hintLabel.SetVisible(false)
+		return
+	}
+	ui.hintLabel.SetText(ui.game.level.hintStatus)
+	ui.hintLabel.SetVisible(true)
+	ui.hintLabel.SetPositionX(math32.Round((ui.gameScreen.ContentWidth() - ui.hintLabel.ContentWidth()) / 2))
+}
+
+// ShowDeadlock tells the player why the level can't be won anymore and offers to undo or restart,
+// or hides the warning if the reason is empty
+func (ui *UI) ShowDeadlock(reason string) {
+	text := ""
+	if reason != "" {
+		text = "This level can't be won anymore: " + reason
+	}
+	if text == ui.deadlockLabel.Text() {
+		return
+	}
+	ui.deadlockLabel.SetText(text)
+	ui.deadlockLabel.SetVisible(reason != "")
+	ui.deadlockUndo.SetVisible(reason != "")
+	ui.deadlockRestart.SetVisible(reason != "")
+	ui.layoutDeadlock(ui.gameScreen.ContentWidth())
+}
+
+// layoutDeadlock centers the deadlock warning and its buttons
+func (ui *UI) layoutDeadlock(width float32) {
+	ui.deadlockLabel.SetPositionX(math32.Round((width - ui.deadlockLabel.ContentWidth()) / 2))
+	buttonsWidth := ui.deadlockUndo.Width() + gameScreenPadding + ui.deadlockRestart.Width()
+	ui.deadlockUndo.SetPositionX(math32.Round((width-buttonsWidth)/2) + 0.5)
+	ui.deadlockUndo.SetPositionY(math32.Round(ui.deadlockLabel.Position().Y+ui.deadlockLabel.Height()+10) + 0.5)
+	ui.deadlockRestart.SetPositionX(math32.Round(ui.deadlockUndo.Position().X+ui.deadlockUndo.Width()+gameScreenPadding) + 0.5)
+	ui.deadlockRestart.SetPositionY(ui.deadlockUndo.Position().Y)
+}
+
+// UpdateStatsLabel shows the records of the current level
+func (ui *UI) UpdateStatsLabel() {
+	if ui.game.level == nil {
+		return
+	}
+	rec := ui.game.userData.Record(ui.game.level.id)
+	text := fmt.Sprintf("Attempts: %v   Restarts: %v   Falls: %v", rec.Attempts, rec.Restarts, rec.Falls)
+	if rec.Completed() {
+		text = fmt.Sprintf("Best: %v steps, %v pushes, %v   ", rec.BestSteps, rec.BestPushes, formatDuration(rec.BestTime)) + text +
+			"   First completed: " + rec.FirstCompleted.Format("2 Jan 2006")
+	}
+	ui.statsLabel.SetText(text)
+	ui.statsLabel.SetPositionX(math32.Round((ui.gameScreen.ContentWidth() - ui.statsLabel.ContentWidth()) / 2))
+}
+
+// formatDuration formats a duration as minutes and seconds e.g. 1:05.3
+func formatDuration(d time.Duration) string {
+	d = d.Round(100 * time.Millisecond)
+	return fmt.Sprintf("%d:%04.1f", int(d.Minutes()), (d % time.Minute).Seconds())
 }
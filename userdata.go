@@ -6,84 +6,316 @@ package main
 
 import (
 	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"time"
 )
 
-// The filepath of the binary file used to store the UserData instance
-const USER_DATA_FILENAME string = "/gokoban-user-data"
+// The directory (inside the user's config directory) where user data is stored
+const USER_DATA_DIRNAME string = "gokoban"
+
+// The version of the user data format - increment it and add a step to migrate when making incompatible changes
+const USER_DATA_VERSION int = 1
+
+// The filename (inside the user's cache directory) of the binary file used by older versions to store the UserData
+const LEGACY_USER_DATA_FILENAME string = "gokoban-user-data"
 
 // UserData stores all the information that persists between game sessions
 type UserData struct {
-	MusicOn           bool
-	MusicVol          float32
-	SfxOn             bool
-	SfxVol            float32
-	LastLevel         int
-	LastUnlockedLevel int
-	FullScreen        bool
+	Version    int                      `json:"version"`
+	MusicOn    bool                     `json:"musicOn"`
+	MusicVol   float32                  `json:"musicVol"`
+	SfxOn      bool                     `json:"sfxOn"`
+	SfxVol     float32                  `json:"sfxVol"`
+	FullScreen bool                     `json:"fullScreen"`
+	AnimScale  float32                  `json:"animScale"`          // animation speed relative to ANIMATION_SPEED
+	LastPack   string                   `json:"lastPack,omitempty"` // ID of the level pack played last
+	Packs      map[string]*PackProgress `json:"packs,omitempty"`    // progress in each level pack, keyed by Pack.ID
+	Levels     map[string]*LevelRecord  `json:"levels,omitempty"`   // records of each level, keyed by sim.LevelID
+
+	// Progress in the levels that come with the game, only kept by the binary format of older versions (see migrate)
+	LastLevel         int `json:"-"`
+	LastUnlockedLevel int `json:"-"`
+
+	profile string // name of the profile the user data belongs to
+}
+
+// PackProgress stores the player's progress in a level pack
+type PackProgress struct {
+	LastLevel         int `json:"lastLevel"`         // index of the level played last
+	LastUnlockedLevel int `json:"lastUnlockedLevel"` // index of the first level that wasn't completed
+}
+
+// LevelRecord stores the player's records and statistics for a single level
+// The bests are only meaningful if the level was completed
+type LevelRecord struct {
+	BestSteps      int           `json:"bestSteps,omitempty"`      // fewest steps taken to complete the level
+	BestPushes     int           `json:"bestPushes,omitempty"`     // fewest box pushes taken to complete the level
+	BestTime       time.Duration `json:"bestTime,omitempty"`       // shortest time taken to complete the level, in nanoseconds
+	Attempts       int           `json:"attempts"`                 // number of attempts in which the player moved the gopher
+	Restarts       int           `json:"restarts"`                 // number of attempts abandoned by restarting the level
+	Falls          int           `json:"falls"`                    // number of attempts that ended with something falling out of the world
+	FirstCompleted time.Time     `json:"firstCompleted,omitempty"` // when the level was completed for the first time
+}
+
+// Completed returns whether the level was ever completed
+func (rec *LevelRecord) Completed() bool {
+	return !rec.FirstCompleted.IsZero()
+}
+
+// AddCompletion updates the bests with the provided results of a completed attempt
+func (rec *LevelRecord) AddCompletion(steps, pushes int, elapsed time.Duration) {
+	first := !rec.Completed()
+	if first {
+		rec.FirstCompleted = time.Now()
+	}
+	if first || steps < rec.BestSteps {
+		rec.BestSteps = steps
+	}
+	if first || pushes < rec.BestPushes {
+		rec.BestPushes = pushes
+	}
+	if first || elapsed < rec.BestTime {
+		rec.BestTime = elapsed
+	}
+}
+
+// Record returns the records of the level with the provided ID, creating them if necessary
+func (ud *UserData) Record(id string) *LevelRecord {
+	if ud.Levels == nil {
+		ud.Levels = make(map[string]*LevelRecord)
+	}
+	rec, ok := ud.Levels[id]
+	if !ok {
+		rec = new(LevelRecord)
+		ud.Levels[id] = rec
+	}
+	return rec
+}
+
+// Progress returns the progress in the level pack with the provided ID, creating it if necessary
+func (ud *UserData) Progress(pack string) *PackProgress {
+	if ud.Packs == nil {
+		ud.Packs = make(map[string]*PackProgress)
+	}
+	p, ok := ud.Packs[pack]
+	if !ok {
+		p = new(PackProgress)
+		ud.Packs[pack] = p
+	}
+	return p
 }
 
-// NewUserData loads user data from file or creates a new object with default values if no file exists
-func LoadOrCreateUserData() *UserData {
+// NewUserData returns a pointer to a new UserData object for the provided profile with default values
+func NewUserData(profile string) *UserData {
 	ud := new(UserData)
+	ud.profile = profile
+	ud.Version = USER_DATA_VERSION
+	ud.SfxOn = true
+	ud.MusicOn = true
+	ud.SfxVol = 0.8
+	ud.MusicVol = 0.5
+	ud.FullScreen = false
+	ud.AnimScale = 1
+	return ud
+}
+
+// Profile returns the name of the profile the user data belongs to
+func (ud *UserData) Profile() string {
+	return ud.profile
+}
 
-	// Get user's cache directory
-	dataDir, err := os.UserCacheDir()
+// userDataDir returns the directory where user data is stored
+func userDataDir() (string, error) {
+	configDir, err := os.UserConfigDir()
 	if err != nil {
-		panic(err)
+		return "", err
 	}
+	return filepath.Join(configDir, USER_DATA_DIRNAME), nil
+}
 
-	// Try to read existing file
-	file, err := os.Open(dataDir + USER_DATA_FILENAME)
-	if err == nil {
-		decoder := gob.NewDecoder(file)
-		err = decoder.Decode(ud)
+// LoadProfile loads the user data of the provided profile from file or creates it with default values if no file exists
+// User data saved by older versions of the game is migrated into the default profile,
+// and a file that can't be read is kept as a backup
+func LoadProfile(name string) *UserData {
+
+	path, err := profilePath(name)
+	if err != nil {
+		log.Error("Can't locate user data: %v", err)
+		return NewUserData(name)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		if name == DEFAULT_PROFILE {
+			if ud := migrateUserData(); ud != nil {
+				return ud
+			}
+		}
+		ud := NewUserData(name)
+		log.Debug("Creating new user data with default values: %+v", ud)
+		return ud
+	}
+	if err != nil {
+		log.Error("Error reading user data: %v", err)
+		backupUserData(path)
+		return NewUserData(name)
+	}
+
+	ud, err := decodeUserData(data)
+	if err != nil {
+		log.Error("Error decoding %v: %v", path, err)
+		backupUserData(path)
+		return NewUserData(name)
+	}
+	ud.profile = name
+	log.Debug("Loaded user data: %+v", ud)
+	return ud
+}
+
+// migrateUserData loads the binary user data saved by older versions of the game (if any) and saves it as the default profile
+// The old file is renamed so that it is only migrated once
+func migrateUserData() *UserData {
+
+	oldPath, ud, err := loadLegacyUserData()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Error("Error reading old user data: %v", err)
+		}
+		return nil
+	}
+
+	log.Info("Migrating user data from %v to profile %q", oldPath, DEFAULT_PROFILE)
+	ud.profile = DEFAULT_PROFILE
+	if ud.Save() == nil {
+		err = os.Rename(oldPath, oldPath+".migrated")
 		if err != nil {
-			log.Debug("Error decoding gokoban-user-data: %v", err)
+			log.Error("Error renaming old user data: %v", err)
 		}
-	} else {
-		log.Debug("Error opening gokoban-user-data: %v", err)
 	}
-	file.Close()
+	return ud
+}
+
+// decodeUserData decodes user data from JSON, migrating it from older versions of the format
+// Values missing from the JSON keep their defaults
+func decodeUserData(data []byte) (*UserData, error) {
 
-	// If there was an error either opening or decoding the file
+	ud := NewUserData("")
+	ud.Version = 0
+	err := json.Unmarshal(data, ud)
 	if err != nil {
-		// Set default values
-		ud.SfxOn = true
-		ud.MusicOn = true
-		ud.SfxVol = 0.8
-		ud.MusicVol = 0.5
-		ud.FullScreen = false
+		return nil, err
+	}
+	if ud.Version < 1 || ud.Version > USER_DATA_VERSION {
+		return nil, fmt.Errorf("unsupported user data version %v", ud.Version)
+	}
+	ud.migrate()
+	if ud.AnimScale < ANIMATION_SCALE_MIN || ud.AnimScale > ANIMATION_SCALE_MAX {
+		ud.AnimScale = 1
+	}
+	return ud, nil
+}
+
+// migrate updates user data decoded from an older version of the format to the current version
+func (ud *UserData) migrate() {
+
+	// Version 0 (binary) kept a single progress for the levels that come with the game
+	if ud.Version < 1 {
+		p := ud.Progress(DEFAULT_PACK_ASSET)
+		p.LastLevel = ud.LastLevel
+		p.LastUnlockedLevel = ud.LastUnlockedLevel
 		ud.LastLevel = 0
 		ud.LastUnlockedLevel = 0
-		log.Debug("Creating new user data with default values: %+v", ud)
-	} else {
-		log.Debug("Loaded user data: %+v", ud)
+		ud.Version = 1
 	}
+}
 
-	return ud
+// loadLegacyUserData loads the binary user data saved by older versions of the game, returning the path it was loaded from
+func loadLegacyUserData() (string, *UserData, error) {
+
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", nil, err
+	}
+	path := filepath.Join(cacheDir, LEGACY_USER_DATA_FILENAME)
+	file, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+
+	// Gob leaves out zero values (e.g. music turned off), so the defaults must not be decoded into
+	ud := new(UserData)
+	err = gob.NewDecoder(file).Decode(ud)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Fields that didn't exist in the binary format
+	ud.Version = 0
+	ud.AnimScale = 1
+	ud.migrate()
+	return path, ud, nil
+}
+
+// backupUserData renames a user data file that couldn't be loaded so that it isn't overwritten
+func backupUserData(path string) {
+	backup := path + "." + time.Now().Format("20060102-150405") + ".bak"
+	err := os.Rename(path, backup)
+	if err != nil {
+		log.Error("Error backing up user data: %v", err)
+		return
+	}
+	log.Warn("Unreadable user data was moved to %v", backup)
 }
 
 // Save saves the current user data to the user data file, overwriting existing/old data
-func (ud *UserData) Save() {
+// The file is replaced atomically so that it is never left half written
+func (ud *UserData) Save() error {
 	log.Debug("Saving user data: %+v", ud)
 
-	// Get user's cache directory
-	dataDir, err := os.UserCacheDir()
+	err := ud.save()
 	if err != nil {
-		panic(err)
+		log.Error("Error saving user data: %v", err)
 	}
+	return err
+}
 
-	// Save user data to file
-	file, err := os.Create(dataDir + USER_DATA_FILENAME)
+func (ud *UserData) save() error {
+
+	path, err := profilePath(ud.profile)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(ud, "", "\t")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file in the same directory and rename it over the old file
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
 	if err == nil {
-		encoder := gob.NewEncoder(file)
-		err = encoder.Encode(&ud)
-		if err != nil {
-			log.Debug("Error encoding gokoban-user-data: %v", err)
-		}
-	} else {
-		log.Debug("Error creating gokoban-user-data: %v", err)
+		err = file.Sync()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
 	}
-	file.Close()
+	return err
 }